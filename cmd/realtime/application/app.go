@@ -5,16 +5,28 @@ import (
 	"fmt"
 	"syscall"
 
+	goredis "github.com/redis/go-redis/v9"
 	xclients "github.com/syth0le/gopnik/clients"
 	xcloser "github.com/syth0le/gopnik/closer"
-	"github.com/wagslane/go-rabbitmq"
 	"go.uber.org/zap"
 
 	"github.com/syth0le/realtime-notification-service/cmd/realtime/configuration"
 	"github.com/syth0le/realtime-notification-service/internal/clients/auth"
+	"github.com/syth0le/realtime-notification-service/internal/clients/broker"
+	"github.com/syth0le/realtime-notification-service/internal/infrastructure_services/acknowledgements"
 	"github.com/syth0le/realtime-notification-service/internal/infrastructure_services/connections_pool"
 	"github.com/syth0le/realtime-notification-service/internal/infrastructure_services/consumers_pool"
+	"github.com/syth0le/realtime-notification-service/internal/infrastructure_services/dispatcher"
+	"github.com/syth0le/realtime-notification-service/internal/infrastructure_services/heartbeat"
+	"github.com/syth0le/realtime-notification-service/internal/infrastructure_services/history"
+	"github.com/syth0le/realtime-notification-service/internal/infrastructure_services/inbox"
+	"github.com/syth0le/realtime-notification-service/internal/infrastructure_services/presence_events"
+	"github.com/syth0le/realtime-notification-service/internal/infrastructure_services/registry"
+	"github.com/syth0le/realtime-notification-service/internal/model"
+	"github.com/syth0le/realtime-notification-service/internal/service/admin"
 	"github.com/syth0le/realtime-notification-service/internal/service/notifications"
+	"github.com/syth0le/realtime-notification-service/internal/service/presence"
+	"github.com/syth0le/realtime-notification-service/internal/service/publish"
 )
 
 type App struct {
@@ -43,6 +55,14 @@ func (a *App) Run() error {
 		return fmt.Errorf("construct env: %w", err)
 	}
 
+	if a.Config.InternalAPI.Enable {
+		internalGRPCServer := a.newInternalGRPCServer(envStruct)
+		a.Closer.AddForce(internalGRPCServer.ForcefullyStop)
+		a.Closer.Add(internalGRPCServer.GracefullyStop)
+
+		a.Closer.Run(internalGRPCServer.Run)
+	}
+
 	httpServer := a.newHTTPServer(envStruct)
 	a.Closer.Add(httpServer.GracefulStop()...)
 
@@ -54,23 +74,81 @@ func (a *App) Run() error {
 type env struct {
 	authClient    auth.Client
 	notifications notifications.Service
+	admin         admin.Service
+	publish       publish.Service
+	presence      presence.Service
 }
 
 func (a *App) constructEnv(ctx context.Context) (*env, error) {
-	conn, err := a.makeRabbitConn(a.Config.Queue) // todo: make conn pool
+	brokerClients, err := a.makeBroker()
+	if err != nil {
+		return nil, fmt.Errorf("make broker: %w", err)
+	}
+
+	connectionsPool := connections_pool.NewServiceImpl(
+		a.Logger,
+		a.Config.Connection.SendQueueSize,
+		a.Config.Connection.SlowConsumerPolicy,
+		a.Config.Connection.WriteTimeout,
+	)
+	presenceEvents := a.makePresenceEvents(brokerClients.publisher)
+	a.Closer.Add(presenceEvents.Close)
+	a.Closer.Run(presenceEvents.Run)
+
+	registryService := a.makeRegistry(connectionsPool)
+	a.Closer.Add(registryService.Close)
+	a.Closer.Run(registryService.Run)
+
+	connectionsPool.OnPresenceChange(func(event *model.PresenceEvent) {
+		presenceEvents.Notify(event)
+		registryService.Notify(event)
+	})
+
+	historyService, err := a.makeHistoryService(a.Config.History)
+	if err != nil {
+		return nil, fmt.Errorf("make history service: %w", err)
+	}
+	a.Closer.Add(historyService.Close)
+	a.Closer.Run(historyService.Run)
+
+	inboxService, err := a.makeInboxService(a.Config.Inbox)
 	if err != nil {
-		return nil, fmt.Errorf("make rabbit conn: %w", err)
+		return nil, fmt.Errorf("make inbox service: %w", err)
 	}
+	a.Closer.Add(inboxService.Close)
+	a.Closer.Run(inboxService.Run)
+
+	ackService := a.makeAckService(connectionsPool, inboxService)
+	a.Closer.Add(ackService.Close)
+	a.Closer.Run(ackService.Run)
+
+	dispatcherService := dispatcher.NewServiceImpl(
+		a.Logger,
+		connectionsPool,
+		historyService,
+		ackService,
+		inboxService,
+	)
 
-	connectionsPool := connections_pool.NewServiceImpl(a.Logger)
 	consumersPool := consumers_pool.NewServiceImpl(
 		a.Logger,
-		conn,
-		a.Config.Queue.Enable,
-		a.Config.Queue.QueueName,
-		a.Config.Queue.ExchangeName,
+		brokerClients.subscribers,
+		brokerClients.binder,
+		brokerClients.retrier,
+		dispatcherService,
+	)
+	a.Closer.Add(consumersPool.Close)
+	a.Closer.Run(consumersPool.Run()...)
+
+	heartbeatService := heartbeat.NewServiceImpl(
+		a.Logger,
+		a.Config.Heartbeat.Enable,
+		a.Config.Heartbeat.PingInterval,
+		a.Config.Heartbeat.PongTimeout,
 		connectionsPool,
 	)
+	a.Closer.Add(heartbeatService.Close)
+	a.Closer.Run(heartbeatService.Run)
 
 	authClient, err := a.makeAuthClient(ctx, a.Config.AuthClient)
 	if err != nil {
@@ -82,25 +160,124 @@ func (a *App) constructEnv(ctx context.Context) (*env, error) {
 		notifications: &notifications.ServiceImpl{
 			ConnectionsPool: connectionsPool,
 			ConsumersPool:   consumersPool,
+			Dispatcher:      dispatcherService,
+			Acks:            ackService,
+			Inbox:           inboxService,
+			Logger:          a.Logger,
+
+			LongPollBufferSize:  a.Config.LongPoll.BufferSize,
+			LongPollIdleTimeout: a.Config.LongPoll.IdleTimeout,
+			LongPollMaxTimeout:  a.Config.LongPoll.MaxTimeout,
+		},
+		admin: &admin.ServiceImpl{
+			DeadLetters: brokerClients.deadLetters,
+			Logger:      a.Logger,
+		},
+		publish: &publish.ServiceImpl{
+			Publisher: brokerClients.publisher,
+			Topic:     brokerClients.notificationTopic,
+			Logger:    a.Logger,
+		},
+		presence: &presence.ServiceImpl{
+			ConnectionsPool: connectionsPool,
+			Registry:        registryService,
 			Logger:          a.Logger,
 		},
 	}, nil
 }
 
-func (a *App) makeRabbitConn(cfg configuration.RabbitConfig) (*rabbitmq.Conn, error) {
+func (a *App) makeHistoryService(cfg configuration.HistoryConfig) (history.Service, error) {
+	if cfg.Path == "" {
+		return history.NewServiceImpl(cfg.Size, cfg.TTL, cfg.PurgeInterval), nil
+	}
+
+	historyService, err := history.NewDiskServiceImpl(a.Logger, cfg.Size, cfg.TTL, cfg.PurgeInterval, cfg.Path)
+	if err != nil {
+		return nil, fmt.Errorf("new disk history: %w", err)
+	}
+
+	return historyService, nil
+}
+
+func (a *App) makeInboxService(cfg configuration.InboxConfig) (inbox.Service, error) {
 	if !cfg.Enable {
-		return nil, nil
+		return inbox.NewServiceMock(), nil
 	}
 
-	conn, err := rabbitmq.NewConn(
-		a.Config.Queue.Address,
-		rabbitmq.WithConnectionOptionsLogging,
+	var (
+		store inbox.Store
+		err   error
 	)
+	switch cfg.Backend {
+	case inbox.BoltBackend:
+		store, err = inbox.NewBoltStore(cfg.Path)
+	case inbox.PostgresBackend:
+		store, err = inbox.NewPostgresStore(cfg.DSN)
+	default:
+		store = inbox.NewMemoryStore()
+	}
 	if err != nil {
-		return nil, fmt.Errorf("cannot create connection: %w", err)
+		return nil, fmt.Errorf("new %s store: %w", cfg.Backend, err)
+	}
+
+	return inbox.NewServiceImpl(a.Logger, cfg.TTL, cfg.PurgeInterval, store), nil
+}
+
+func (a *App) makePresenceEvents(publisher broker.Publisher) presence_events.Service {
+	if !a.Config.Presence.Events.Enable {
+		return presence_events.NewServiceMock()
+	}
+
+	return presence_events.NewServiceImpl(
+		a.Logger,
+		publisher,
+		a.Config.Application.NodeID,
+		a.Config.Presence.Events.Topic,
+		a.Config.Presence.Events.BufferSize,
+	)
+}
+
+func (a *App) makeRegistry(connectionsPool connections_pool.Service) registry.Service {
+	cfg := a.Config.Presence.Registry
+	if !cfg.Enable {
+		return registry.NewServiceMock()
+	}
+
+	var store registry.Store
+	switch cfg.Backend {
+	case registry.RedisBackend:
+		store = registry.NewRedisStore(goredis.NewClient(&goredis.Options{
+			Addr:     cfg.Redis.Address,
+			Password: cfg.Redis.Password,
+			DB:       cfg.Redis.DB,
+		}), cfg.Redis.KeyPrefix)
+	default:
+		store = registry.NewMemoryStore()
 	}
 
-	return conn, nil
+	return registry.NewServiceImpl(
+		a.Logger,
+		a.Config.Application.NodeID,
+		cfg.TTL,
+		cfg.HeartbeatInterval,
+		cfg.BufferSize,
+		store,
+		connectionsPool,
+	)
+}
+
+func (a *App) makeAckService(connectionsPool connections_pool.Service, inboxService inbox.Service) acknowledgements.Service {
+	if !a.Config.Ack.Enable {
+		return acknowledgements.NewServiceMock()
+	}
+
+	return acknowledgements.NewServiceImpl(
+		a.Logger,
+		a.Config.Ack.RedeliveryTimeout,
+		a.Config.Ack.MaxRedeliveries,
+		connectionsPool,
+		inboxService,
+	)
 }
 
 func (a *App) makeAuthClient(ctx context.Context, cfg configuration.AuthClientConfig) (auth.Client, error) {
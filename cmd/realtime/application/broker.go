@@ -0,0 +1,488 @@
+package application
+
+import (
+	"fmt"
+
+	natsio "github.com/nats-io/nats.go"
+	"github.com/prometheus/client_golang/prometheus"
+	amqp "github.com/rabbitmq/amqp091-go"
+	goredis "github.com/redis/go-redis/v9"
+
+	"github.com/syth0le/realtime-notification-service/internal/clients/broker"
+	"github.com/syth0le/realtime-notification-service/internal/clients/kafka"
+	"github.com/syth0le/realtime-notification-service/internal/clients/nats"
+	"github.com/syth0le/realtime-notification-service/internal/clients/rabbit"
+	"github.com/syth0le/realtime-notification-service/internal/clients/redis"
+)
+
+const (
+	defaultMemoryQueueName = "notifications"
+
+	// offlineRoutingKey binds the offline queue, fanout exchange ignores routing keys
+	offlineRoutingKey = "#"
+)
+
+type brokerClients struct {
+	subscribers []broker.Subscriber
+	binder      broker.Binder
+	retrier     broker.Retrier
+	deadLetters broker.DeadLetters
+	publisher   broker.Publisher
+
+	// notificationTopic returns topic notifications of the user are consumed from, user id is the message key
+	notificationTopic func(key string) string
+}
+
+func (a *App) makeBroker() (*brokerClients, error) {
+	switch {
+	case a.Config.Broker.Kind == broker.RabbitMQKind && a.Config.Queue.Enable:
+		return a.makeRabbitBroker()
+	case a.Config.Broker.Kind == broker.KafkaKind && a.Config.Kafka.Enable:
+		return a.makeKafkaBroker()
+	case a.Config.Broker.Kind == broker.NatsKind && a.Config.Nats.Enable:
+		return a.makeNatsBroker()
+	case a.Config.Broker.Kind == broker.RedisKind && a.Config.Redis.Enable:
+		return a.makeRedisBroker()
+	default:
+		return a.makeMemoryBroker(), nil
+	}
+}
+
+func (a *App) makeRabbitBroker() (*brokerClients, error) {
+	pool, err := rabbit.NewConnectionPool(
+		a.Logger,
+		rabbit.NewPoolMetrics(prometheus.DefaultRegisterer),
+		a.Config.Queue.Address,
+		a.Config.Queue.Pool.Size,
+		a.Config.Queue.Pool.ChannelMax,
+		a.Config.Queue.Pool.HealthCheckInterval,
+		a.Config.Queue.Pool.InitialBackoff,
+		a.Config.Queue.Pool.MaxBackoff,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("new rabbit connection pool: %w", err)
+	}
+	a.Closer.Add(pool.Close)
+	a.Closer.Run(pool.Run)
+
+	topology, routingKey := a.rabbitTopology(), a.Config.Queue.RoutingKey
+	if a.Config.Queue.PerNodeQueue {
+		routingKey = ""
+	}
+
+	binder, err := rabbit.NewRabbitBinder(
+		a.Logger,
+		a.Config.Queue.PerNodeQueue,
+		pool,
+		topology,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("new rabbit binder: %w", err)
+	}
+
+	retrier, err := rabbit.NewRabbitRetrier(
+		a.Logger,
+		a.Config.Queue.Retry.Enable,
+		pool,
+		a.Config.Queue.QueueName,
+		a.Config.Queue.ExchangeName,
+		a.Config.Queue.Retry.DeadLetterExchange,
+		a.Config.Queue.Retry.DeadLetterQueue,
+		a.Config.Queue.Retry.MaxAttempts,
+		a.Config.Queue.Retry.InitialDelay,
+		a.Config.Queue.Retry.MaxDelay,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("new rabbit retrier: %w", err)
+	}
+
+	publisher, err := rabbit.NewRabbitPublisher(a.Logger, pool, []string{a.Config.Queue.ExchangeName})
+	if err != nil {
+		return nil, fmt.Errorf("new rabbit publisher: %w", err)
+	}
+	a.Closer.Add(publisher.Close)
+
+	// node queue and its bindings are declared again every time consumer is restarted
+	restorer, _ := binder.(rabbit.Restorer)
+
+	subscribers := make([]broker.Subscriber, 0, a.Config.Queue.ConsumersCount+1)
+	for i := 0; i < a.Config.Queue.ConsumersCount; i++ {
+		subscriber, err := rabbit.NewRabbitSubscriber(
+			a.Logger,
+			pool,
+			topology,
+			routingKey,
+			restorer,
+			a.Config.Queue.Prefetch,
+			a.Config.Queue.Concurrency,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("new rabbit subscriber: %w", err)
+		}
+
+		subscribers = append(subscribers, subscriber)
+	}
+
+	if a.Config.Queue.PerNodeQueue && a.Config.Queue.OfflineQueue != "" {
+		// notifications of users connected to no node are shared by all nodes, they are put to the inbox
+		subscriber, err := rabbit.NewRabbitSubscriber(
+			a.Logger,
+			pool,
+			a.rabbitOfflineTopology(),
+			offlineRoutingKey,
+			nil,
+			a.Config.Queue.Prefetch,
+			a.Config.Queue.Concurrency,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("new rabbit offline subscriber: %w", err)
+		}
+
+		subscribers = append(subscribers, subscriber)
+	}
+
+	return &brokerClients{
+		subscribers:       subscribers,
+		binder:            binder,
+		retrier:           retrier,
+		deadLetters:       retrier,
+		publisher:         publisher,
+		notificationTopic: a.staticTopic(a.Config.Queue.ExchangeName),
+	}, nil
+}
+
+// rabbitTopology returns declaration of the queue all consumers of the node and the binder share.
+// Node queue lives as long as the node, so it is always auto-delete, exclusive and not durable
+func (a *App) rabbitTopology() rabbit.Topology {
+	topology := rabbit.Topology{
+		ExchangeName:    a.Config.Queue.ExchangeName,
+		ExchangeKind:    a.Config.Queue.ExchangeKind,
+		ExchangeDurable: a.Config.Queue.ExchangeDurable,
+		QueueName:       a.Config.Queue.QueueName,
+		QueueDurable:    a.Config.Queue.Durable,
+		QueueAutoDelete: a.Config.Queue.AutoDelete,
+		QueueArgs:       a.Config.Queue.QueueArgs,
+	}
+
+	if a.Config.Queue.PerNodeQueue {
+		topology.QueueName = fmt.Sprintf("%s.%s", a.Config.Queue.QueueName, a.Config.Application.NodeID)
+		topology.QueueDurable = false
+		topology.QueueAutoDelete = true
+		topology.QueueExclusive = true
+
+		if a.Config.Queue.OfflineQueue != "" {
+			topology.ExchangeArgs = amqp.Table{"alternate-exchange": a.rabbitOfflineExchange()}
+		}
+	}
+	return topology
+}
+
+// rabbitOfflineTopology returns declaration of the queue shared by all nodes, it is bound to the alternate exchange
+// of the notifications exchange, so it gets notifications no node queue is bound to
+func (a *App) rabbitOfflineTopology() rabbit.Topology {
+	return rabbit.Topology{
+		ExchangeName:    a.rabbitOfflineExchange(),
+		ExchangeKind:    amqp.ExchangeFanout,
+		ExchangeDurable: a.Config.Queue.ExchangeDurable,
+		QueueName:       a.Config.Queue.OfflineQueue,
+		QueueDurable:    true,
+	}
+}
+
+func (a *App) rabbitOfflineExchange() string {
+	return fmt.Sprintf("%s.offline", a.Config.Queue.ExchangeName)
+}
+
+// makeKafkaBroker creates members of the consumer group of the node, every node reads all partitions
+// and handles records of its connected users only
+func (a *App) makeKafkaBroker() (*brokerClients, error) {
+	retrier, err := kafka.NewKafkaRetrier(
+		a.Logger,
+		a.Config.Kafka.Retry.Enable,
+		a.Config.Kafka.Brokers,
+		a.Config.Kafka.Retry.DeadLetterTopic,
+		a.Config.Kafka.Retry.MaxAttempts,
+		a.Config.Kafka.Retry.InitialDelay,
+		a.Config.Kafka.Retry.MaxDelay,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("new kafka retrier: %w", err)
+	}
+
+	publisher, err := kafka.NewKafkaPublisher(a.Logger, a.Config.Kafka.Brokers)
+	if err != nil {
+		return nil, fmt.Errorf("new kafka publisher: %w", err)
+	}
+	a.Closer.Add(publisher.Close)
+
+	binder := kafka.NewKafkaBinder(fmt.Sprintf("%s.%s", a.Config.Kafka.Group, a.Config.Application.NodeID))
+
+	subscribers := make([]broker.Subscriber, 0, a.Config.Kafka.ConsumersCount)
+	for i := 0; i < a.Config.Kafka.ConsumersCount; i++ {
+		subscriber, err := kafka.NewKafkaSubscriber(
+			a.Logger,
+			a.Config.Kafka.Brokers,
+			a.Config.Kafka.Topic,
+			binder,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("new kafka subscriber: %w", err)
+		}
+
+		subscribers = append(subscribers, subscriber)
+	}
+
+	return &brokerClients{
+		subscribers:       subscribers,
+		binder:            binder,
+		retrier:           retrier,
+		deadLetters:       retrier,
+		publisher:         publisher,
+		notificationTopic: a.staticTopic(a.Config.Kafka.Topic),
+	}, nil
+}
+
+// makeNatsBroker creates subscriber of the user subjects bound to the node, through jetstream consumers if enabled
+func (a *App) makeNatsBroker() (*brokerClients, error) {
+	address := a.Config.Nats.Address
+	if a.Config.Nats.Embedded.Enable {
+		embedded, err := nats.NewEmbeddedServer(
+			a.Logger,
+			a.Config.Nats.Embedded.Host,
+			a.Config.Nats.Embedded.Port,
+			a.Config.Nats.JetStream.Enable,
+			a.Config.Nats.Embedded.StoreDir,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("new embedded nats server: %w", err)
+		}
+		a.Closer.Add(embedded.Close)
+
+		address = embedded.ClientURL()
+	}
+
+	conn, err := natsio.Connect(address, natsio.Name(a.Config.Application.App), natsio.MaxReconnects(-1))
+	if err != nil {
+		return nil, fmt.Errorf("cannot connect to nats: %w", err)
+	}
+	a.Closer.Add(func() error {
+		conn.Close()
+		return nil
+	})
+
+	deadLetterStream := ""
+	if a.Config.Nats.JetStream.Enable {
+		deadLetterStream = a.Config.Nats.JetStream.DeadLetterStream
+	}
+
+	retrier, err := nats.NewNatsRetrier(
+		a.Logger,
+		a.Config.Nats.Retry.Enable,
+		conn,
+		a.Config.Nats.Retry.DeadLetterSubject,
+		deadLetterStream,
+		a.Config.Nats.Retry.MaxAttempts,
+		a.Config.Nats.Retry.InitialDelay,
+		a.Config.Nats.Retry.MaxDelay,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("new nats retrier: %w", err)
+	}
+
+	publisher := nats.NewNatsPublisher(a.Logger, conn)
+
+	// every node subscribes to subjects of its connected users only, so the subscriber is the binder of the node
+	if a.Config.Nats.JetStream.Enable {
+		subscriber, err := nats.NewJetStreamSubscriber(
+			a.Logger,
+			conn,
+			a.Config.Nats.SubjectPrefix,
+			a.Config.Nats.JetStream.Stream,
+			nats.StreamLimits{
+				MaxAge:   a.Config.Nats.JetStream.MaxAge,
+				MaxMsgs:  a.Config.Nats.JetStream.MaxMsgs,
+				MaxBytes: a.Config.Nats.JetStream.MaxBytes,
+			},
+			a.Config.Application.NodeID,
+			a.Config.Nats.JetStream.AckWait,
+			a.Config.Nats.JetStream.MaxDeliver,
+			a.Config.Nats.JetStream.InactiveThreshold,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("new jetstream subscriber: %w", err)
+		}
+
+		return &brokerClients{
+			subscribers:       []broker.Subscriber{subscriber},
+			binder:            subscriber,
+			retrier:           retrier,
+			deadLetters:       retrier,
+			publisher:         publisher,
+			notificationTopic: a.staticTopic(nats.UsersSubject(a.Config.Nats.SubjectPrefix)),
+		}, nil
+	}
+
+	subscriber := nats.NewNatsSubscriber(a.Logger, conn, a.Config.Nats.SubjectPrefix)
+	return &brokerClients{
+		subscribers:       []broker.Subscriber{subscriber},
+		binder:            subscriber,
+		retrier:           retrier,
+		deadLetters:       retrier,
+		publisher:         publisher,
+		notificationTopic: a.staticTopic(nats.UsersSubject(a.Config.Nats.SubjectPrefix)),
+	}, nil
+}
+
+// makeRedisBroker creates pub/sub subscriber of user channels or members of the stream consumer group of the node
+func (a *App) makeRedisBroker() (*brokerClients, error) {
+	address := a.Config.Redis.Address
+	if a.Config.Redis.Embedded.Enable {
+		embedded, err := redis.NewEmbeddedServer(a.Logger, a.Config.Redis.Embedded.Address)
+		if err != nil {
+			return nil, fmt.Errorf("new embedded redis: %w", err)
+		}
+		a.Closer.Add(embedded.Close)
+
+		address = embedded.Addr()
+	}
+
+	client := goredis.NewClient(&goredis.Options{
+		Addr:     address,
+		Password: a.Config.Redis.Password,
+		DB:       a.Config.Redis.DB,
+	})
+	a.Closer.Add(client.Close)
+
+	stream := ""
+	if a.Config.Redis.Mode == redis.StreamsMode {
+		stream = a.Config.Redis.Stream
+	}
+
+	retrier := redis.NewRedisRetrier(
+		a.Logger,
+		a.Config.Redis.Retry.Enable,
+		client,
+		stream,
+		a.Config.Redis.Retry.DeadLetterStream,
+		a.Config.Redis.Retry.MaxAttempts,
+		a.Config.Redis.Retry.InitialDelay,
+		a.Config.Redis.Retry.MaxDelay,
+	)
+
+	publisher := redis.NewRedisPublisher(a.Logger, client, a.Config.Redis.Mode)
+
+	if a.Config.Redis.Mode == redis.PubSubMode {
+		// every pub/sub subscriber gets every message, so there is one subscriber per node
+		pubsub, err := redis.NewRedisPubSub(
+			a.Logger,
+			client,
+			a.Config.Redis.ChannelPrefix,
+			a.Config.Redis.PerUserChannels,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("new redis pubsub: %w", err)
+		}
+
+		var binder broker.Binder = &broker.BinderMock{Logger: a.Logger}
+		if a.Config.Redis.PerUserChannels {
+			binder = pubsub
+		}
+
+		return &brokerClients{
+			subscribers: []broker.Subscriber{pubsub},
+			binder:      binder,
+			retrier:     retrier,
+			deadLetters: retrier,
+			publisher:   publisher,
+			notificationTopic: func(key string) string {
+				return redis.UserChannel(a.Config.Redis.ChannelPrefix, key)
+			},
+		}, nil
+	}
+
+	// every node reads the stream through its own group and handles entries of its connected users only
+	binder := redis.NewStreamBinder(
+		a.Logger,
+		client,
+		a.Config.Redis.Stream,
+		fmt.Sprintf("%s.%s", a.Config.Redis.Group, a.Config.Application.NodeID),
+	)
+
+	subscribers := make([]broker.Subscriber, 0, a.Config.Redis.ConsumersCount)
+	for i := 0; i < a.Config.Redis.ConsumersCount; i++ {
+		subscriber, err := redis.NewStreamSubscriber(
+			a.Logger,
+			client,
+			binder,
+			fmt.Sprintf("%s-%d", a.Config.Application.NodeID, i),
+			a.Config.Redis.BlockTimeout,
+			a.Config.Redis.ClaimTimeout,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("new redis stream subscriber: %w", err)
+		}
+
+		subscribers = append(subscribers, subscriber)
+	}
+
+	return &brokerClients{
+		subscribers:       subscribers,
+		binder:            binder,
+		retrier:           retrier,
+		deadLetters:       retrier,
+		publisher:         publisher,
+		notificationTopic: a.staticTopic(a.Config.Redis.Stream),
+	}, nil
+}
+
+// makeMemoryBroker creates in-process broker for single binary mode, it has the same topology as rabbitmq one
+func (a *App) makeMemoryBroker() *brokerClients {
+	memoryBroker := broker.NewMemoryBroker(
+		a.Logger,
+		a.Config.Queue.Retry.MaxAttempts,
+		a.Config.Queue.Retry.InitialDelay,
+		a.Config.Queue.Retry.MaxDelay,
+	)
+	a.Closer.Add(memoryBroker.Close)
+
+	queueName := a.Config.Queue.QueueName
+	if queueName == "" {
+		queueName = defaultMemoryQueueName
+	}
+
+	subscribers := make([]broker.Subscriber, 0, a.Config.Queue.ConsumersCount+1)
+
+	var binder broker.Binder = &broker.BinderMock{Logger: a.Logger}
+	if a.Config.Queue.PerNodeQueue {
+		memoryBroker.DeclareQueue(queueName, a.Config.Queue.ExchangeName)
+		binder = memoryBroker.NewBinder(queueName, a.Config.Queue.ExchangeName)
+
+		// notifications of users who are not connected are put to the inbox
+		offlineQueueName := fmt.Sprintf("%s.offline", queueName)
+		memoryBroker.DeclareAlternateQueue(offlineQueueName, a.Config.Queue.ExchangeName)
+		subscribers = append(subscribers, memoryBroker.NewSubscriber(offlineQueueName))
+	} else {
+		memoryBroker.DeclareQueue(queueName, a.Config.Queue.ExchangeName, a.Config.Queue.RoutingKey)
+	}
+
+	for i := 0; i < a.Config.Queue.ConsumersCount; i++ {
+		subscribers = append(subscribers, memoryBroker.NewSubscriber(queueName))
+	}
+
+	a.Logger.Sugar().Infof("using in-memory broker, queue: %s", queueName)
+	return &brokerClients{
+		subscribers:       subscribers,
+		binder:            binder,
+		retrier:           memoryBroker,
+		deadLetters:       memoryBroker,
+		publisher:         memoryBroker,
+		notificationTopic: a.staticTopic(a.Config.Queue.ExchangeName),
+	}
+}
+
+// staticTopic is used by brokers which route notifications of all users through one topic by the message key
+func (a *App) staticTopic(topic string) func(key string) string {
+	return func(string) string {
+		return topic
+	}
+}
@@ -0,0 +1,35 @@
+package application
+
+import (
+	xservers "github.com/syth0le/gopnik/servers"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/keepalive"
+
+	"github.com/syth0le/realtime-notification-service/internal/handler/internalapi"
+	inpb "github.com/syth0le/realtime-notification-service/proto/internalapi"
+)
+
+func (a *App) newInternalGRPCServer(env *env) *xservers.GRPCServer {
+	server := xservers.NewGRPCServer(
+		a.Config.InternalGRPCServer,
+		a.Logger,
+		xservers.GRPCWithServerName("internal grpc server"),
+		xservers.GRPCWithUnaryInterceptors(internalapi.TokenUnaryInterceptor(a.Config.InternalAPI.Tokens)),
+		xservers.GRPCWithStreamInterceptors(internalapi.TokenStreamInterceptor(a.Config.InternalAPI.Tokens)),
+		// subscriptions of gone clients are detected by http/2 pings with the same timings as browser connections
+		xservers.GRPCWithServerOptions(grpc.KeepaliveParams(keepalive.ServerParameters{
+			Time:    a.Config.Heartbeat.PingInterval,
+			Timeout: a.Config.Heartbeat.PongTimeout,
+		})),
+	)
+
+	inpb.RegisterNotificationServiceServer(server.Server, &internalapi.NotificationHandler{
+		Logger:               a.Logger,
+		AuthClient:           env.authClient,
+		PublishService:       env.publish,
+		PresenceService:      env.presence,
+		NotificationsService: env.notifications,
+	})
+
+	return server
+}
@@ -4,14 +4,16 @@ import (
 	xservers "github.com/syth0le/gopnik/servers"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 
+	"github.com/syth0le/realtime-notification-service/internal/handler/adminapi"
 	"github.com/syth0le/realtime-notification-service/internal/handler/publicapi"
 )
 
 func (a *App) newHTTPServer(env *env) *xservers.HTTPServerWrapper {
 	return xservers.NewHTTPServerWrapper(
 		a.Logger,
-		xservers.WithAdminServer(a.Config.AdminServer),
+		xservers.WithPublicServer(a.Config.AdminServer, a.adminMux(env)),
 		xservers.WithPublicServer(a.Config.PublicServer, a.publicMux(env)),
 	)
 }
@@ -19,12 +21,61 @@ func (a *App) newHTTPServer(env *env) *xservers.HTTPServerWrapper {
 func (a *App) publicMux(env *env) *chi.Mux {
 	mux := chi.NewMux()
 
-	handler := publicapi.NewHandler(a.Logger, env.notifications)
+	handler := publicapi.NewHandler(a.Logger, env.notifications, env.presence)
 
 	mux.Route("/post", func(r chi.Router) {
 		r.Use(env.authClient.AuthenticationInterceptor)
 		r.HandleFunc("/feed/posted", handler.SubscribeFeedNotifications)
+		r.Get("/feed/posted/sse", handler.StreamFeedNotifications)
+		r.Get("/feed/posted/poll", handler.PollFeedNotifications)
 	})
 
+	mux.Route("/notifications", func(r chi.Router) {
+		r.Use(env.authClient.AuthenticationInterceptor)
+		r.HandleFunc("/ws", handler.SubscribeNotifications)
+		r.Get("/inbox", handler.GetInbox)
+		r.Delete("/inbox", handler.DeleteInbox)
+	})
+
+	// users see their own presence only, presence of other users is served by the admin api
+	mux.Route("/presence", func(r chi.Router) {
+		r.Use(env.authClient.AuthenticationInterceptor)
+		r.Get("/", handler.GetPresence)
+		r.Get("/online", handler.IsOnline)
+	})
+
+	return mux
+}
+
+// adminMux is served on the admin server port, it must not be exposed publicly
+func (a *App) adminMux(env *env) *chi.Mux {
+	mux := chi.NewMux()
+
+	handler := adminapi.NewHandler(a.Logger, env.admin, env.publish, env.presence)
+
+	mux.Handle("/metrics", promhttp.Handler())
+
+	mux.Route("/dead-letters", func(r chi.Router) {
+		r.Use(handler.TokenInterceptor(a.Config.AdminAPI.Tokens))
+		r.Get("/", handler.ListDeadLetters)
+		r.Get("/{messageID}", handler.GetDeadLetter)
+		r.Post("/{messageID}/replay", handler.ReplayDeadLetter)
+	})
+
+	mux.Route("/presence", func(r chi.Router) {
+		r.Use(handler.TokenInterceptor(a.Config.AdminAPI.Tokens))
+		r.Post("/", handler.LookupPresence)
+		r.Get("/{userID}", handler.GetPresence)
+		r.Get("/{userID}/online", handler.IsOnline)
+	})
+
+	if a.Config.PublishAPI.Enable {
+		mux.Route("/publish", func(r chi.Router) {
+			r.Use(handler.TokenInterceptor(a.Config.PublishAPI.Tokens))
+			r.Post("/", handler.Publish)
+			r.Post("/batch", handler.PublishBatch)
+		})
+	}
+
 	return mux
 }
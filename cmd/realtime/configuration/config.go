@@ -1,41 +1,176 @@
 package configuration
 
 import (
+	"fmt"
+	"strings"
+
+	amqp "github.com/rabbitmq/amqp091-go"
 	xclients "github.com/syth0le/gopnik/clients"
 	xlogger "github.com/syth0le/gopnik/logger"
 	xservers "github.com/syth0le/gopnik/servers"
 
 	"time"
+
+	"github.com/syth0le/realtime-notification-service/internal/clients/broker"
+	"github.com/syth0le/realtime-notification-service/internal/clients/redis"
+	"github.com/syth0le/realtime-notification-service/internal/infrastructure_services/connections_pool"
+	"github.com/syth0le/realtime-notification-service/internal/infrastructure_services/inbox"
+	"github.com/syth0le/realtime-notification-service/internal/infrastructure_services/registry"
 )
 
 type Config struct {
-	Logger       xlogger.LoggerConfig  `yaml:"logger"`
-	Application  ApplicationConfig     `yaml:"application"`
-	PublicServer xservers.ServerConfig `yaml:"public_server"`
-	AdminServer  xservers.ServerConfig `yaml:"admin_server"`
-	Queue        RabbitConfig          `yaml:"queue"`
-	AuthClient   AuthClientConfig      `yaml:"auth"`
+	Logger             xlogger.LoggerConfig      `yaml:"logger"`
+	Application        ApplicationConfig         `yaml:"application"`
+	PublicServer       xservers.ServerConfig     `yaml:"public_server"`
+	AdminServer        xservers.ServerConfig     `yaml:"admin_server"`
+	InternalGRPCServer xservers.GRPCServerConfig `yaml:"internal_grpc_server"`
+	Broker             BrokerConfig              `yaml:"broker"`
+	Queue              RabbitConfig              `yaml:"queue"`
+	Kafka              KafkaConfig               `yaml:"kafka"`
+	Nats               NatsConfig                `yaml:"nats"`
+	Redis              RedisConfig               `yaml:"redis"`
+	AuthClient         AuthClientConfig          `yaml:"auth"`
+	Heartbeat          HeartbeatConfig           `yaml:"heartbeat"`
+	Connection         ConnectionConfig          `yaml:"connection"`
+	History            HistoryConfig             `yaml:"history"`
+	LongPoll           LongPollConfig            `yaml:"long_poll"`
+	Ack                AckConfig                 `yaml:"ack"`
+	Inbox              InboxConfig               `yaml:"inbox"`
+	AdminAPI           AdminAPIConfig            `yaml:"admin_api"`
+	PublishAPI         PublishAPIConfig          `yaml:"publish_api"`
+	InternalAPI        InternalAPIConfig         `yaml:"internal_api"`
+	Presence           PresenceConfig            `yaml:"presence"`
 }
 
 func (c *Config) Validate() error {
-	return nil // todo
+	if err := c.Broker.Validate(); err != nil {
+		return fmt.Errorf("broker: %w", err)
+	}
+
+	if err := c.Queue.Validate(); err != nil {
+		return fmt.Errorf("queue: %w", err)
+	}
+
+	if err := c.Kafka.Validate(); err != nil {
+		return fmt.Errorf("kafka: %w", err)
+	}
+
+	if err := c.Nats.Validate(); err != nil {
+		return fmt.Errorf("nats: %w", err)
+	}
+
+	if err := c.Redis.Validate(); err != nil {
+		return fmt.Errorf("redis: %w", err)
+	}
+
+	if err := c.Heartbeat.Validate(); err != nil {
+		return fmt.Errorf("heartbeat: %w", err)
+	}
+
+	if err := c.Connection.Validate(); err != nil {
+		return fmt.Errorf("connection: %w", err)
+	}
+
+	if err := c.History.Validate(); err != nil {
+		return fmt.Errorf("history: %w", err)
+	}
+
+	if err := c.LongPoll.Validate(); err != nil {
+		return fmt.Errorf("long poll: %w", err)
+	}
+
+	if err := c.Ack.Validate(); err != nil {
+		return fmt.Errorf("ack: %w", err)
+	}
+
+	if err := c.Inbox.Validate(); err != nil {
+		return fmt.Errorf("inbox: %w", err)
+	}
+
+	if c.Inbox.Enable && !c.routesOfflineUsers() {
+		return fmt.Errorf("inbox: %s broker does not route notifications of users connected to no node", c.Broker.Kind)
+	}
+
+	if err := c.AdminAPI.Validate(); err != nil {
+		return fmt.Errorf("admin api: %w", err)
+	}
+
+	if err := c.PublishAPI.Validate(); err != nil {
+		return fmt.Errorf("publish api: %w", err)
+	}
+
+	if err := c.InternalAPI.Validate(); err != nil {
+		return fmt.Errorf("internal api: %w", err)
+	}
+
+	if err := c.Presence.Validate(); err != nil {
+		return fmt.Errorf("presence: %w", err)
+	}
+
+	return nil
+}
+
+// routesOfflineUsers tells whether notifications of users connected to no node are consumed, so they reach the inbox.
+// Subscribers bound to keys of connected users only drop them unless they are routed to a shared queue
+func (c *Config) routesOfflineUsers() bool {
+	switch {
+	case c.Broker.Kind == broker.RabbitMQKind && c.Queue.Enable:
+		return !c.Queue.PerNodeQueue || c.Queue.OfflineQueue != ""
+	case c.Broker.Kind == broker.KafkaKind && c.Kafka.Enable:
+		return false
+	case c.Broker.Kind == broker.NatsKind && c.Nats.Enable:
+		return false
+	case c.Broker.Kind == broker.RedisKind && c.Redis.Enable:
+		return c.Redis.Mode == redis.PubSubMode && !c.Redis.PerUserChannels
+	default:
+		return true
+	}
 }
 
 type ApplicationConfig struct {
 	GracefulShutdownTimeout time.Duration `yaml:"graceful_shutdown_timeout"`
 	ForceShutdownTimeout    time.Duration `yaml:"force_shutdown_timeout"`
 	App                     string        `yaml:"app"`
+	NodeID                  string        `yaml:"node_id" env:"NODE_ID"`
 }
 
 func (c *ApplicationConfig) Validate() error {
 	return nil // todo
 }
 
+type BrokerConfig struct {
+	// Kind is rabbitmq, kafka, nats, redis or memory, in-memory broker is used as well if the selected broker is disabled
+	Kind broker.Kind `yaml:"kind"`
+}
+
+func (c *BrokerConfig) Validate() error {
+	if err := c.Kind.Validate(); err != nil {
+		return fmt.Errorf("kind: %w", err)
+	}
+
+	return nil
+}
+
 type RabbitConfig struct {
-	Enable       bool   `yaml:"enable"`
-	Address      string `yaml:"address"`
-	QueueName    string `yaml:"queue_name"`
-	ExchangeName string `yaml:"exchange_name"`
+	Enable         bool   `yaml:"enable"`
+	Address        string `yaml:"address"`
+	QueueName      string `yaml:"queue_name"`
+	ExchangeName   string `yaml:"exchange_name"`
+	RoutingKey     string `yaml:"routing_key"`     // binding key of shared consumers, delivery routing key is a recipient user id
+	ConsumersCount int    `yaml:"consumers_count"` // number of shared consumers per node
+	PerNodeQueue   bool   `yaml:"per_node_queue"`  // declare exclusive auto-delete queue per node and bind routing keys of connected users only
+	OfflineQueue   string `yaml:"offline_queue"`   // durable queue shared by all nodes, it gets notifications of users connected to no node
+
+	Prefetch        int            `yaml:"prefetch"`         // unacknowledged deliveries per consumer, 0 is unlimited
+	Concurrency     int            `yaml:"concurrency"`      // handler goroutines per consumer
+	ExchangeKind    string         `yaml:"exchange_kind"`    // topic, direct, fanout or headers
+	ExchangeDurable bool           `yaml:"exchange_durable"` // exchange survives broker restart
+	Durable         bool           `yaml:"durable"`          // shared queue survives broker restart, node queue is never durable
+	AutoDelete      bool           `yaml:"auto_delete"`      // shared queue is deleted with its last consumer, node queue is always auto-delete
+	QueueArgs       map[string]any `yaml:"queue_args"`       // optional queue arguments, e.g. x-queue-type or x-max-length
+
+	Pool  RabbitPoolConfig `yaml:"pool"`
+	Retry RetryConfig      `yaml:"retry"`
 }
 
 func (c *RabbitConfig) Validate() error {
@@ -43,7 +178,388 @@ func (c *RabbitConfig) Validate() error {
 		return nil
 	}
 
-	return nil // todo
+	if c.ConsumersCount <= 0 {
+		return fmt.Errorf("consumers count must be positive")
+	}
+
+	if c.Prefetch < 0 {
+		return fmt.Errorf("prefetch must not be negative")
+	}
+
+	if c.Concurrency <= 0 {
+		return fmt.Errorf("concurrency must be positive")
+	}
+
+	switch c.ExchangeKind {
+	case amqp.ExchangeTopic, amqp.ExchangeDirect, amqp.ExchangeFanout, amqp.ExchangeHeaders:
+	default:
+		return fmt.Errorf("unexpected exchange kind: %s", c.ExchangeKind)
+	}
+
+	if err := c.Pool.Validate(); err != nil {
+		return fmt.Errorf("pool: %w", err)
+	}
+
+	if err := c.Retry.Validate(); err != nil {
+		return fmt.Errorf("retry: %w", err)
+	}
+
+	return nil
+}
+
+// RabbitPoolConfig is a pool of connections all consumers, binder and retrier take their channels from
+type RabbitPoolConfig struct {
+	Size                int           `yaml:"size"`                  // number of connections
+	ChannelMax          int           `yaml:"channel_max"`           // channels per connection, it must not exceed broker channel max
+	HealthCheckInterval time.Duration `yaml:"health_check_interval"` // interval of closed connections check
+	InitialBackoff      time.Duration `yaml:"initial_backoff"`       // delay before the first reconnect, it is doubled on every next attempt
+	MaxBackoff          time.Duration `yaml:"max_backoff"`
+}
+
+func (c *RabbitPoolConfig) Validate() error {
+	if c.Size <= 0 {
+		return fmt.Errorf("size must be positive")
+	}
+
+	if c.ChannelMax <= 0 {
+		return fmt.Errorf("channel max must be positive")
+	}
+
+	if c.HealthCheckInterval <= 0 {
+		return fmt.Errorf("health check interval must be positive")
+	}
+
+	if c.InitialBackoff <= 0 {
+		return fmt.Errorf("initial backoff must be positive")
+	}
+
+	if c.MaxBackoff < c.InitialBackoff {
+		return fmt.Errorf("max backoff must not be less than initial backoff")
+	}
+
+	return nil
+}
+
+// RetryConfig is a policy of failed deliveries, they are retried through delay queues
+// and published to the dead-letter exchange after max attempts
+type RetryConfig struct {
+	Enable             bool          `yaml:"enable"`
+	MaxAttempts        int           `yaml:"max_attempts"`  // number of delivery attempts including the first one
+	InitialDelay       time.Duration `yaml:"initial_delay"` // delay before the first retry, it is doubled on every next retry
+	MaxDelay           time.Duration `yaml:"max_delay"`
+	DeadLetterExchange string        `yaml:"dead_letter_exchange"`
+	DeadLetterQueue    string        `yaml:"dead_letter_queue"`
+}
+
+func (c *RetryConfig) Validate() error {
+	if !c.Enable {
+		return nil
+	}
+
+	if c.MaxAttempts <= 0 {
+		return fmt.Errorf("max attempts must be positive")
+	}
+
+	if c.InitialDelay <= 0 {
+		return fmt.Errorf("initial delay must be positive")
+	}
+
+	if c.MaxDelay < c.InitialDelay {
+		return fmt.Errorf("max delay must not be less than initial delay")
+	}
+
+	if c.DeadLetterExchange == "" || c.DeadLetterQueue == "" {
+		return fmt.Errorf("dead letter exchange and queue must be set")
+	}
+
+	return nil
+}
+
+type KafkaConfig struct {
+	Enable         bool     `yaml:"enable"`
+	Brokers        []string `yaml:"brokers" env:"KAFKA_BROKERS"`
+	Topic          string   `yaml:"topic"`           // record key is a recipient user id
+	Group          string   `yaml:"group"`           // consumer group of a node is <group>.<node id>
+	ConsumersCount int      `yaml:"consumers_count"` // number of group members per node
+
+	Retry KafkaRetryConfig `yaml:"retry"`
+}
+
+func (c *KafkaConfig) Validate() error {
+	if !c.Enable {
+		return nil
+	}
+
+	if len(c.Brokers) == 0 {
+		return fmt.Errorf("brokers must be set")
+	}
+
+	if c.Topic == "" || c.Group == "" {
+		return fmt.Errorf("topic and group must be set")
+	}
+
+	if c.ConsumersCount <= 0 {
+		return fmt.Errorf("consumers count must be positive")
+	}
+
+	if err := c.Retry.Validate(); err != nil {
+		return fmt.Errorf("retry: %w", err)
+	}
+
+	return nil
+}
+
+// KafkaRetryConfig is a policy of failed records, they are published to their topic again after backoff
+// and published to the dead-letter topic after max attempts
+type KafkaRetryConfig struct {
+	Enable          bool          `yaml:"enable"`
+	MaxAttempts     int           `yaml:"max_attempts"`  // number of delivery attempts including the first one
+	InitialDelay    time.Duration `yaml:"initial_delay"` // delay before the first retry, it is doubled on every next retry
+	MaxDelay        time.Duration `yaml:"max_delay"`
+	DeadLetterTopic string        `yaml:"dead_letter_topic"`
+}
+
+func (c *KafkaRetryConfig) Validate() error {
+	if !c.Enable {
+		return nil
+	}
+
+	if c.MaxAttempts <= 0 {
+		return fmt.Errorf("max attempts must be positive")
+	}
+
+	if c.InitialDelay <= 0 {
+		return fmt.Errorf("initial delay must be positive")
+	}
+
+	if c.MaxDelay < c.InitialDelay {
+		return fmt.Errorf("max delay must not be less than initial delay")
+	}
+
+	if c.DeadLetterTopic == "" {
+		return fmt.Errorf("dead letter topic must be set")
+	}
+
+	return nil
+}
+
+type NatsConfig struct {
+	Enable        bool   `yaml:"enable"`
+	Address       string `yaml:"address" env:"NATS_ADDRESS"` // ignored if embedded server is enabled
+	SubjectPrefix string `yaml:"subject_prefix"`             // notifications of a user are published to <prefix>.user.<id>
+
+	JetStream NatsJetStreamConfig `yaml:"jetstream"`
+	Embedded  NatsEmbeddedConfig  `yaml:"embedded"`
+	Retry     NatsRetryConfig     `yaml:"retry"`
+}
+
+func (c *NatsConfig) Validate() error {
+	if !c.Enable {
+		return nil
+	}
+
+	if c.Address == "" && !c.Embedded.Enable {
+		return fmt.Errorf("address must be set if embedded server is disabled")
+	}
+
+	if c.SubjectPrefix == "" {
+		return fmt.Errorf("subject prefix must be set")
+	}
+
+	if err := c.JetStream.Validate(); err != nil {
+		return fmt.Errorf("jetstream: %w", err)
+	}
+
+	if err := c.Retry.Validate(); err != nil {
+		return fmt.Errorf("retry: %w", err)
+	}
+
+	if c.Retry.Enable && strings.HasPrefix(c.Retry.DeadLetterSubject, c.SubjectPrefix+".user.") {
+		return fmt.Errorf("retry: dead letter subject must not be a user subject")
+	}
+
+	return nil
+}
+
+// NatsJetStreamConfig enables stream of user subjects, every node consumes it by durable consumers of its connected users,
+// so notifications are redelivered until the node acknowledges them and the node resumes the user on reconnect
+type NatsJetStreamConfig struct {
+	Enable            bool          `yaml:"enable"`
+	Stream            string        `yaml:"stream"`
+	MaxAge            time.Duration `yaml:"max_age"`            // oldest messages are discarded when a limit is reached, 0 is unlimited
+	MaxMsgs           int64         `yaml:"max_msgs"`           // 0 is unlimited
+	MaxBytes          int64         `yaml:"max_bytes"`          // 0 is unlimited
+	AckWait           time.Duration `yaml:"ack_wait"`           // time before unacknowledged message is delivered again
+	MaxDeliver        int           `yaml:"max_deliver"`        // -1 is unlimited
+	InactiveThreshold time.Duration `yaml:"inactive_threshold"` // consumer of a user who does not connect to the node is removed after it
+	DeadLetterStream  string        `yaml:"dead_letter_stream"` // stream of the dead-letter subject
+}
+
+func (c *NatsJetStreamConfig) Validate() error {
+	if !c.Enable {
+		return nil
+	}
+
+	if c.Stream == "" {
+		return fmt.Errorf("stream must be set")
+	}
+
+	if c.MaxAge < 0 || c.MaxMsgs < 0 || c.MaxBytes < 0 {
+		return fmt.Errorf("stream limits must not be negative")
+	}
+
+	if c.AckWait <= 0 {
+		return fmt.Errorf("ack wait must be positive")
+	}
+
+	if c.InactiveThreshold <= 0 {
+		return fmt.Errorf("inactive threshold must be positive")
+	}
+
+	return nil
+}
+
+// NatsEmbeddedConfig runs nats server in the process, it is used for edge deployments and local runs
+type NatsEmbeddedConfig struct {
+	Enable   bool   `yaml:"enable"`
+	Host     string `yaml:"host"`
+	Port     int    `yaml:"port"`      // -1 is a random port
+	StoreDir string `yaml:"store_dir"` // jetstream data directory
+}
+
+// NatsRetryConfig is a policy of failed messages, they are published to their subject again after backoff
+// and published to the dead-letter subject after max attempts
+type NatsRetryConfig struct {
+	Enable            bool          `yaml:"enable"`
+	MaxAttempts       int           `yaml:"max_attempts"`  // number of delivery attempts including the first one
+	InitialDelay      time.Duration `yaml:"initial_delay"` // delay before the first retry, it is doubled on every next retry
+	MaxDelay          time.Duration `yaml:"max_delay"`
+	DeadLetterSubject string        `yaml:"dead_letter_subject"`
+}
+
+func (c *NatsRetryConfig) Validate() error {
+	if !c.Enable {
+		return nil
+	}
+
+	if c.MaxAttempts <= 0 {
+		return fmt.Errorf("max attempts must be positive")
+	}
+
+	if c.InitialDelay <= 0 {
+		return fmt.Errorf("initial delay must be positive")
+	}
+
+	if c.MaxDelay < c.InitialDelay {
+		return fmt.Errorf("max delay must not be less than initial delay")
+	}
+
+	if c.DeadLetterSubject == "" {
+		return fmt.Errorf("dead letter subject must be set")
+	}
+
+	return nil
+}
+
+type RedisConfig struct {
+	Enable   bool       `yaml:"enable"`
+	Address  string     `yaml:"address" env:"REDIS_ADDRESS"` // ignored if embedded server is enabled
+	Password string     `yaml:"password" env:"REDIS_PASSWORD"`
+	DB       int        `yaml:"db"`
+	Mode     redis.Mode `yaml:"mode"` // pubsub or streams
+
+	// pub/sub mode
+	ChannelPrefix   string `yaml:"channel_prefix"`    // notifications of a user are published to <prefix>:user:<id>
+	PerUserChannels bool   `yaml:"per_user_channels"` // subscribe to channels of connected users only
+
+	// streams mode
+	Stream         string        `yaml:"stream"`
+	Group          string        `yaml:"group"` // consumer group of a node is <group>.<node id>
+	ConsumersCount int           `yaml:"consumers_count"`
+	BlockTimeout   time.Duration `yaml:"block_timeout"`
+	ClaimTimeout   time.Duration `yaml:"claim_timeout"` // idle time after which pending entry is claimed by another consumer
+
+	Embedded RedisEmbeddedConfig `yaml:"embedded"`
+	Retry    RedisRetryConfig    `yaml:"retry"`
+}
+
+func (c *RedisConfig) Validate() error {
+	if !c.Enable {
+		return nil
+	}
+
+	if c.Address == "" && !c.Embedded.Enable {
+		return fmt.Errorf("address must be set if embedded server is disabled")
+	}
+
+	if err := c.Mode.Validate(); err != nil {
+		return fmt.Errorf("mode: %w", err)
+	}
+
+	switch c.Mode {
+	case redis.PubSubMode:
+		if c.ChannelPrefix == "" {
+			return fmt.Errorf("channel prefix must be set")
+		}
+	case redis.StreamsMode:
+		if c.Stream == "" || c.Group == "" {
+			return fmt.Errorf("stream and group must be set")
+		}
+
+		if c.ConsumersCount <= 0 {
+			return fmt.Errorf("consumers count must be positive")
+		}
+
+		if c.BlockTimeout <= 0 || c.ClaimTimeout <= 0 {
+			return fmt.Errorf("block and claim timeouts must be positive")
+		}
+	}
+
+	if err := c.Retry.Validate(); err != nil {
+		return fmt.Errorf("retry: %w", err)
+	}
+
+	return nil
+}
+
+// RedisEmbeddedConfig runs redis-compatible in-memory server in the process, it is used for local runs
+type RedisEmbeddedConfig struct {
+	Enable  bool   `yaml:"enable"`
+	Address string `yaml:"address"` // random port is used if empty
+}
+
+// RedisRetryConfig is a policy of failed entries, they are added to the stream again after backoff
+// and added to the dead-letter stream after max attempts
+type RedisRetryConfig struct {
+	Enable           bool          `yaml:"enable"`
+	MaxAttempts      int           `yaml:"max_attempts"`  // number of delivery attempts including the first one
+	InitialDelay     time.Duration `yaml:"initial_delay"` // delay before the first retry, it is doubled on every next retry
+	MaxDelay         time.Duration `yaml:"max_delay"`
+	DeadLetterStream string        `yaml:"dead_letter_stream"`
+}
+
+func (c *RedisRetryConfig) Validate() error {
+	if !c.Enable {
+		return nil
+	}
+
+	if c.MaxAttempts <= 0 {
+		return fmt.Errorf("max attempts must be positive")
+	}
+
+	if c.InitialDelay <= 0 {
+		return fmt.Errorf("initial delay must be positive")
+	}
+
+	if c.MaxDelay < c.InitialDelay {
+		return fmt.Errorf("max delay must not be less than initial delay")
+	}
+
+	if c.DeadLetterStream == "" {
+		return fmt.Errorf("dead letter stream must be set")
+	}
+
+	return nil
 }
 
 type AuthClientConfig struct {
@@ -58,3 +574,306 @@ func (c *AuthClientConfig) Validate() error {
 
 	return nil // todo
 }
+
+type HeartbeatConfig struct {
+	Enable       bool          `yaml:"enable"`
+	PingInterval time.Duration `yaml:"ping_interval"`
+	PongTimeout  time.Duration `yaml:"pong_timeout"` // time to wait for client frame after ping before connection is reaped
+}
+
+func (c *HeartbeatConfig) Validate() error {
+	if !c.Enable {
+		return nil
+	}
+
+	if c.PingInterval <= 0 {
+		return fmt.Errorf("ping interval must be positive")
+	}
+
+	if c.PongTimeout <= 0 {
+		return fmt.Errorf("pong timeout must be positive")
+	}
+
+	return nil
+}
+
+type ConnectionConfig struct {
+	SendQueueSize      int                                 `yaml:"send_queue_size"`
+	SlowConsumerPolicy connections_pool.SlowConsumerPolicy `yaml:"slow_consumer_policy"` // drop_oldest, drop_newest or disconnect
+	WriteTimeout       time.Duration                       `yaml:"write_timeout"`
+}
+
+func (c *ConnectionConfig) Validate() error {
+	if c.SendQueueSize <= 0 {
+		return fmt.Errorf("send queue size must be positive")
+	}
+
+	if err := c.SlowConsumerPolicy.Validate(); err != nil {
+		return fmt.Errorf("slow consumer policy: %w", err)
+	}
+
+	return nil
+}
+
+type HistoryConfig struct {
+	Size          int           `yaml:"size"`           // number of recent events kept per user for replay, zero disables history
+	TTL           time.Duration `yaml:"ttl"`            // history of the user is evicted when no event is added to it for this time
+	PurgeInterval time.Duration `yaml:"purge_interval"` // interval of evicting idle histories
+	Path          string        `yaml:"path"`           // path of bolt database to keep history on disk, history is kept in memory if empty
+}
+
+func (c *HistoryConfig) Validate() error {
+	if c.Size < 0 {
+		return fmt.Errorf("size must not be negative")
+	}
+
+	if c.TTL <= 0 {
+		return fmt.Errorf("ttl must be positive")
+	}
+
+	if c.PurgeInterval <= 0 {
+		return fmt.Errorf("purge interval must be positive")
+	}
+
+	return nil
+}
+
+type LongPollConfig struct {
+	BufferSize  int           `yaml:"buffer_size"`  // number of events buffered between polls per session
+	IdleTimeout time.Duration `yaml:"idle_timeout"` // session without polls is closed after this timeout
+	MaxTimeout  time.Duration `yaml:"max_timeout"`  // upper bound of a single poll duration
+}
+
+func (c *LongPollConfig) Validate() error {
+	if c.BufferSize <= 0 {
+		return fmt.Errorf("buffer size must be positive")
+	}
+
+	if c.MaxTimeout <= 0 {
+		return fmt.Errorf("max timeout must be positive")
+	}
+
+	if c.IdleTimeout <= c.MaxTimeout {
+		return fmt.Errorf("idle timeout must be greater than max timeout")
+	}
+
+	return nil
+}
+
+type AckConfig struct {
+	Enable            bool          `yaml:"enable"`             // broker message is acked only after delivery is acknowledged
+	RedeliveryTimeout time.Duration `yaml:"redelivery_timeout"` // unacknowledged event is redelivered after this timeout
+	MaxRedeliveries   int           `yaml:"max_redeliveries"`   // unacknowledged event is discarded after this number of redeliveries
+}
+
+func (c *AckConfig) Validate() error {
+	if !c.Enable {
+		return nil
+	}
+
+	if c.RedeliveryTimeout <= 0 {
+		return fmt.Errorf("redelivery timeout must be positive")
+	}
+
+	if c.MaxRedeliveries < 0 {
+		return fmt.Errorf("max redeliveries must not be negative")
+	}
+
+	return nil
+}
+
+type InboxConfig struct {
+	Enable        bool          `yaml:"enable"`
+	Backend       inbox.Backend `yaml:"backend"`        // memory, bolt or postgres
+	TTL           time.Duration `yaml:"ttl"`            // undelivered notification is removed from inbox after this time
+	PurgeInterval time.Duration `yaml:"purge_interval"` // interval of removing expired notifications
+	Path          string        `yaml:"path"`           // path of bolt database
+	DSN           string        `yaml:"dsn" env:"INBOX_DSN"`
+}
+
+func (c *InboxConfig) Validate() error {
+	if !c.Enable {
+		return nil
+	}
+
+	if err := c.Backend.Validate(); err != nil {
+		return fmt.Errorf("backend: %w", err)
+	}
+
+	if c.TTL <= 0 {
+		return fmt.Errorf("ttl must be positive")
+	}
+
+	if c.PurgeInterval <= 0 {
+		return fmt.Errorf("purge interval must be positive")
+	}
+
+	if c.Backend == inbox.BoltBackend && c.Path == "" {
+		return fmt.Errorf("path must be set for bolt backend")
+	}
+
+	if c.Backend == inbox.PostgresBackend && c.DSN == "" {
+		return fmt.Errorf("dsn must be set for postgres backend")
+	}
+
+	return nil
+}
+
+type AdminAPIConfig struct {
+	// bearer tokens of operators allowed to use admin endpoints, every request is rejected if none is set
+	Tokens []string `yaml:"tokens" env:"ADMIN_API_TOKENS"`
+}
+
+func (c *AdminAPIConfig) Validate() error {
+	for _, token := range c.Tokens {
+		if token == "" {
+			return fmt.Errorf("token must not be empty")
+		}
+	}
+
+	return nil
+}
+
+type PublishAPIConfig struct {
+	Enable bool     `yaml:"enable"`                          // publish endpoints are served on the admin server
+	Tokens []string `yaml:"tokens" env:"PUBLISH_API_TOKENS"` // bearer tokens of internal services allowed to publish
+}
+
+func (c *PublishAPIConfig) Validate() error {
+	if !c.Enable {
+		return nil
+	}
+
+	if len(c.Tokens) == 0 {
+		return fmt.Errorf("tokens must be set")
+	}
+
+	for _, token := range c.Tokens {
+		if token == "" {
+			return fmt.Errorf("token must not be empty")
+		}
+	}
+
+	return nil
+}
+
+type InternalAPIConfig struct {
+	Enable bool     `yaml:"enable"`                           // grpc api is served on the internal grpc server
+	Tokens []string `yaml:"tokens" env:"INTERNAL_API_TOKENS"` // bearer tokens of internal services allowed to call the api
+}
+
+func (c *InternalAPIConfig) Validate() error {
+	if !c.Enable {
+		return nil
+	}
+
+	if len(c.Tokens) == 0 {
+		return fmt.Errorf("tokens must be set")
+	}
+
+	for _, token := range c.Tokens {
+		if token == "" {
+			return fmt.Errorf("token must not be empty")
+		}
+	}
+
+	return nil
+}
+
+type PresenceConfig struct {
+	Events   PresenceEventsConfig   `yaml:"events"`
+	Registry PresenceRegistryConfig `yaml:"registry"`
+}
+
+func (c *PresenceConfig) Validate() error {
+	if err := c.Events.Validate(); err != nil {
+		return fmt.Errorf("events: %w", err)
+	}
+
+	if err := c.Registry.Validate(); err != nil {
+		return fmt.Errorf("registry: %w", err)
+	}
+
+	return nil
+}
+
+type PresenceEventsConfig struct {
+	Enable     bool   `yaml:"enable"`      // online and offline events are published to the broker
+	Topic      string `yaml:"topic"`       // exchange, topic, subject or stream of the events, user id is the key
+	BufferSize int    `yaml:"buffer_size"` // events are dropped if this number of them waits for publishing
+}
+
+func (c *PresenceEventsConfig) Validate() error {
+	if !c.Enable {
+		return nil
+	}
+
+	if c.Topic == "" {
+		return fmt.Errorf("topic must be set")
+	}
+
+	if c.BufferSize <= 0 {
+		return fmt.Errorf("buffer size must be positive")
+	}
+
+	return nil
+}
+
+type PresenceRegistryConfig struct {
+	Enable            bool             `yaml:"enable"`             // users of the node are registered in the store shared by all nodes
+	Backend           registry.Backend `yaml:"backend"`            // memory or redis, memory registry is not shared and fits a single node
+	TTL               time.Duration    `yaml:"ttl"`                // entries of the node expire if it stops heartbeating
+	HeartbeatInterval time.Duration    `yaml:"heartbeat_interval"` // users of the node are registered again every interval
+	BufferSize        int              `yaml:"buffer_size"`        // presence changes are dropped if this number of them waits for the store
+
+	Redis PresenceRegistryRedisConfig `yaml:"redis"`
+}
+
+func (c *PresenceRegistryConfig) Validate() error {
+	if !c.Enable {
+		return nil
+	}
+
+	if err := c.Backend.Validate(); err != nil {
+		return fmt.Errorf("backend: %w", err)
+	}
+
+	if c.TTL <= 0 {
+		return fmt.Errorf("ttl must be positive")
+	}
+
+	if c.HeartbeatInterval <= 0 || c.HeartbeatInterval >= c.TTL {
+		return fmt.Errorf("heartbeat interval must be positive and less than ttl")
+	}
+
+	if c.BufferSize <= 0 {
+		return fmt.Errorf("buffer size must be positive")
+	}
+
+	if c.Backend == registry.RedisBackend {
+		if err := c.Redis.Validate(); err != nil {
+			return fmt.Errorf("redis: %w", err)
+		}
+	}
+
+	return nil
+}
+
+type PresenceRegistryRedisConfig struct {
+	Address   string `yaml:"address" env:"REGISTRY_REDIS_ADDRESS"`
+	Password  string `yaml:"password" env:"REGISTRY_REDIS_PASSWORD"`
+	DB        int    `yaml:"db"`
+	KeyPrefix string `yaml:"key_prefix"` // nodes of a user are kept in <prefix>:user:<id>
+}
+
+func (c *PresenceRegistryRedisConfig) Validate() error {
+	if c.Address == "" {
+		return fmt.Errorf("address must be set")
+	}
+
+	if c.KeyPrefix == "" {
+		return fmt.Errorf("key prefix must be set")
+	}
+
+	return nil
+}
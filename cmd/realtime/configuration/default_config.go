@@ -1,15 +1,26 @@
 package configuration
 
 import (
+	"os"
 	"time"
 
+	amqp "github.com/rabbitmq/amqp091-go"
 	xclients "github.com/syth0le/gopnik/clients"
 	xlogger "github.com/syth0le/gopnik/logger"
 	xservers "github.com/syth0le/gopnik/servers"
+
+	"github.com/syth0le/realtime-notification-service/internal/clients/broker"
+	"github.com/syth0le/realtime-notification-service/internal/clients/redis"
+	"github.com/syth0le/realtime-notification-service/internal/infrastructure_services/connections_pool"
+	"github.com/syth0le/realtime-notification-service/internal/infrastructure_services/inbox"
+	"github.com/syth0le/realtime-notification-service/internal/infrastructure_services/registry"
 )
 
 const (
-	defaultAppName = "realtime-notification"
+	defaultAppName    = "realtime-notification"
+	defaultRoutingKey = "#"
+
+	defaultSubjectPrefix = "notifications"
 )
 
 func NewDefaultConfig() *Config {
@@ -24,6 +35,7 @@ func NewDefaultConfig() *Config {
 			GracefulShutdownTimeout: 15 * time.Second,
 			ForceShutdownTimeout:    20 * time.Second,
 			App:                     defaultAppName,
+			NodeID:                  defaultNodeID(),
 		},
 		PublicServer: xservers.ServerConfig{
 			Enable:   false,
@@ -35,11 +47,113 @@ func NewDefaultConfig() *Config {
 			Endpoint: "",
 			Port:     0,
 		},
+		InternalGRPCServer: xservers.GRPCServerConfig{
+			Port:             0,
+			EnableRecover:    false,
+			EnableReflection: false,
+		},
+		Broker: BrokerConfig{
+			Kind: broker.RabbitMQKind,
+		},
 		Queue: RabbitConfig{
-			Enable:       false,
-			Address:      "",
-			QueueName:    "",
-			ExchangeName: "",
+			Enable:          false,
+			Address:         "",
+			QueueName:       "",
+			ExchangeName:    "",
+			RoutingKey:      defaultRoutingKey,
+			ConsumersCount:  1,
+			PerNodeQueue:    true,
+			OfflineQueue:    "",
+			Prefetch:        10,
+			Concurrency:     1,
+			ExchangeKind:    amqp.ExchangeTopic,
+			ExchangeDurable: false,
+			Durable:         false,
+			AutoDelete:      false,
+			QueueArgs:       nil,
+			Pool: RabbitPoolConfig{
+				Size:                2,
+				ChannelMax:          512,
+				HealthCheckInterval: 10 * time.Second,
+				InitialBackoff:      time.Second,
+				MaxBackoff:          30 * time.Second,
+			},
+			Retry: RetryConfig{
+				Enable:             false,
+				MaxAttempts:        5,
+				InitialDelay:       time.Second,
+				MaxDelay:           time.Minute,
+				DeadLetterExchange: "",
+				DeadLetterQueue:    "",
+			},
+		},
+		Kafka: KafkaConfig{
+			Enable:         false,
+			Brokers:        nil,
+			Topic:          "",
+			Group:          "",
+			ConsumersCount: 1,
+			Retry: KafkaRetryConfig{
+				Enable:          false,
+				MaxAttempts:     5,
+				InitialDelay:    time.Second,
+				MaxDelay:        time.Minute,
+				DeadLetterTopic: "",
+			},
+		},
+		Nats: NatsConfig{
+			Enable:        false,
+			Address:       "",
+			SubjectPrefix: defaultSubjectPrefix,
+			JetStream: NatsJetStreamConfig{
+				Enable:            false,
+				Stream:            "",
+				MaxAge:            7 * 24 * time.Hour,
+				MaxMsgs:           0,
+				MaxBytes:          0,
+				AckWait:           30 * time.Second,
+				MaxDeliver:        -1,
+				InactiveThreshold: 7 * 24 * time.Hour,
+				DeadLetterStream:  "",
+			},
+			Embedded: NatsEmbeddedConfig{
+				Enable:   false,
+				Host:     "127.0.0.1",
+				Port:     4222,
+				StoreDir: "",
+			},
+			Retry: NatsRetryConfig{
+				Enable:            false,
+				MaxAttempts:       5,
+				InitialDelay:      time.Second,
+				MaxDelay:          time.Minute,
+				DeadLetterSubject: "",
+			},
+		},
+		Redis: RedisConfig{
+			Enable:          false,
+			Address:         "",
+			Password:        "",
+			DB:              0,
+			Mode:            redis.StreamsMode,
+			ChannelPrefix:   defaultSubjectPrefix,
+			PerUserChannels: false,
+			Stream:          "",
+			Group:           "",
+			ConsumersCount:  1,
+			BlockTimeout:    5 * time.Second,
+			ClaimTimeout:    time.Minute,
+			Embedded: RedisEmbeddedConfig{
+				Enable:  false,
+				Address: "",
+			},
+			Retry: RedisRetryConfig{
+				Enable:           false,
+				MaxAttempts:      5,
+				InitialDelay:     time.Second,
+				MaxDelay:         time.Minute,
+				DeadLetterStream: "",
+			},
 		},
 		AuthClient: AuthClientConfig{
 			Enable: false,
@@ -52,5 +166,75 @@ func NewDefaultConfig() *Config {
 				EnableCompressor:      false,
 			},
 		},
+		Heartbeat: HeartbeatConfig{
+			Enable:       true,
+			PingInterval: 30 * time.Second,
+			PongTimeout:  10 * time.Second,
+		},
+		Connection: ConnectionConfig{
+			SendQueueSize:      64,
+			SlowConsumerPolicy: connections_pool.DropOldestPolicy,
+			WriteTimeout:       10 * time.Second,
+		},
+		History: HistoryConfig{
+			Size:          100,
+			TTL:           24 * time.Hour,
+			PurgeInterval: time.Minute,
+			Path:          "",
+		},
+		LongPoll: LongPollConfig{
+			BufferSize:  100,
+			IdleTimeout: time.Minute,
+			MaxTimeout:  30 * time.Second,
+		},
+		Ack: AckConfig{
+			Enable:            false,
+			RedeliveryTimeout: 30 * time.Second,
+			MaxRedeliveries:   5,
+		},
+		Inbox: InboxConfig{
+			Enable:        false,
+			Backend:       inbox.MemoryBackend,
+			TTL:           7 * 24 * time.Hour,
+			PurgeInterval: time.Minute,
+			Path:          "",
+			DSN:           "",
+		},
+		AdminAPI: AdminAPIConfig{
+			Tokens: nil,
+		},
+		PublishAPI: PublishAPIConfig{
+			Enable: false,
+			Tokens: nil,
+		},
+		InternalAPI: InternalAPIConfig{
+			Enable: false,
+			Tokens: nil,
+		},
+		Presence: PresenceConfig{
+			Events: PresenceEventsConfig{
+				Enable:     false,
+				Topic:      "presence",
+				BufferSize: 1024,
+			},
+			Registry: PresenceRegistryConfig{
+				Enable:            false,
+				Backend:           registry.MemoryBackend,
+				TTL:               30 * time.Second,
+				HeartbeatInterval: 10 * time.Second,
+				BufferSize:        1024,
+				Redis: PresenceRegistryRedisConfig{
+					KeyPrefix: "presence",
+				},
+			},
+		},
+	}
+}
+
+func defaultNodeID() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return defaultAppName
 	}
+	return hostname
 }
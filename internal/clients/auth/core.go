@@ -20,6 +20,8 @@ const UserIDValue = "userID"
 
 type Client interface {
 	AuthenticationInterceptor(next http.Handler) http.Handler
+	// ValidateToken returns user of the token, it is used by transports without http headers
+	ValidateToken(ctx context.Context, token string) (model.UserID, error)
 }
 
 type ClientImpl struct {
@@ -38,17 +40,26 @@ func (c *ClientImpl) AuthenticationInterceptor(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		authToken := r.Header.Get(authHeader)
 
-		resp, err := c.client.ValidateToken(r.Context(), &inpb.ValidateTokenRequest{Token: authToken})
+		userID, err := c.ValidateToken(r.Context(), authToken)
 		if err != nil {
-			c.writeError(w, xerrors.WrapForbiddenError(fmt.Errorf("validate token: %w", err), "token validation failed"))
+			c.writeError(w, err)
 			return
 		}
 
-		ctx := context.WithValue(r.Context(), UserIDValue, model.UserID(resp.UserId))
+		ctx := context.WithValue(r.Context(), UserIDValue, userID)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
+func (c *ClientImpl) ValidateToken(ctx context.Context, token string) (model.UserID, error) {
+	resp, err := c.client.ValidateToken(ctx, &inpb.ValidateTokenRequest{Token: token})
+	if err != nil {
+		return "", xerrors.WrapForbiddenError(fmt.Errorf("validate token: %w", err), "token validation failed")
+	}
+
+	return model.UserID(resp.UserId), nil
+}
+
 func (c *ClientImpl) writeError(w http.ResponseWriter, err error) {
 	c.logger.Sugar().Warnf("http response error: %v", err)
 
@@ -1,9 +1,14 @@
 package auth
 
 import (
+	"context"
+	"fmt"
 	"net/http"
 
+	xerrors "github.com/syth0le/gopnik/errors"
 	"go.uber.org/zap"
+
+	"github.com/syth0le/realtime-notification-service/internal/model"
 )
 
 type ClientMock struct {
@@ -20,3 +25,8 @@ func (m *ClientMock) AuthenticationInterceptor(next http.Handler) http.Handler {
 	m.logger.Debug("authenticated through mock service")
 	return next
 }
+
+// ValidateToken rejects every token, mock does not know users of the tokens
+func (m *ClientMock) ValidateToken(ctx context.Context, token string) (model.UserID, error) {
+	return "", xerrors.WrapForbiddenError(fmt.Errorf("auth client is disabled"), "token validation failed")
+}
@@ -0,0 +1,174 @@
+// Package brokertest provides helpers to run subscribers of broker clients in tests
+package brokertest
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/syth0le/realtime-notification-service/internal/clients/broker"
+)
+
+const (
+	DefaultWait  = 5 * time.Second
+	DefaultQuiet = 300 * time.Millisecond
+)
+
+// Subscription runs subscribers and passes messages consumed by any of them to the test.
+// Subscribers are closed when the test finishes unless the subscription is closed before
+type Subscription struct {
+	Messages chan *broker.Message
+
+	wait  time.Duration // time the next message is waited for
+	quiet time.Duration // time no message is expected for
+
+	stops []func()
+	mutex sync.Mutex
+}
+
+func NewSubscription(t *testing.T, wait time.Duration, quiet time.Duration) *Subscription {
+	t.Helper()
+
+	s := &Subscription{
+		Messages: make(chan *broker.Message, 16),
+		wait:     wait,
+		quiet:    quiet,
+		mutex:    sync.Mutex{},
+	}
+	t.Cleanup(s.Close)
+	return s
+}
+
+// RunSubscriber runs the subscriber in a new subscription with default timeouts
+func RunSubscriber(t *testing.T, subscriber broker.Subscriber) *Subscription {
+	t.Helper()
+
+	s := NewSubscription(t, DefaultWait, DefaultQuiet)
+	s.Run(subscriber)
+	return s
+}
+
+// Run runs one more subscriber of the subscription
+func (s *Subscription) Run(subscriber broker.Subscriber) {
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		subscriber.Run(func(msg *broker.Message) {
+			s.Messages <- msg
+		})
+	}()
+
+	once := sync.Once{}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.stops = append(s.stops, func() {
+		once.Do(func() {
+			subscriber.Close()
+			<-stopped
+		})
+	})
+}
+
+// Close closes subscribers and waits until they stop
+func (s *Subscription) Close() {
+	s.mutex.Lock()
+	stops := s.stops
+	s.mutex.Unlock()
+
+	for _, stop := range stops {
+		stop()
+	}
+}
+
+// Next returns the next consumed message, test fails if nothing is consumed within wait time
+func (s *Subscription) Next(t *testing.T) *broker.Message {
+	t.Helper()
+
+	select {
+	case msg := <-s.Messages:
+		return msg
+	case <-time.After(s.wait):
+		t.Fatalf("no message is consumed")
+		return nil
+	}
+}
+
+// None fails the test if a message is consumed within quiet time
+func (s *Subscription) None(t *testing.T) {
+	t.Helper()
+
+	s.NoneFor(t, s.quiet)
+}
+
+func (s *Subscription) NoneFor(t *testing.T, quiet time.Duration) {
+	t.Helper()
+
+	select {
+	case msg := <-s.Messages:
+		t.Fatalf("unexpected message %s of %s", msg.ID, msg.Key)
+	case <-time.After(quiet):
+	}
+}
+
+// Expect returns the next message and fails the test unless it is published by Publish with the id and the key.
+// Empty id matches messages of brokers which do not keep message ids
+func (s *Subscription) Expect(t *testing.T, id string, key string) *broker.Message {
+	t.Helper()
+
+	msg := s.Next(t)
+	if (id != "" && msg.ID != id) || msg.Key != key || string(msg.Body) != string(Body(id, key)) {
+		t.Fatalf("unexpected message %s of %s, expected %s of %s", msg.ID, msg.Key, id, key)
+	}
+	return msg
+}
+
+// Body returns body of the message published by Publish
+func Body(id string, key string) []byte {
+	return []byte(id + " of " + key)
+}
+
+// Publish publishes message with the id to the topic with the key
+func Publish(t *testing.T, publisher broker.Publisher, topic string, id string, key string) {
+	t.Helper()
+
+	PublishBody(t, publisher, topic, id, key, Body(id, key))
+}
+
+// PublishBody publishes message with the id and the body to the topic with the key
+func PublishBody(t *testing.T, publisher broker.Publisher, topic string, id string, key string, body []byte) {
+	t.Helper()
+
+	msg := broker.NewMessage(nil)
+	msg.ID = id
+	msg.Topic = topic
+	msg.Key = key
+	msg.Body = body
+
+	err := publisher.Publish(context.Background(), msg)
+	if err != nil {
+		t.Fatalf("publish %s: %v", id, err)
+	}
+}
+
+// Bind binds keys to the node of the binder
+func Bind(t *testing.T, binder broker.Binder, keys ...string) {
+	t.Helper()
+
+	for _, key := range keys {
+		err := binder.Bind(key)
+		if err != nil {
+			t.Fatalf("bind %s: %v", key, err)
+		}
+	}
+}
+
+// Settle fails the test if the message cannot be settled
+func Settle(t *testing.T, fn func() error) {
+	t.Helper()
+
+	err := fn()
+	if err != nil {
+		t.Fatalf("settle: %v", err)
+	}
+}
@@ -0,0 +1,168 @@
+package broker
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+type Kind string
+
+const (
+	RabbitMQKind Kind = "rabbitmq"
+	MemoryKind   Kind = "memory"
+	KafkaKind    Kind = "kafka"
+	NatsKind     Kind = "nats"
+	RedisKind    Kind = "redis"
+)
+
+func (k Kind) Validate() error {
+	switch k {
+	case RabbitMQKind, MemoryKind, KafkaKind, NatsKind, RedisKind:
+		return nil
+	default:
+		return fmt.Errorf("unexpected broker kind: %s", k)
+	}
+}
+
+const (
+	AttemptsHeader         = "x-attempts"
+	DeadLetterReasonHeader = "x-dead-letter-reason"
+	OriginalTopicHeader    = "x-original-exchange"
+	OriginalKeyHeader      = "x-original-routing-key"
+)
+
+// Settler settles a message in the broker it was received from
+type Settler interface {
+	Ack() error
+	Nack() error
+	Requeue() error
+}
+
+// Message is a broker neutral delivery, it must be settled exactly once by Ack, Nack or Requeue
+type Message struct {
+	ID          string
+	Topic       string // exchange, topic or subject the message was published to
+	Key         string // routing key, delivery key is a recipient user id
+	ContentType string
+	Headers     map[string]any
+	Timestamp   time.Time
+	Body        []byte
+
+	settler Settler
+	once    sync.Once
+}
+
+func NewMessage(settler Settler) *Message {
+	return &Message{
+		settler: settler,
+	}
+}
+
+// Ack confirms that message is processed
+func (m *Message) Ack() error {
+	return m.settle(m.settler.Ack)
+}
+
+// Nack rejects message, it is not delivered again
+func (m *Message) Nack() error {
+	return m.settle(m.settler.Nack)
+}
+
+// Requeue returns message to the broker to be delivered again
+func (m *Message) Requeue() error {
+	return m.settle(m.settler.Requeue)
+}
+
+// Attempts returns number of previous delivery attempts written by Retrier
+func (m *Message) Attempts() int {
+	switch attempts := m.Headers[AttemptsHeader].(type) {
+	case int:
+		return attempts
+	case int32:
+		return int(attempts)
+	case int64:
+		return int(attempts)
+	default:
+		return 0
+	}
+}
+
+// Clone returns unsettled copy of the message with copied headers
+func (m *Message) Clone(settler Settler) *Message {
+	headers := make(map[string]any, len(m.Headers))
+	for key, value := range m.Headers {
+		headers[key] = value
+	}
+
+	return &Message{
+		ID:          m.ID,
+		Topic:       m.Topic,
+		Key:         m.Key,
+		ContentType: m.ContentType,
+		Headers:     headers,
+		Timestamp:   m.Timestamp,
+		Body:        m.Body,
+		settler:     settler,
+	}
+}
+
+func (m *Message) settle(fn func() error) error {
+	err := fmt.Errorf("message %s is already settled", m.ID)
+	m.once.Do(func() {
+		err = fn()
+	})
+	return err
+}
+
+// Handler processes consumed message, handler settles the message
+type Handler func(msg *Message)
+
+// Subscriber consumes messages of a queue and passes them to the handler
+type Subscriber interface {
+	// Run blocks until subscriber is closed
+	Run(handler Handler) error
+	Close() error
+}
+
+// Publisher publishes message to its topic with its key
+type Publisher interface {
+	Publish(ctx context.Context, msg *Message) error
+	Close() error
+}
+
+// Binder manages routing keys bound to the queue of the node at runtime
+type Binder interface {
+	Bind(key string) error
+	Unbind(key string) error
+	Close() error
+}
+
+// Retrier handles failed messages, message is acked by the caller after it is handed over
+type Retrier interface {
+	// Retry delivers message again later, message which exhausted attempts is dead-lettered
+	Retry(msg *Message, reason string) error
+	DeadLetter(msg *Message, reason string) error
+	Close() error
+}
+
+// DeadLetter is a message which could not be delivered, it is kept until replayed
+type DeadLetter struct {
+	MessageID string
+	Topic     string
+	Key       string
+	Reason    string
+	Attempts  int
+	Timestamp time.Time
+	Headers   map[string]any
+	Body      []byte
+}
+
+// DeadLetters gives access to dead-lettered messages
+type DeadLetters interface {
+	ListDeadLetters(limit int) ([]*DeadLetter, error)
+	GetDeadLetter(messageID string) (*DeadLetter, error)
+	// ReplayDeadLetter publishes dead letter to its original topic and removes it
+	ReplayDeadLetter(messageID string) error
+}
@@ -0,0 +1,416 @@
+package broker
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	xerrors "github.com/syth0le/gopnik/errors"
+	"go.uber.org/zap"
+)
+
+type memoryBinding struct {
+	topic   string
+	pattern string
+}
+
+type memoryQueue struct {
+	name     string
+	bindings map[memoryBinding]struct{}
+	messages []*Message
+	notify   chan struct{}
+}
+
+// MemoryBroker is an in-process broker with topic routing of rabbitmq, queues are shared by competing subscribers.
+// It keeps everything in memory and is used in tests and single binary mode
+type MemoryBroker struct {
+	logger *zap.Logger
+
+	maxAttempts  int
+	initialDelay time.Duration
+	maxDelay     time.Duration
+
+	queues      map[string]*memoryQueue
+	alternates  map[string]string // queue of the topic messages no queue is bound to
+	deadLetters []*DeadLetter
+	timers      map[*time.Timer]struct{}
+	closed      bool
+
+	mutex sync.Mutex
+	done  chan struct{}
+}
+
+// NewMemoryBroker creates broker, failed messages are retried with backoff until max attempts and dead-lettered then
+func NewMemoryBroker(logger *zap.Logger, maxAttempts int, initialDelay time.Duration, maxDelay time.Duration) *MemoryBroker {
+	return &MemoryBroker{
+		logger:       logger,
+		maxAttempts:  maxAttempts,
+		initialDelay: initialDelay,
+		maxDelay:     maxDelay,
+		queues:       make(map[string]*memoryQueue),
+		alternates:   make(map[string]string),
+		timers:       make(map[*time.Timer]struct{}),
+		mutex:        sync.Mutex{},
+		done:         make(chan struct{}),
+	}
+}
+
+// DeclareQueue creates queue if it does not exist and binds it to the topic with the patterns.
+// Pattern is a routing key where * matches a word and # matches zero or more words
+func (b *MemoryBroker) DeclareQueue(name string, topic string, patterns ...string) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	queue := b.queue(name)
+	for _, pattern := range patterns {
+		queue.bindings[memoryBinding{topic: topic, pattern: pattern}] = struct{}{}
+	}
+}
+
+// DeclareAlternateQueue creates queue which gets messages of the topic not routed to any other queue,
+// as queue bound to the alternate exchange of rabbitmq does
+func (b *MemoryBroker) DeclareAlternateQueue(name string, topic string) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.queue(name)
+	b.alternates[topic] = name
+}
+
+func (b *MemoryBroker) Publish(ctx context.Context, msg *Message) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.closed {
+		return fmt.Errorf("broker is closed")
+	}
+
+	routed := false
+	for _, queue := range b.queues {
+		for binding := range queue.bindings {
+			if binding.topic == msg.Topic && matchKey(binding.pattern, msg.Key) {
+				b.push(queue, msg, false)
+				routed = true
+				break
+			}
+		}
+	}
+
+	if alternate, ok := b.alternates[msg.Topic]; ok && !routed {
+		b.push(b.queue(alternate), msg, false)
+	}
+	return nil
+}
+
+func (b *MemoryBroker) NewSubscriber(queueName string) Subscriber {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	return &memorySubscriber{
+		broker: b,
+		queue:  b.queue(queueName),
+		done:   make(chan struct{}),
+	}
+}
+
+func (b *MemoryBroker) NewBinder(queueName string, topic string) Binder {
+	return &memoryBinder{
+		broker:    b,
+		queueName: queueName,
+		topic:     topic,
+	}
+}
+
+func (b *MemoryBroker) Retry(msg *Message, reason string) error {
+	attempts := msg.Attempts() + 1
+	if attempts >= b.maxAttempts {
+		return b.DeadLetter(msg, reason)
+	}
+
+	retried := msg.Clone(nil)
+	retried.Headers[AttemptsHeader] = attempts
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	var timer *time.Timer
+	timer = time.AfterFunc(Backoff(b.initialDelay, b.maxDelay, attempts), func() {
+		b.mutex.Lock()
+		delete(b.timers, timer)
+		b.mutex.Unlock()
+
+		err := b.Publish(context.Background(), retried)
+		if err != nil {
+			b.logger.Sugar().Warnf("retry %s: %v", retried.ID, err)
+		}
+	})
+	b.timers[timer] = struct{}{}
+
+	b.logger.Sugar().Debugf("retry %s attempt %d: %s", msg.ID, attempts, reason)
+	return nil
+}
+
+func (b *MemoryBroker) DeadLetter(msg *Message, reason string) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.deadLetters = append(b.deadLetters, &DeadLetter{
+		MessageID: msg.ID,
+		Topic:     msg.Topic,
+		Key:       msg.Key,
+		Reason:    reason,
+		Attempts:  msg.Attempts() + 1,
+		Timestamp: msg.Timestamp,
+		Headers:   msg.Clone(nil).Headers,
+		Body:      msg.Body,
+	})
+
+	b.logger.Sugar().Warnf("dead-lettered %s: %s", msg.ID, reason)
+	return nil
+}
+
+func (b *MemoryBroker) ListDeadLetters(limit int) ([]*DeadLetter, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if limit > len(b.deadLetters) {
+		limit = len(b.deadLetters)
+	}
+
+	res := make([]*DeadLetter, limit)
+	copy(res, b.deadLetters)
+	return res, nil
+}
+
+func (b *MemoryBroker) GetDeadLetter(messageID string) (*DeadLetter, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	for _, letter := range b.deadLetters {
+		if letter.MessageID == messageID {
+			return letter, nil
+		}
+	}
+
+	return nil, xerrors.WrapNotFoundError(fmt.Errorf("not found dead letter %s", messageID), "not found dead letter")
+}
+
+func (b *MemoryBroker) ReplayDeadLetter(messageID string) error {
+	b.mutex.Lock()
+
+	var letter *DeadLetter
+	for i := range b.deadLetters {
+		if b.deadLetters[i].MessageID == messageID {
+			letter = b.deadLetters[i]
+			b.deadLetters = append(b.deadLetters[:i], b.deadLetters[i+1:]...)
+			break
+		}
+	}
+	b.mutex.Unlock()
+
+	if letter == nil {
+		return xerrors.WrapNotFoundError(fmt.Errorf("not found dead letter %s", messageID), "not found dead letter")
+	}
+
+	msg := &Message{
+		ID:        letter.MessageID,
+		Topic:     letter.Topic,
+		Key:       letter.Key,
+		Headers:   letter.Headers,
+		Timestamp: letter.Timestamp,
+		Body:      letter.Body,
+	}
+	delete(msg.Headers, AttemptsHeader)
+
+	return b.Publish(context.Background(), msg)
+}
+
+// Close stops all subscribers and pending retries, queued messages are dropped
+func (b *MemoryBroker) Close() error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.closed {
+		return nil
+	}
+	b.closed = true
+	close(b.done)
+
+	for timer := range b.timers {
+		timer.Stop()
+	}
+	return nil
+}
+
+func (b *MemoryBroker) queue(name string) *memoryQueue {
+	queue, ok := b.queues[name]
+	if !ok {
+		queue = &memoryQueue{
+			name:     name,
+			bindings: make(map[memoryBinding]struct{}),
+			notify:   make(chan struct{}, 1),
+		}
+		b.queues[name] = queue
+	}
+	return queue
+}
+
+// push adds message copy to the queue, requeued message is put to the head of the queue
+func (b *MemoryBroker) push(queue *memoryQueue, msg *Message, front bool) {
+	queued := msg.Clone(nil)
+	if front {
+		queue.messages = append([]*Message{queued}, queue.messages...)
+	} else {
+		queue.messages = append(queue.messages, queued)
+	}
+
+	select {
+	case queue.notify <- struct{}{}:
+	default:
+	}
+}
+
+// pop takes message from the head of the queue, queue is notified again while it has messages
+func (b *MemoryBroker) pop(queue *memoryQueue) (*Message, bool) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if len(queue.messages) == 0 {
+		return nil, false
+	}
+
+	queued := queue.messages[0]
+	queue.messages[0] = nil
+	queue.messages = queue.messages[1:]
+
+	if len(queue.messages) > 0 {
+		select {
+		case queue.notify <- struct{}{}:
+		default:
+		}
+	}
+
+	return queued.Clone(&memorySettler{broker: b, queue: queue, msg: queued}), true
+}
+
+type memorySettler struct {
+	broker *MemoryBroker
+	queue  *memoryQueue
+	msg    *Message
+}
+
+func (s *memorySettler) Ack() error {
+	return nil
+}
+
+func (s *memorySettler) Nack() error {
+	return nil
+}
+
+func (s *memorySettler) Requeue() error {
+	s.broker.mutex.Lock()
+	defer s.broker.mutex.Unlock()
+
+	if s.broker.closed {
+		return fmt.Errorf("broker is closed")
+	}
+
+	s.broker.push(s.queue, s.msg, true)
+	return nil
+}
+
+type memorySubscriber struct {
+	broker *MemoryBroker
+	queue  *memoryQueue
+
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func (s *memorySubscriber) Run(handler Handler) error {
+	for {
+		select {
+		case <-s.done:
+			return nil
+		case <-s.broker.done:
+			return nil
+		case <-s.queue.notify:
+		}
+
+		msg, ok := s.broker.pop(s.queue)
+		if !ok {
+			continue
+		}
+		handler(msg)
+	}
+}
+
+func (s *memorySubscriber) Close() error {
+	s.closeOnce.Do(func() {
+		close(s.done)
+	})
+	return nil
+}
+
+type memoryBinder struct {
+	broker    *MemoryBroker
+	queueName string
+	topic     string
+}
+
+func (b *memoryBinder) Bind(key string) error {
+	b.broker.DeclareQueue(b.queueName, b.topic, key)
+	return nil
+}
+
+func (b *memoryBinder) Unbind(key string) error {
+	b.broker.mutex.Lock()
+	defer b.broker.mutex.Unlock()
+
+	delete(b.broker.queue(b.queueName).bindings, memoryBinding{topic: b.topic, pattern: key})
+	return nil
+}
+
+func (b *memoryBinder) Close() error {
+	return nil
+}
+
+// matchKey matches routing key with the binding pattern by rules of rabbitmq topic exchange
+func matchKey(pattern string, key string) bool {
+	return matchWords(strings.Split(pattern, "."), strings.Split(key, "."))
+}
+
+func matchWords(pattern []string, key []string) bool {
+	if len(pattern) == 0 {
+		return len(key) == 0
+	}
+
+	switch pattern[0] {
+	case "#":
+		for i := 0; i <= len(key); i++ {
+			if matchWords(pattern[1:], key[i:]) {
+				return true
+			}
+		}
+		return false
+	case "*":
+		return len(key) > 0 && matchWords(pattern[1:], key[1:])
+	default:
+		return len(key) > 0 && pattern[0] == key[0] && matchWords(pattern[1:], key[1:])
+	}
+}
+
+// Backoff returns delay before the attempt, it is doubled on every attempt up to max delay
+func Backoff(initialDelay time.Duration, maxDelay time.Duration, attempt int) time.Duration {
+	delay := initialDelay
+	for i := 1; i < attempt && delay < maxDelay; i++ {
+		delay *= 2
+	}
+
+	if delay > maxDelay {
+		return maxDelay
+	}
+	return delay
+}
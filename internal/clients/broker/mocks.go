@@ -0,0 +1,25 @@
+package broker
+
+import (
+	"go.uber.org/zap"
+)
+
+// BinderMock is used when the node queue is bound to all routing keys
+type BinderMock struct {
+	Logger *zap.Logger
+}
+
+func (m *BinderMock) Bind(routingKey string) error {
+	m.Logger.Sugar().Debugf("bind %s through broker mock", routingKey)
+	return nil
+}
+
+func (m *BinderMock) Unbind(routingKey string) error {
+	m.Logger.Sugar().Debugf("unbind %s through broker mock", routingKey)
+	return nil
+}
+
+func (m *BinderMock) Close() error {
+	m.Logger.Debug("closed binder mock")
+	return nil
+}
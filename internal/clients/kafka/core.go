@@ -0,0 +1,387 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	xerrors "github.com/syth0le/gopnik/errors"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"go.uber.org/zap"
+
+	"github.com/syth0le/realtime-notification-service/internal/clients/broker"
+)
+
+const (
+	MessageIDHeader   = "message-id"
+	ContentTypeHeader = "content-type"
+
+	initialRequeueDelay = time.Second
+	maxRequeueDelay     = time.Minute
+)
+
+// SubscriberImpl consumes topic as a member of the consumer group of the node, partitions are assigned by the group.
+// Every node reads all records and handles only ones of the users bound to it, records of other users are settled
+// right away. Record key is a recipient user id, so all notifications of a user come in order from one partition.
+// Offset is committed after the record and all records before it in the partition are settled
+type SubscriberImpl struct {
+	logger *zap.Logger
+	client *kgo.Client
+	binder *BinderImpl
+
+	partitions map[topicPartition]*partitionOffsets
+	mutex      sync.Mutex
+
+	done chan struct{}
+	once sync.Once
+}
+
+// NewKafkaSubscriber joins the consumer group of the node, the new group reads records produced from now on
+func NewKafkaSubscriber(
+	logger *zap.Logger,
+	brokers []string,
+	topic string,
+	binder *BinderImpl,
+) (broker.Subscriber, error) {
+	return newSubscriber(logger, brokers, topic, binder, kgo.NewOffset().AtEnd())
+}
+
+func newSubscriber(
+	logger *zap.Logger,
+	brokers []string,
+	topic string,
+	binder *BinderImpl,
+	resetOffset kgo.Offset,
+) (*SubscriberImpl, error) {
+	s := &SubscriberImpl{
+		logger:     logger,
+		binder:     binder,
+		partitions: make(map[topicPartition]*partitionOffsets),
+		mutex:      sync.Mutex{},
+		done:       make(chan struct{}),
+	}
+
+	client, err := kgo.NewClient(
+		kgo.SeedBrokers(brokers...),
+		kgo.ConsumerGroup(binder.group),
+		kgo.ConsumeTopics(topic),
+		kgo.Balancers(kgo.CooperativeStickyBalancer()),
+		kgo.ConsumeResetOffset(resetOffset),
+		kgo.AutoCommitMarks(),
+		kgo.OnPartitionsRevoked(s.onRevoked),
+		kgo.OnPartitionsLost(s.onLost),
+	)
+	if err != nil {
+		return nil, xerrors.WrapInternalError(fmt.Errorf("cannot create consumer: %w", err))
+	}
+	s.client = client
+
+	return s, nil
+}
+
+func (s *SubscriberImpl) Run(handler broker.Handler) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() {
+		select {
+		case <-s.done:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	for {
+		fetches := s.client.PollFetches(ctx)
+		if fetches.IsClientClosed() || ctx.Err() != nil {
+			return nil
+		}
+
+		fetches.EachError(func(topic string, partition int32, err error) {
+			if !errors.Is(err, context.Canceled) {
+				s.logger.Sugar().Errorf("fetch %s/%d: %v", topic, partition, err)
+			}
+		})
+
+		fetches.EachRecord(func(record *kgo.Record) {
+			msg := s.track(record, handler)
+			if s.binder.Bound(msg.Key) {
+				handler(msg)
+				return
+			}
+
+			// notification of a user connected to another node is handled by that node
+			err := msg.Ack()
+			if err != nil {
+				s.logger.Sugar().Errorf("settle record of unbound %s: %v", msg.Key, err)
+			}
+		})
+	}
+}
+
+func (s *SubscriberImpl) Close() error {
+	s.once.Do(func() {
+		close(s.done)
+		// leaving the group revokes all partitions, so marked offsets are committed
+		s.client.Close()
+	})
+	return nil
+}
+
+// track registers record as pending in its partition and returns message settled by the handler
+func (s *SubscriberImpl) track(record *kgo.Record, handler broker.Handler) *broker.Message {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	key := topicPartition{topic: record.Topic, partition: record.Partition}
+	offsets, ok := s.partitions[key]
+	if !ok {
+		offsets = newPartitionOffsets()
+		s.partitions[key] = offsets
+	}
+	offsets.add(record)
+
+	return messageFromRecord(record, &recordSettler{
+		subscriber: s,
+		handler:    handler,
+		key:        key,
+		offsets:    offsets,
+		record:     record,
+	})
+}
+
+// settle removes record from pending ones and marks the partition offset all records before which are settled
+func (s *SubscriberImpl) settle(key topicPartition, offsets *partitionOffsets, record *kgo.Record) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// record of a revoked partition is committed by its new owner
+	if s.partitions[key] != offsets {
+		return
+	}
+
+	commit, ok := offsets.settle(record.Offset)
+	if !ok {
+		return
+	}
+
+	s.client.MarkCommitOffsets(map[string]map[int32]kgo.EpochOffset{
+		key.topic: {key.partition: commit},
+	})
+}
+
+// requeue delivers pending record to the handler again after backoff, its offset stays uncommitted meanwhile
+func (s *SubscriberImpl) requeue(settler *recordSettler, attempts int) {
+	time.AfterFunc(broker.Backoff(initialRequeueDelay, maxRequeueDelay, attempts), func() {
+		select {
+		case <-s.done:
+			return
+		default:
+		}
+
+		s.mutex.Lock()
+		current := s.partitions[settler.key] == settler.offsets
+		s.mutex.Unlock()
+		if !current {
+			return
+		}
+
+		settler.handler(messageFromRecord(settler.record, settler))
+	})
+}
+
+func (s *SubscriberImpl) onRevoked(ctx context.Context, client *kgo.Client, revoked map[string][]int32) {
+	err := client.CommitMarkedOffsets(ctx)
+	if err != nil {
+		s.logger.Sugar().Errorf("commit marked offsets on revoke: %v", err)
+	}
+	s.forget(revoked)
+}
+
+func (s *SubscriberImpl) onLost(_ context.Context, _ *kgo.Client, lost map[string][]int32) {
+	s.forget(lost)
+}
+
+func (s *SubscriberImpl) forget(partitions map[string][]int32) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for topic, ids := range partitions {
+		for _, id := range ids {
+			delete(s.partitions, topicPartition{topic: topic, partition: id})
+		}
+	}
+}
+
+// BinderImpl keeps users bound to the node, the consumer group of the node reads records of all users
+// and handles records of the bound users only
+type BinderImpl struct {
+	group string
+
+	keys  map[string]struct{}
+	mutex sync.RWMutex
+}
+
+// NewKafkaBinder returns binder of the node consumer group
+func NewKafkaBinder(group string) *BinderImpl {
+	return &BinderImpl{
+		group: group,
+		keys:  make(map[string]struct{}),
+		mutex: sync.RWMutex{},
+	}
+}
+
+func (b *BinderImpl) Bind(key string) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.keys[key] = struct{}{}
+	return nil
+}
+
+func (b *BinderImpl) Unbind(key string) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	delete(b.keys, key)
+	return nil
+}
+
+// Bound reports if records of the user are handled by the node
+func (b *BinderImpl) Bound(key string) bool {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+
+	_, ok := b.keys[key]
+	return ok
+}
+
+// Close does nothing, offsets of the group are expired by the cluster when the group has no members
+func (b *BinderImpl) Close() error {
+	return nil
+}
+
+type topicPartition struct {
+	topic     string
+	partition int32
+}
+
+// partitionOffsets keeps offsets of the partition records which are delivered but not settled
+type partitionOffsets struct {
+	pending map[int64]struct{}
+	next    int64 // offset after the last delivered record
+	epoch   int32
+	marked  int64
+}
+
+func newPartitionOffsets() *partitionOffsets {
+	return &partitionOffsets{
+		pending: make(map[int64]struct{}),
+		next:    -1,
+		marked:  -1,
+	}
+}
+
+func (p *partitionOffsets) add(record *kgo.Record) {
+	p.pending[record.Offset] = struct{}{}
+	if record.Offset >= p.next {
+		p.next = record.Offset + 1
+		p.epoch = record.LeaderEpoch
+	}
+}
+
+// settle returns offset to be committed if it has moved forward
+func (p *partitionOffsets) settle(offset int64) (kgo.EpochOffset, bool) {
+	delete(p.pending, offset)
+
+	commit := p.next
+	for pending := range p.pending {
+		if pending < commit {
+			commit = pending
+		}
+	}
+
+	if commit <= p.marked {
+		return kgo.EpochOffset{}, false
+	}
+	p.marked = commit
+
+	return kgo.EpochOffset{Epoch: p.epoch, Offset: commit}, true
+}
+
+type recordSettler struct {
+	subscriber *SubscriberImpl
+	handler    broker.Handler
+	key        topicPartition
+	offsets    *partitionOffsets
+	record     *kgo.Record
+	attempts   int
+}
+
+func (s *recordSettler) Ack() error {
+	s.subscriber.settle(s.key, s.offsets, s.record)
+	return nil
+}
+
+// Nack skips the record, there is no way to reject a single record in kafka
+func (s *recordSettler) Nack() error {
+	s.subscriber.settle(s.key, s.offsets, s.record)
+	return nil
+}
+
+func (s *recordSettler) Requeue() error {
+	s.attempts++
+	s.subscriber.requeue(s, s.attempts)
+	return nil
+}
+
+func messageFromRecord(record *kgo.Record, settler broker.Settler) *broker.Message {
+	msg := broker.NewMessage(settler)
+	msg.Topic = record.Topic
+	msg.Key = string(record.Key)
+	msg.Headers = make(map[string]any, len(record.Headers))
+	msg.Timestamp = record.Timestamp
+	msg.Body = record.Value
+
+	for _, header := range record.Headers {
+		switch header.Key {
+		case MessageIDHeader:
+			msg.ID = string(header.Value)
+		case ContentTypeHeader:
+			msg.ContentType = string(header.Value)
+		case broker.AttemptsHeader:
+			attempts, err := strconv.Atoi(string(header.Value))
+			if err == nil {
+				msg.Headers[header.Key] = attempts
+			}
+		default:
+			msg.Headers[header.Key] = string(header.Value)
+		}
+	}
+
+	if msg.ID == "" {
+		msg.ID = fmt.Sprintf("%s-%d-%d", record.Topic, record.Partition, record.Offset)
+	}
+	return msg
+}
+
+func recordFromMessage(topic string, msg *broker.Message) *kgo.Record {
+	record := &kgo.Record{
+		Topic:     topic,
+		Key:       []byte(msg.Key),
+		Value:     msg.Body,
+		Timestamp: msg.Timestamp,
+	}
+
+	record.Headers = append(record.Headers, kgo.RecordHeader{Key: MessageIDHeader, Value: []byte(msg.ID)})
+	if msg.ContentType != "" {
+		record.Headers = append(record.Headers, kgo.RecordHeader{Key: ContentTypeHeader, Value: []byte(msg.ContentType)})
+	}
+	for key, value := range msg.Headers {
+		record.Headers = append(record.Headers, kgo.RecordHeader{Key: key, Value: []byte(fmt.Sprint(value))})
+	}
+	return record
+}
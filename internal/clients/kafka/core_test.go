@@ -0,0 +1,216 @@
+package kafka
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kfake"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"go.uber.org/zap"
+
+	"github.com/syth0le/realtime-notification-service/internal/clients/broker"
+	"github.com/syth0le/realtime-notification-service/internal/clients/broker/brokertest"
+)
+
+const (
+	testTopic = "notifications"
+	testGroup = "realtime-notification-service"
+	testWait  = 10 * time.Second
+	testQuiet = 500 * time.Millisecond
+)
+
+func newCluster(t *testing.T, partitions int32) []string {
+	t.Helper()
+
+	cluster, err := kfake.NewCluster(kfake.NumBrokers(1), kfake.SeedTopics(partitions, testTopic))
+	if err != nil {
+		t.Fatalf("create cluster: %v", err)
+	}
+	t.Cleanup(cluster.Close)
+	return cluster.ListenAddrs()
+}
+
+// produce writes records of alice with ids to the partition
+func produce(t *testing.T, brokers []string, partition int32, ids ...string) {
+	t.Helper()
+
+	produceTo(t, brokers, partition, "alice", ids...)
+}
+
+// produceTo writes records of the user with ids to the partition
+func produceTo(t *testing.T, brokers []string, partition int32, key string, ids ...string) {
+	t.Helper()
+
+	client, err := kgo.NewClient(kgo.SeedBrokers(brokers...), kgo.RecordPartitioner(kgo.ManualPartitioner()))
+	if err != nil {
+		t.Fatalf("create producer: %v", err)
+	}
+	defer client.Close()
+
+	for _, id := range ids {
+		msg := broker.NewMessage(nil)
+		msg.ID = id
+		msg.Key = key
+		msg.Body = brokertest.Body(id, key)
+
+		record := recordFromMessage(testTopic, msg)
+		record.Partition = partition
+		err = client.ProduceSync(context.Background(), record).FirstErr()
+		if err != nil {
+			t.Fatalf("produce %s: %v", id, err)
+		}
+	}
+}
+
+func runSubscriber(t *testing.T, brokers []string) *brokertest.Subscription {
+	t.Helper()
+
+	return runNodeSubscriber(t, brokers, testGroup, "alice")
+}
+
+// runNodeSubscriber runs the subscriber of the node group with the users bound, closed subscriber leaves the group,
+// so marked offsets are committed
+func runNodeSubscriber(t *testing.T, brokers []string, group string, keys ...string) *brokertest.Subscription {
+	t.Helper()
+
+	binder := NewKafkaBinder(group)
+	brokertest.Bind(t, binder, keys...)
+
+	subscriber, err := newSubscriber(zap.NewNop(), brokers, testTopic, binder, kgo.NewOffset().AtStart())
+	if err != nil {
+		t.Fatalf("create subscriber: %v", err)
+	}
+
+	s := brokertest.NewSubscription(t, testWait, testQuiet)
+	s.Run(subscriber)
+	return s
+}
+
+func TestOffsetIsCommittedAfterSettle(t *testing.T) {
+	brokers := newCluster(t, 1)
+	produce(t, brokers, 0, "m1", "m2", "m3")
+
+	subscriber := runSubscriber(t, brokers)
+	first := subscriber.Expect(t, "m1", "alice")
+	second := subscriber.Expect(t, "m2", "alice")
+	subscriber.Expect(t, "m3", "alice")
+
+	// m2 is settled before m1, so the offset moves only after m1 is settled as well
+	brokertest.Settle(t, second.Ack)
+	brokertest.Settle(t, first.Nack)
+	subscriber.Close()
+
+	// m3 is not settled, so it is consumed again by the next member of the group
+	subscriber = runSubscriber(t, brokers)
+	subscriber.Expect(t, "m3", "alice")
+	subscriber.None(t)
+}
+
+func TestUnsettledOffsetIsNotCommitted(t *testing.T) {
+	brokers := newCluster(t, 1)
+	produce(t, brokers, 0, "m1", "m2")
+
+	subscriber := runSubscriber(t, brokers)
+	first := subscriber.Next(t)
+	second := subscriber.Next(t)
+
+	// m1 is pending, so the settled m2 does not move the offset
+	brokertest.Settle(t, second.Ack)
+	subscriber.Close()
+
+	subscriber = runSubscriber(t, brokers)
+	if msg := subscriber.Next(t); msg.ID != first.ID {
+		t.Fatalf("unexpected message %s, expected %s", msg.ID, first.ID)
+	}
+	if msg := subscriber.Next(t); msg.ID != second.ID {
+		t.Fatalf("unexpected message %s, expected %s", msg.ID, second.ID)
+	}
+}
+
+func TestRequeuedRecordIsRedelivered(t *testing.T) {
+	brokers := newCluster(t, 1)
+	produce(t, brokers, 0, "m1")
+
+	subscriber := runSubscriber(t, brokers)
+	msg := subscriber.Next(t)
+	brokertest.Settle(t, msg.Requeue)
+
+	// record is delivered again after backoff without being fetched again
+	redelivered := subscriber.Expect(t, "m1", "alice")
+	if err := msg.Ack(); err == nil {
+		t.Fatalf("requeued message is settled twice")
+	}
+
+	brokertest.Settle(t, redelivered.Ack)
+	subscriber.Close()
+
+	subscriber = runSubscriber(t, brokers)
+	subscriber.None(t)
+}
+
+func TestRevokedPartitionIsNotSettled(t *testing.T) {
+	brokers := newCluster(t, 2)
+	produce(t, brokers, 0, "p0-1", "p0-2")
+	produce(t, brokers, 1, "p1-1", "p1-2")
+
+	// the first member owns both partitions and keeps their records pending
+	first := runSubscriber(t, brokers)
+	pending := map[string]*broker.Message{}
+	for i := 0; i < 4; i++ {
+		msg := first.Next(t)
+		pending[msg.ID] = msg
+	}
+
+	// one of the partitions is revoked and given to the second member, which consumes its records again
+	second := runSubscriber(t, brokers)
+	moved, kept := "p0", "p1"
+	if msg := second.Next(t); strings.HasPrefix(msg.ID, "p1") {
+		moved, kept = "p1", "p0"
+	}
+	second.Next(t)
+
+	// records of the revoked partition are neither committed nor redelivered by the first member
+	brokertest.Settle(t, pending[moved+"-1"].Ack)
+	brokertest.Settle(t, pending[moved+"-2"].Requeue)
+	brokertest.Settle(t, pending[kept+"-1"].Ack)
+	brokertest.Settle(t, pending[kept+"-2"].Ack)
+	select {
+	case msg := <-first.Messages:
+		t.Fatalf("record %s of the revoked partition is redelivered", msg.ID)
+	case <-time.After(initialRequeueDelay + testQuiet):
+	}
+	first.Close()
+	second.Close()
+
+	// the second member has not settled the records of the moved partition, so they are consumed again
+	third := runSubscriber(t, brokers)
+	for _, id := range []string{moved + "-1", moved + "-2"} {
+		if msg := third.Next(t); msg.ID != id {
+			t.Fatalf("unexpected message %s, expected %s", msg.ID, id)
+		}
+	}
+	third.None(t)
+}
+
+func TestNodeHandlesBoundUsersOnly(t *testing.T) {
+	brokers := newCluster(t, 1)
+	produceTo(t, brokers, 0, "alice", "a1")
+	produceTo(t, brokers, 0, "bob", "b1")
+
+	// every node group reads all records and hands over records of its own users only
+	first := runNodeSubscriber(t, brokers, testGroup+".node-1", "alice")
+	second := runNodeSubscriber(t, brokers, testGroup+".node-2", "bob")
+
+	brokertest.Settle(t, first.Expect(t, "a1", "alice").Ack)
+	first.None(t)
+
+	brokertest.Settle(t, second.Expect(t, "b1", "bob").Ack)
+	second.None(t)
+	first.Close()
+
+	// record of the unbound user is settled by node-1, so it is not consumed again when the user binds there
+	first = runNodeSubscriber(t, brokers, testGroup+".node-1", "alice", "bob")
+	first.None(t)
+}
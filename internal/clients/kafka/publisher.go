@@ -0,0 +1,42 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+
+	xerrors "github.com/syth0le/gopnik/errors"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"go.uber.org/zap"
+
+	"github.com/syth0le/realtime-notification-service/internal/clients/broker"
+)
+
+// PublisherImpl produces message to its topic with its key, so messages of the same key keep their order
+type PublisherImpl struct {
+	logger *zap.Logger
+	client *kgo.Client
+}
+
+func NewKafkaPublisher(logger *zap.Logger, brokers []string) (broker.Publisher, error) {
+	client, err := kgo.NewClient(
+		kgo.SeedBrokers(brokers...),
+		kgo.AllowAutoTopicCreation(),
+	)
+	if err != nil {
+		return nil, xerrors.WrapInternalError(fmt.Errorf("cannot create publisher: %w", err))
+	}
+
+	return &PublisherImpl{
+		logger: logger,
+		client: client,
+	}, nil
+}
+
+func (p *PublisherImpl) Publish(ctx context.Context, msg *broker.Message) error {
+	return p.client.ProduceSync(ctx, recordFromMessage(msg.Topic, msg)).FirstErr()
+}
+
+func (p *PublisherImpl) Close() error {
+	p.client.Close()
+	return nil
+}
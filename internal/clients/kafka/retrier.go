@@ -0,0 +1,140 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	xerrors "github.com/syth0le/gopnik/errors"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"go.uber.org/zap"
+
+	"github.com/syth0le/realtime-notification-service/internal/clients/broker"
+	"github.com/syth0le/realtime-notification-service/internal/utils"
+)
+
+const defaultPublishTimeout = 5 * time.Second
+
+// Retrier republishes failed records to their topic after backoff,
+// records which are malformed or exhausted max attempts are published to the dead-letter topic
+type Retrier interface {
+	broker.Retrier
+	broker.DeadLetters
+}
+
+type RetrierImpl struct {
+	logger *zap.Logger
+	client *kgo.Client
+
+	deadLetterTopic string
+
+	maxAttempts  int
+	initialDelay time.Duration
+	maxDelay     time.Duration
+}
+
+func NewKafkaRetrier(
+	logger *zap.Logger,
+	enable bool,
+	brokers []string,
+	deadLetterTopic string,
+	maxAttempts int,
+	initialDelay time.Duration,
+	maxDelay time.Duration,
+) (Retrier, error) {
+	if !enable {
+		return &RetrierMock{
+			Logger: logger,
+		}, nil
+	}
+
+	client, err := kgo.NewClient(
+		kgo.SeedBrokers(brokers...),
+		kgo.AllowAutoTopicCreation(),
+	)
+	if err != nil {
+		return nil, xerrors.WrapInternalError(fmt.Errorf("cannot create retrier: %w", err))
+	}
+
+	return &RetrierImpl{
+		logger:          logger,
+		client:          client,
+		deadLetterTopic: deadLetterTopic,
+		maxAttempts:     maxAttempts,
+		initialDelay:    initialDelay,
+		maxDelay:        maxDelay,
+	}, nil
+}
+
+// Retry publishes record to its topic with the same key after backoff, record is dead-lettered after max attempts.
+// Kafka has no delayed delivery, so the record waiting for retry is lost if the node is stopped
+func (r *RetrierImpl) Retry(msg *broker.Message, reason string) error {
+	attempts := msg.Attempts() + 1
+	if attempts >= r.maxAttempts {
+		return r.DeadLetter(msg, reason)
+	}
+
+	retried := msg.Clone(nil)
+	retried.Headers[broker.AttemptsHeader] = attempts
+
+	time.AfterFunc(broker.Backoff(r.initialDelay, r.maxDelay, attempts), func() {
+		err := r.publish(retried.Topic, retried)
+		if err != nil {
+			r.logger.Sugar().Errorf("publish retry %s: %v", retried.ID, err)
+		}
+	})
+
+	r.logger.Sugar().Debugf("retry %s attempt %d: %s", msg.ID, attempts, reason)
+	return nil
+}
+
+func (r *RetrierImpl) DeadLetter(msg *broker.Message, reason string) error {
+	letter := msg.Clone(nil)
+	// dead letters are addressed by message id
+	if letter.ID == "" {
+		letter.ID = utils.GenerateEUID()
+	}
+	letter.Headers[broker.AttemptsHeader] = msg.Attempts() + 1
+	letter.Headers[broker.DeadLetterReasonHeader] = reason
+	letter.Headers[broker.OriginalTopicHeader] = msg.Topic
+	letter.Headers[broker.OriginalKeyHeader] = msg.Key
+
+	err := r.publish(r.deadLetterTopic, letter)
+	if err != nil {
+		return fmt.Errorf("publish dead letter: %w", err)
+	}
+
+	r.logger.Sugar().Warnf("dead-lettered %s: %s", letter.ID, reason)
+	return nil
+}
+
+// ListDeadLetters returns nothing, dead-letter topic is read by kafka tools since records cannot be removed from it
+func (r *RetrierImpl) ListDeadLetters(limit int) ([]*broker.DeadLetter, error) {
+	return nil, nil
+}
+
+func (r *RetrierImpl) GetDeadLetter(messageID string) (*broker.DeadLetter, error) {
+	return nil, xerrors.WrapNotFoundError(
+		fmt.Errorf("dead letters are kept in kafka topic %s", r.deadLetterTopic),
+		"not found dead letter",
+	)
+}
+
+func (r *RetrierImpl) ReplayDeadLetter(messageID string) error {
+	return xerrors.WrapNotFoundError(
+		fmt.Errorf("dead letters are kept in kafka topic %s", r.deadLetterTopic),
+		"not found dead letter",
+	)
+}
+
+func (r *RetrierImpl) Close() error {
+	r.client.Close()
+	return nil
+}
+
+func (r *RetrierImpl) publish(topic string, msg *broker.Message) error {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultPublishTimeout)
+	defer cancel()
+
+	return r.client.ProduceSync(ctx, recordFromMessage(topic, msg)).FirstErr()
+}
@@ -0,0 +1,423 @@
+package nats
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	natsio "github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	xerrors "github.com/syth0le/gopnik/errors"
+	"go.uber.org/zap"
+
+	"github.com/syth0le/realtime-notification-service/internal/clients/broker"
+)
+
+const (
+	// MessageIDHeader is not a jetstream Nats-Msg-Id, so retried message is not dropped as a duplicate
+	MessageIDHeader   = "Message-Id"
+	ContentTypeHeader = "Content-Type"
+
+	userSubjectToken      = "user"
+	defaultDeclareTimeout = 10 * time.Second
+)
+
+// UserSubject returns subject notifications of the user are published to, e.g. notifications.user.<id>
+func UserSubject(prefix string, userID string) string {
+	return fmt.Sprintf("%s.%s", UsersSubject(prefix), userID)
+}
+
+// UsersSubject returns parent subject of user subjects, publisher appends user id as the message key to it
+func UsersSubject(prefix string) string {
+	return fmt.Sprintf("%s.%s", prefix, userSubjectToken)
+}
+
+// UserWildcard returns subject matching notifications of all users
+func UserWildcard(prefix string) string {
+	return UserSubject(prefix, "*")
+}
+
+// SubscriberImpl subscribes to subjects of the users bound to the node, so the node gets only notifications
+// of the users connected to it. Delivery is at most once and messages published while the user is not bound are lost
+type SubscriberImpl struct {
+	logger *zap.Logger
+	conn   *natsio.Conn
+	prefix string
+
+	messages      chan *natsio.Msg
+	subscriptions map[string]*natsio.Subscription
+	closed        bool
+	mutex         sync.Mutex
+
+	done chan struct{}
+	once sync.Once
+}
+
+func NewNatsSubscriber(
+	logger *zap.Logger,
+	conn *natsio.Conn,
+	prefix string,
+) *SubscriberImpl {
+	return &SubscriberImpl{
+		logger:        logger,
+		conn:          conn,
+		prefix:        prefix,
+		messages:      make(chan *natsio.Msg),
+		subscriptions: make(map[string]*natsio.Subscription),
+		mutex:         sync.Mutex{},
+		done:          make(chan struct{}),
+	}
+}
+
+func (s *SubscriberImpl) Run(handler broker.Handler) error {
+	for {
+		select {
+		case <-s.done:
+			return nil
+		case m := <-s.messages:
+			handler(messageFromMsg(s.prefix, m, &coreSettler{}))
+		}
+	}
+}
+
+// Bind subscribes to the user subject, subscriptions are restored by the client after reconnect
+func (s *SubscriberImpl) Bind(key string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.closed {
+		return fmt.Errorf("subscriber is closed")
+	}
+	if _, ok := s.subscriptions[key]; ok {
+		return nil
+	}
+
+	subscription, err := s.conn.Subscribe(UserSubject(s.prefix, key), s.receive)
+	if err != nil {
+		return xerrors.WrapInternalError(fmt.Errorf("cannot subscribe to %s: %w", key, err))
+	}
+	// subscription is active on the server when the flush returns
+	err = s.conn.FlushTimeout(defaultDeclareTimeout)
+	if err != nil {
+		subscription.Unsubscribe()
+		return xerrors.WrapInternalError(fmt.Errorf("cannot subscribe to %s: %w", key, err))
+	}
+	s.subscriptions[key] = subscription
+	return nil
+}
+
+func (s *SubscriberImpl) Unbind(key string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	subscription, ok := s.subscriptions[key]
+	if !ok {
+		return nil
+	}
+	delete(s.subscriptions, key)
+
+	return subscription.Unsubscribe()
+}
+
+func (s *SubscriberImpl) Close() error {
+	s.once.Do(func() {
+		close(s.done)
+
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+
+		s.closed = true
+		for key, subscription := range s.subscriptions {
+			err := subscription.Unsubscribe()
+			if err != nil {
+				s.logger.Sugar().Warnf("unsubscribe from %s: %v", key, err)
+			}
+		}
+		s.subscriptions = make(map[string]*natsio.Subscription)
+	})
+	return nil
+}
+
+// receive passes message of a subscription to Run, pending messages are limited by the subscription
+func (s *SubscriberImpl) receive(m *natsio.Msg) {
+	select {
+	case s.messages <- m:
+	case <-s.done:
+	}
+}
+
+// coreSettler does nothing, core nats has no acknowledgements
+type coreSettler struct{}
+
+func (s *coreSettler) Ack() error {
+	return nil
+}
+
+func (s *coreSettler) Nack() error {
+	return nil
+}
+
+func (s *coreSettler) Requeue() error {
+	return fmt.Errorf("core nats message cannot be requeued")
+}
+
+// JetStreamSubscriberImpl consumes subjects of the users bound to the node, every bound user has its own
+// durable pull consumer of the node, so the node gets only notifications of the users connected to it.
+// Consumer is kept when the user is unbound, so the node resumes from the last acknowledged message when
+// the user connects to it again. Consumer of a user who does not come back is removed by the server
+// after the inactive threshold
+type JetStreamSubscriberImpl struct {
+	logger *zap.Logger
+	stream jetstream.Stream
+	prefix string
+	nodeID string
+
+	ackWait           time.Duration
+	maxDeliver        int
+	inactiveThreshold time.Duration
+
+	messages  chan jetstream.Msg
+	consumers map[string]jetstream.ConsumeContext
+	closed    bool
+	mutex     sync.Mutex
+
+	done chan struct{}
+	once sync.Once
+}
+
+// StreamLimits bound the stream, the oldest messages are discarded when a limit is reached, zero is unlimited
+type StreamLimits struct {
+	MaxAge   time.Duration
+	MaxMsgs  int64
+	MaxBytes int64
+}
+
+// NewJetStreamSubscriber declares stream of user subjects, consumers of it are created on Bind
+func NewJetStreamSubscriber(
+	logger *zap.Logger,
+	conn *natsio.Conn,
+	prefix string,
+	streamName string,
+	limits StreamLimits,
+	nodeID string,
+	ackWait time.Duration,
+	maxDeliver int,
+	inactiveThreshold time.Duration,
+) (*JetStreamSubscriberImpl, error) {
+	js, err := jetstream.New(conn)
+	if err != nil {
+		return nil, xerrors.WrapInternalError(fmt.Errorf("cannot create jetstream: %w", err))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), defaultDeclareTimeout)
+	defer cancel()
+
+	stream, err := js.CreateOrUpdateStream(ctx, jetstream.StreamConfig{
+		Name:     streamName,
+		Subjects: []string{UserWildcard(prefix)},
+		Storage:  jetstream.FileStorage,
+		MaxAge:   limits.MaxAge,
+		MaxMsgs:  limits.MaxMsgs,
+		MaxBytes: limits.MaxBytes,
+	})
+	if err != nil {
+		return nil, xerrors.WrapInternalError(fmt.Errorf("cannot declare stream %s: %w", streamName, err))
+	}
+
+	return &JetStreamSubscriberImpl{
+		logger:            logger,
+		stream:            stream,
+		prefix:            prefix,
+		nodeID:            nodeID,
+		ackWait:           ackWait,
+		maxDeliver:        maxDeliver,
+		inactiveThreshold: inactiveThreshold,
+		messages:          make(chan jetstream.Msg),
+		consumers:         make(map[string]jetstream.ConsumeContext),
+		mutex:             sync.Mutex{},
+		done:              make(chan struct{}),
+	}, nil
+}
+
+func (s *JetStreamSubscriberImpl) Run(handler broker.Handler) error {
+	for {
+		select {
+		case <-s.done:
+			return nil
+		case m := <-s.messages:
+			handler(messageFromJetStream(s.prefix, m))
+		}
+	}
+}
+
+// Bind consumes the user subject by the durable consumer of the node. New consumer delivers messages
+// published from now on, existing one resumes from the last acknowledged message
+func (s *JetStreamSubscriberImpl) Bind(key string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.closed {
+		return fmt.Errorf("subscriber is closed")
+	}
+	if _, ok := s.consumers[key]; ok {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), defaultDeclareTimeout)
+	defer cancel()
+
+	consumer, err := s.stream.CreateOrUpdateConsumer(ctx, jetstream.ConsumerConfig{
+		Durable:           consumerName(s.nodeID, key),
+		DeliverPolicy:     jetstream.DeliverNewPolicy,
+		AckPolicy:         jetstream.AckExplicitPolicy,
+		AckWait:           s.ackWait,
+		MaxDeliver:        s.maxDeliver,
+		FilterSubject:     UserSubject(s.prefix, key),
+		InactiveThreshold: s.inactiveThreshold,
+	})
+	if err != nil {
+		return xerrors.WrapInternalError(fmt.Errorf("cannot create consumer of %s: %w", key, err))
+	}
+
+	consume, err := consumer.Consume(
+		s.receive,
+		jetstream.ConsumeErrHandler(func(_ jetstream.ConsumeContext, err error) {
+			s.logger.Sugar().Errorf("jetstream consume %s: %v", key, err)
+		}),
+	)
+	if err != nil {
+		return xerrors.WrapInternalError(fmt.Errorf("cannot consume %s: %w", key, err))
+	}
+
+	s.consumers[key] = consume
+	return nil
+}
+
+// Unbind stops consuming of the user subject, unacknowledged messages are redelivered when the user is bound again
+func (s *JetStreamSubscriberImpl) Unbind(key string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	consume, ok := s.consumers[key]
+	if !ok {
+		return nil
+	}
+	delete(s.consumers, key)
+
+	consume.Stop()
+	return nil
+}
+
+// Close stops consuming, consumers are kept, so the restarted node resumes them
+func (s *JetStreamSubscriberImpl) Close() error {
+	s.once.Do(func() {
+		close(s.done)
+
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+
+		s.closed = true
+		for _, consume := range s.consumers {
+			consume.Stop()
+		}
+		s.consumers = make(map[string]jetstream.ConsumeContext)
+	})
+	return nil
+}
+
+// receive passes message of a user consumer to Run, pending messages are limited by the consumer
+func (s *JetStreamSubscriberImpl) receive(m jetstream.Msg) {
+	select {
+	case s.messages <- m:
+	case <-s.done:
+	}
+}
+
+// consumerName returns name of the durable consumer of the user on the node, characters not allowed
+// in consumer names are replaced, so the name has a hash of the user id to stay unique
+func consumerName(nodeID string, userID string) string {
+	hash := fnv.New32a()
+	_, _ = hash.Write([]byte(userID))
+	return fmt.Sprintf("%s_%s_%08x", consumerNameReplacer.Replace(nodeID), consumerNameReplacer.Replace(userID), hash.Sum32())
+}
+
+var consumerNameReplacer = strings.NewReplacer(".", "_", "*", "_", ">", "_", " ", "_", "/", "_", "\\", "_")
+
+type jetStreamSettler struct {
+	msg jetstream.Msg
+}
+
+func (s *jetStreamSettler) Ack() error {
+	return s.msg.Ack()
+}
+
+func (s *jetStreamSettler) Nack() error {
+	return s.msg.Term()
+}
+
+func (s *jetStreamSettler) Requeue() error {
+	return s.msg.Nak()
+}
+
+func messageFromMsg(prefix string, m *natsio.Msg, settler broker.Settler) *broker.Message {
+	msg := broker.NewMessage(settler)
+	msg.Topic = m.Subject
+	msg.Key = strings.TrimPrefix(m.Subject, fmt.Sprintf("%s.%s.", prefix, userSubjectToken))
+	msg.Headers = make(map[string]any, len(m.Header))
+	msg.Body = m.Data
+
+	for key := range m.Header {
+		value := m.Header.Get(key)
+		switch key {
+		case MessageIDHeader:
+			msg.ID = value
+		case ContentTypeHeader:
+			msg.ContentType = value
+		case broker.AttemptsHeader:
+			attempts, err := strconv.Atoi(value)
+			if err == nil {
+				msg.Headers[key] = attempts
+			}
+		default:
+			msg.Headers[key] = value
+		}
+	}
+	return msg
+}
+
+func messageFromJetStream(prefix string, m jetstream.Msg) *broker.Message {
+	msg := messageFromMsg(prefix, &natsio.Msg{
+		Subject: m.Subject(),
+		Header:  m.Headers(),
+		Data:    m.Data(),
+	}, &jetStreamSettler{msg: m})
+
+	metadata, err := m.Metadata()
+	if err == nil {
+		msg.Timestamp = metadata.Timestamp
+		if msg.ID == "" {
+			msg.ID = fmt.Sprintf("%s-%d", metadata.Stream, metadata.Sequence.Stream)
+		}
+	}
+	return msg
+}
+
+func msgFromMessage(subject string, msg *broker.Message) *natsio.Msg {
+	m := natsio.NewMsg(subject)
+	m.Data = msg.Body
+
+	if msg.ID != "" {
+		m.Header.Set(MessageIDHeader, msg.ID)
+	}
+	if msg.ContentType != "" {
+		m.Header.Set(ContentTypeHeader, msg.ContentType)
+	}
+	for key, value := range msg.Headers {
+		m.Header.Set(key, fmt.Sprint(value))
+	}
+	return m
+}
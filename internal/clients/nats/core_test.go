@@ -0,0 +1,290 @@
+package nats
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	natsio "github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"go.uber.org/zap"
+
+	"github.com/syth0le/realtime-notification-service/internal/clients/broker"
+	"github.com/syth0le/realtime-notification-service/internal/clients/broker/brokertest"
+)
+
+const (
+	testPrefix = "notifications"
+	testStream = "NOTIFICATIONS"
+	testWait   = 5 * time.Second
+	testQuiet  = 300 * time.Millisecond
+)
+
+func runServer(t *testing.T) string {
+	t.Helper()
+
+	server, err := NewEmbeddedServer(zap.NewNop(), "127.0.0.1", -1, true, t.TempDir())
+	if err != nil {
+		t.Fatalf("run embedded server: %v", err)
+	}
+	t.Cleanup(func() {
+		server.Close()
+	})
+	return server.ClientURL()
+}
+
+func connect(t *testing.T, url string) *natsio.Conn {
+	t.Helper()
+
+	conn, err := natsio.Connect(url)
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	t.Cleanup(conn.Close)
+	return conn
+}
+
+// node is a subscriber of one node, it is the binder of the node as well
+type node interface {
+	broker.Subscriber
+	broker.Binder
+}
+
+// testNode runs the subscriber and passes consumed messages to the test
+type testNode struct {
+	*brokertest.Subscription
+	node node
+}
+
+func runNode(t *testing.T, n node) *testNode {
+	t.Helper()
+
+	s := brokertest.NewSubscription(t, testWait, testQuiet)
+	s.Run(n)
+	return &testNode{Subscription: s, node: n}
+}
+
+func (n *testNode) bind(t *testing.T, keys ...string) {
+	t.Helper()
+
+	brokertest.Bind(t, n.node, keys...)
+}
+
+func publish(t *testing.T, conn *natsio.Conn, id string, key string) {
+	t.Helper()
+
+	brokertest.Publish(t, NewNatsPublisher(zap.NewNop(), conn), UsersSubject(testPrefix), id, key)
+}
+
+// publishToStream returns after the message is stored in the stream
+func publishToStream(t *testing.T, conn *natsio.Conn, id string, key string) {
+	t.Helper()
+
+	js, err := jetstream.New(conn)
+	if err != nil {
+		t.Fatalf("new jetstream: %v", err)
+	}
+
+	msg := broker.NewMessage(nil)
+	msg.ID = id
+	msg.Body = brokertest.Body(id, key)
+
+	_, err = js.PublishMsg(context.Background(), msgFromMessage(UserSubject(testPrefix, key), msg))
+	if err != nil {
+		t.Fatalf("publish %s: %v", id, err)
+	}
+}
+
+func newJetStreamNode(t *testing.T, url string, nodeID string) *JetStreamSubscriberImpl {
+	t.Helper()
+
+	subscriber, err := NewJetStreamSubscriber(
+		zap.NewNop(),
+		connect(t, url),
+		testPrefix,
+		testStream,
+		StreamLimits{MaxAge: time.Hour, MaxMsgs: 1000, MaxBytes: 1 << 20},
+		nodeID,
+		time.Second,
+		-1,
+		time.Hour,
+	)
+	if err != nil {
+		t.Fatalf("new jetstream subscriber: %v", err)
+	}
+	return subscriber
+}
+
+func TestSubscriberRoutesToBoundNodes(t *testing.T) {
+	url := runServer(t)
+	conn := connect(t, url)
+
+	first := runNode(t, NewNatsSubscriber(zap.NewNop(), connect(t, url), testPrefix))
+	second := runNode(t, NewNatsSubscriber(zap.NewNop(), connect(t, url), testPrefix))
+	first.bind(t, "alice", "carol")
+	second.bind(t, "bob", "carol")
+
+	publish(t, conn, "m1", "alice")
+	publish(t, conn, "m2", "bob")
+	publish(t, conn, "m3", "dave")
+	first.Expect(t, "m1", "alice")
+	second.Expect(t, "m2", "bob")
+
+	// every node of the user gets its notification
+	publish(t, conn, "m4", "carol")
+	first.Expect(t, "m4", "carol")
+	second.Expect(t, "m4", "carol")
+	first.None(t)
+	second.None(t)
+
+	err := first.node.Unbind("alice")
+	if err != nil {
+		t.Fatalf("unbind: %v", err)
+	}
+	publish(t, conn, "m5", "alice")
+	first.None(t)
+}
+
+func TestSubscriberIsNotBoundAfterClose(t *testing.T) {
+	url := runServer(t)
+
+	subscriber := NewNatsSubscriber(zap.NewNop(), connect(t, url), testPrefix)
+	runNode(t, subscriber).bind(t, "alice")
+
+	err := subscriber.Close()
+	if err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	if subscriber.conn.NumSubscriptions() != 0 {
+		t.Fatalf("subscriptions are left after close: %d", subscriber.conn.NumSubscriptions())
+	}
+	if err = subscriber.Bind("bob"); err == nil {
+		t.Fatalf("closed subscriber is bound")
+	}
+}
+
+func TestJetStreamSubscriberRoutesToBoundNodes(t *testing.T) {
+	url := runServer(t)
+	conn := connect(t, url)
+
+	first := runNode(t, newJetStreamNode(t, url, "node-1"))
+	second := runNode(t, newJetStreamNode(t, url, "node-2"))
+
+	// messages published before the user is bound are not delivered to the node
+	publishToStream(t, conn, "m0", "alice")
+	first.bind(t, "alice", "carol")
+	second.bind(t, "bob", "carol")
+
+	publish(t, conn, "m1", "alice")
+	publish(t, conn, "m2", "bob")
+	publish(t, conn, "m3", "dave")
+	brokertest.Settle(t, first.Expect(t, "m1", "alice").Ack)
+	brokertest.Settle(t, second.Expect(t, "m2", "bob").Ack)
+
+	publish(t, conn, "m4", "carol")
+	brokertest.Settle(t, first.Expect(t, "m4", "carol").Ack)
+	brokertest.Settle(t, second.Expect(t, "m4", "carol").Ack)
+	first.None(t)
+	second.None(t)
+}
+
+func TestJetStreamSubscriberRedeliversUntilAck(t *testing.T) {
+	url := runServer(t)
+	conn := connect(t, url)
+
+	subscriber := newJetStreamNode(t, url, "node-1")
+	node := runNode(t, subscriber)
+	node.bind(t, "alice")
+
+	publish(t, conn, "m1", "alice")
+	brokertest.Settle(t, node.Expect(t, "m1", "alice").Requeue)
+
+	// requeued message is delivered again, acknowledged one is not
+	brokertest.Settle(t, node.Expect(t, "m1", "alice").Ack)
+	node.None(t)
+
+	// message which is not settled is delivered again after ack wait
+	publish(t, conn, "m2", "alice")
+	node.Expect(t, "m2", "alice")
+	brokertest.Settle(t, node.Expect(t, "m2", "alice").Ack)
+
+	// terminated message is not delivered again
+	publish(t, conn, "m3", "alice")
+	brokertest.Settle(t, node.Expect(t, "m3", "alice").Nack)
+	select {
+	case msg := <-node.Messages:
+		t.Fatalf("unexpected message %s", msg.ID)
+	case <-time.After(subscriber.ackWait + testQuiet):
+	}
+}
+
+func TestJetStreamSubscriberResumesUser(t *testing.T) {
+	url := runServer(t)
+	conn := connect(t, url)
+
+	subscriber := newJetStreamNode(t, url, "node-1")
+	node := runNode(t, subscriber)
+	node.bind(t, "alice", "bob")
+	assertConsumers(t, subscriber, 2)
+
+	// consumer of the unbound user is kept, messages published meanwhile are delivered when the user is bound again
+	err := subscriber.Unbind("alice")
+	if err != nil {
+		t.Fatalf("unbind: %v", err)
+	}
+	publishToStream(t, conn, "m1", "alice")
+	node.None(t)
+
+	node.bind(t, "alice")
+	brokertest.Settle(t, node.Expect(t, "m1", "alice").Ack)
+	assertConsumers(t, subscriber, 2)
+}
+
+func TestJetStreamSubscriberKeepsConsumersOnClose(t *testing.T) {
+	url := runServer(t)
+	conn := connect(t, url)
+
+	subscriber := newJetStreamNode(t, url, "node-1")
+	runNode(t, subscriber).bind(t, "alice")
+
+	err := subscriber.Close()
+	if err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	assertConsumers(t, subscriber, 1)
+	if err = subscriber.Bind("alice"); err == nil {
+		t.Fatalf("closed subscriber is bound")
+	}
+
+	// restarted node resumes the user from the last acknowledged message
+	publishToStream(t, conn, "m1", "alice")
+	restarted := runNode(t, newJetStreamNode(t, url, "node-1"))
+	restarted.bind(t, "alice")
+	brokertest.Settle(t, restarted.Expect(t, "m1", "alice").Ack)
+	restarted.None(t)
+}
+
+func TestJetStreamStreamLimits(t *testing.T) {
+	url := runServer(t)
+
+	subscriber := newJetStreamNode(t, url, "node-1")
+	info, err := subscriber.stream.Info(context.Background())
+	if err != nil {
+		t.Fatalf("stream info: %v", err)
+	}
+	if info.Config.MaxAge != time.Hour || info.Config.MaxMsgs != 1000 || info.Config.MaxBytes != 1<<20 {
+		t.Fatalf("unexpected stream limits: %+v", info.Config)
+	}
+}
+
+func assertConsumers(t *testing.T, subscriber *JetStreamSubscriberImpl, expected int) {
+	t.Helper()
+
+	info, err := subscriber.stream.Info(context.Background())
+	if err != nil {
+		t.Fatalf("stream info: %v", err)
+	}
+	if info.State.Consumers != expected {
+		t.Fatalf("consumers: expected %d, got %d", expected, info.State.Consumers)
+	}
+}
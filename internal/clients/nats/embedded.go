@@ -0,0 +1,57 @@
+package nats
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+	xerrors "github.com/syth0le/gopnik/errors"
+	"go.uber.org/zap"
+)
+
+const defaultStartTimeout = 10 * time.Second
+
+// EmbeddedServer is nats server running in the process, it is used for edge deployments and local runs
+type EmbeddedServer struct {
+	logger *zap.Logger
+	server *server.Server
+}
+
+// NewEmbeddedServer starts nats server listening on the port, jetstream data is kept in storeDir
+func NewEmbeddedServer(logger *zap.Logger, host string, port int, jetStream bool, storeDir string) (*EmbeddedServer, error) {
+	srv, err := server.NewServer(&server.Options{
+		Host:      host,
+		Port:      port,
+		JetStream: jetStream,
+		StoreDir:  storeDir,
+		NoSigs:    true,
+		NoLog:     true,
+	})
+	if err != nil {
+		return nil, xerrors.WrapInternalError(fmt.Errorf("cannot create embedded nats server: %w", err))
+	}
+
+	go srv.Start()
+	if !srv.ReadyForConnections(defaultStartTimeout) {
+		srv.Shutdown()
+		return nil, xerrors.WrapInternalError(fmt.Errorf("embedded nats server is not ready in %s", defaultStartTimeout))
+	}
+
+	logger.Sugar().Infof("embedded nats server is listening on %s", srv.ClientURL())
+	return &EmbeddedServer{
+		logger: logger,
+		server: srv,
+	}, nil
+}
+
+// ClientURL returns address to connect to the server
+func (s *EmbeddedServer) ClientURL() string {
+	return s.server.ClientURL()
+}
+
+func (s *EmbeddedServer) Close() error {
+	s.server.Shutdown()
+	s.server.WaitForShutdown()
+	s.logger.Info("embedded nats server is stopped")
+	return nil
+}
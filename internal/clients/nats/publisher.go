@@ -0,0 +1,39 @@
+package nats
+
+import (
+	"context"
+	"fmt"
+
+	natsio "github.com/nats-io/nats.go"
+	"go.uber.org/zap"
+
+	"github.com/syth0le/realtime-notification-service/internal/clients/broker"
+)
+
+// PublisherImpl publishes message through core nats to <topic>.<key>,
+// so subscribers filter messages by key with subject wildcards like by routing key
+type PublisherImpl struct {
+	logger *zap.Logger
+	conn   *natsio.Conn
+}
+
+func NewNatsPublisher(logger *zap.Logger, conn *natsio.Conn) broker.Publisher {
+	return &PublisherImpl{
+		logger: logger,
+		conn:   conn,
+	}
+}
+
+func (p *PublisherImpl) Publish(ctx context.Context, msg *broker.Message) error {
+	subject := msg.Topic
+	if msg.Key != "" {
+		subject = fmt.Sprintf("%s.%s", msg.Topic, msg.Key)
+	}
+
+	return p.conn.PublishMsg(msgFromMessage(subject, msg))
+}
+
+// Close does nothing, connection is shared and closed by its owner
+func (p *PublisherImpl) Close() error {
+	return nil
+}
@@ -0,0 +1,163 @@
+package nats
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	natsio "github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	xerrors "github.com/syth0le/gopnik/errors"
+	"go.uber.org/zap"
+
+	"github.com/syth0le/realtime-notification-service/internal/clients/broker"
+	"github.com/syth0le/realtime-notification-service/internal/utils"
+)
+
+const defaultPublishTimeout = 5 * time.Second
+
+// Retrier republishes failed messages to their user subject after backoff,
+// messages which are malformed or exhausted max attempts are published to the dead-letter subject
+type Retrier interface {
+	broker.Retrier
+	broker.DeadLetters
+}
+
+type RetrierImpl struct {
+	logger *zap.Logger
+	conn   *natsio.Conn
+	js     jetstream.JetStream // nil if messages are published through core nats
+
+	deadLetterSubject string
+
+	maxAttempts  int
+	initialDelay time.Duration
+	maxDelay     time.Duration
+}
+
+// NewNatsRetrier publishes through jetstream if deadLetterStream is set, the stream keeps dead letters after restart
+func NewNatsRetrier(
+	logger *zap.Logger,
+	enable bool,
+	conn *natsio.Conn,
+	deadLetterSubject string,
+	deadLetterStream string,
+	maxAttempts int,
+	initialDelay time.Duration,
+	maxDelay time.Duration,
+) (Retrier, error) {
+	if !enable {
+		return &RetrierMock{
+			Logger: logger,
+		}, nil
+	}
+
+	retrier := &RetrierImpl{
+		logger:            logger,
+		conn:              conn,
+		deadLetterSubject: deadLetterSubject,
+		maxAttempts:       maxAttempts,
+		initialDelay:      initialDelay,
+		maxDelay:          maxDelay,
+	}
+
+	if deadLetterStream != "" {
+		js, err := jetstream.New(conn)
+		if err != nil {
+			return nil, xerrors.WrapInternalError(fmt.Errorf("cannot create jetstream: %w", err))
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), defaultDeclareTimeout)
+		defer cancel()
+
+		_, err = js.CreateOrUpdateStream(ctx, jetstream.StreamConfig{
+			Name:     deadLetterStream,
+			Subjects: []string{deadLetterSubject},
+			Storage:  jetstream.FileStorage,
+		})
+		if err != nil {
+			return nil, xerrors.WrapInternalError(fmt.Errorf("cannot declare stream %s: %w", deadLetterStream, err))
+		}
+		retrier.js = js
+	}
+
+	return retrier, nil
+}
+
+// Retry publishes message to its subject after backoff, message is dead-lettered after max attempts.
+// Message waiting for retry is lost if the node is stopped
+func (r *RetrierImpl) Retry(msg *broker.Message, reason string) error {
+	attempts := msg.Attempts() + 1
+	if attempts >= r.maxAttempts {
+		return r.DeadLetter(msg, reason)
+	}
+
+	retried := msg.Clone(nil)
+	retried.Headers[broker.AttemptsHeader] = attempts
+
+	time.AfterFunc(broker.Backoff(r.initialDelay, r.maxDelay, attempts), func() {
+		err := r.publish(retried.Topic, retried)
+		if err != nil {
+			r.logger.Sugar().Errorf("publish retry %s: %v", retried.ID, err)
+		}
+	})
+
+	r.logger.Sugar().Debugf("retry %s attempt %d: %s", msg.ID, attempts, reason)
+	return nil
+}
+
+func (r *RetrierImpl) DeadLetter(msg *broker.Message, reason string) error {
+	letter := msg.Clone(nil)
+	// dead letters are addressed by message id
+	if letter.ID == "" {
+		letter.ID = utils.GenerateEUID()
+	}
+	letter.Headers[broker.AttemptsHeader] = msg.Attempts() + 1
+	letter.Headers[broker.DeadLetterReasonHeader] = reason
+	letter.Headers[broker.OriginalTopicHeader] = msg.Topic
+	letter.Headers[broker.OriginalKeyHeader] = msg.Key
+
+	err := r.publish(r.deadLetterSubject, letter)
+	if err != nil {
+		return fmt.Errorf("publish dead letter: %w", err)
+	}
+
+	r.logger.Sugar().Warnf("dead-lettered %s: %s", letter.ID, reason)
+	return nil
+}
+
+// ListDeadLetters returns nothing, dead-letter subject is read by nats tools
+func (r *RetrierImpl) ListDeadLetters(limit int) ([]*broker.DeadLetter, error) {
+	return nil, nil
+}
+
+func (r *RetrierImpl) GetDeadLetter(messageID string) (*broker.DeadLetter, error) {
+	return nil, xerrors.WrapNotFoundError(
+		fmt.Errorf("dead letters are published to nats subject %s", r.deadLetterSubject),
+		"not found dead letter",
+	)
+}
+
+func (r *RetrierImpl) ReplayDeadLetter(messageID string) error {
+	return xerrors.WrapNotFoundError(
+		fmt.Errorf("dead letters are published to nats subject %s", r.deadLetterSubject),
+		"not found dead letter",
+	)
+}
+
+func (r *RetrierImpl) Close() error {
+	return nil
+}
+
+func (r *RetrierImpl) publish(subject string, msg *broker.Message) error {
+	m := msgFromMessage(subject, msg)
+	if r.js == nil {
+		return r.conn.PublishMsg(m)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), defaultPublishTimeout)
+	defer cancel()
+
+	_, err := r.js.PublishMsg(ctx, m)
+	return err
+}
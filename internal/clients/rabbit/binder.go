@@ -0,0 +1,186 @@
+package rabbit
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	xerrors "github.com/syth0le/gopnik/errors"
+	"go.uber.org/zap"
+
+	"github.com/syth0le/realtime-notification-service/internal/clients/broker"
+)
+
+// BinderImpl manages routing key bindings of the node queue at runtime
+type BinderImpl struct {
+	logger *zap.Logger
+	pool   *ConnectionPool
+
+	topology Topology
+
+	channel *PooledChannel
+	keys    map[string]struct{}
+	closed  bool
+
+	mutex sync.Mutex
+}
+
+// NewRabbitBinder declares the topology of the node queue and keeps its bindings through reconnects
+func NewRabbitBinder(
+	logger *zap.Logger,
+	enable bool,
+	pool *ConnectionPool,
+	topology Topology,
+) (broker.Binder, error) {
+	if !enable {
+		return &broker.BinderMock{
+			Logger: logger,
+		}, nil
+	}
+
+	binder := &BinderImpl{
+		logger:   logger,
+		pool:     pool,
+		topology: topology,
+		keys:     make(map[string]struct{}),
+		mutex:    sync.Mutex{},
+	}
+
+	err := binder.connect()
+	if err != nil {
+		return nil, xerrors.WrapInternalError(fmt.Errorf("cannot create binder: %w", err))
+	}
+
+	return binder, nil
+}
+
+func (b *BinderImpl) Bind(routingKey string) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if _, ok := b.keys[routingKey]; ok {
+		return nil
+	}
+
+	// failed key is forgotten, caller binds it again
+	err := b.channel.QueueBind(b.topology.QueueName, routingKey, b.topology.ExchangeName, false, nil)
+	if err != nil {
+		return fmt.Errorf("queue bind %s: %w", routingKey, err)
+	}
+
+	b.keys[routingKey] = struct{}{}
+	return nil
+}
+
+func (b *BinderImpl) Unbind(routingKey string) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if _, ok := b.keys[routingKey]; !ok {
+		return nil
+	}
+
+	delete(b.keys, routingKey)
+
+	err := b.channel.QueueUnbind(b.topology.QueueName, routingKey, b.topology.ExchangeName, nil)
+	if err != nil {
+		return fmt.Errorf("queue unbind %s: %w", routingKey, err)
+	}
+
+	return nil
+}
+
+// Restore declares the node queue again and restores all known bindings. Auto-delete queue is deleted by the broker
+// with its last consumer and exclusive one with its connection, so bindings are lost when consumers restart
+func (b *BinderImpl) Restore() error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.closed {
+		return nil
+	}
+
+	// closed channel is reconnected by the watch, which restores bindings as well
+	if b.channel.IsClosed() {
+		return fmt.Errorf("binder channel is closed")
+	}
+
+	return b.declare(b.channel)
+}
+
+func (b *BinderImpl) Close() error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.closed = true
+	return b.channel.Close()
+}
+
+// connect takes channel from the pool, declares exchange and queue and restores all known bindings
+func (b *BinderImpl) connect() error {
+	channel, err := b.topology.Channel(b.pool)
+	if err != nil {
+		return fmt.Errorf("take channel: %w", err)
+	}
+
+	err = b.declare(channel)
+	if err != nil {
+		channel.Close()
+		return err
+	}
+
+	b.channel = channel
+
+	go b.watch(channel, channel.NotifyClose(make(chan *amqp.Error, 1)))
+	return nil
+}
+
+// declare declares exchange and queue and binds all known keys, binding existing key again does nothing
+func (b *BinderImpl) declare(channel *PooledChannel) error {
+	err := b.topology.Declare(channel, "")
+	if err != nil {
+		return err
+	}
+
+	for key := range b.keys {
+		err = channel.QueueBind(b.topology.QueueName, key, b.topology.ExchangeName, false, nil)
+		if err != nil {
+			return fmt.Errorf("queue bind %s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+func (b *BinderImpl) watch(channel *PooledChannel, closeCh chan *amqp.Error) {
+	amqpErr, ok := <-closeCh
+	if !ok || amqpErr == nil {
+		// connection of the channel is lost without channel close frame or binder is closed
+		b.mutex.Lock()
+		closed := b.closed
+		b.mutex.Unlock()
+		if closed {
+			return
+		}
+	}
+	b.logger.Sugar().Warnf("binder channel closed: %v", amqpErr)
+	channel.Close()
+
+	for attempt := 1; ; attempt++ {
+		time.Sleep(b.pool.Backoff(attempt))
+
+		b.mutex.Lock()
+		if b.closed {
+			b.mutex.Unlock()
+			return
+		}
+		err := b.connect()
+		b.mutex.Unlock()
+
+		if err == nil {
+			b.logger.Info("binder reconnected")
+			return
+		}
+		b.logger.Sugar().Errorf("binder reconnect: %v", err)
+	}
+}
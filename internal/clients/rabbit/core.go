@@ -2,58 +2,215 @@ package rabbit
 
 import (
 	"fmt"
+	"sync"
+	"time"
 
+	amqp "github.com/rabbitmq/amqp091-go"
 	xerrors "github.com/syth0le/gopnik/errors"
-	"github.com/wagslane/go-rabbitmq"
 	"go.uber.org/zap"
+
+	"github.com/syth0le/realtime-notification-service/internal/clients/broker"
 )
 
-type Consumer interface {
-	Close() error
-	Run(handler rabbitmq.Handler) error
+// SubscriberImpl consumes the queue on a channel taken from the pool, deliveries are settled by the handler.
+// Consumer is re-established on a new channel with backoff when its channel or connection is lost
+type SubscriberImpl struct {
+	logger *zap.Logger
+	pool   *ConnectionPool
+
+	topology    Topology
+	routingKey  string
+	restorer    Restorer
+	prefetch    int
+	concurrency int
+
+	channel *PooledChannel
+	closed  bool
+	mutex   sync.Mutex
 }
 
-type ConsumerImpl struct {
-	Conn     *rabbitmq.Conn
-	Consumer *rabbitmq.Consumer
+// Restorer restores bindings of the queue declared again by the consumer
+type Restorer interface {
+	Restore() error
 }
 
-func NewRabbitConsumer(
+// NewRabbitSubscriber declares the topology with the queue bound by the routing key.
+// Restorer is called every time consumer is started, it is nil if bindings are not managed at runtime.
+// Prefetch limits unacknowledged deliveries of the consumer, they are handled by concurrency goroutines
+func NewRabbitSubscriber(
 	logger *zap.Logger,
-	enable bool,
-	queueName string,
-	exchangeName string,
+	pool *ConnectionPool,
+	topology Topology,
 	routingKey string,
-	conn *rabbitmq.Conn,
-) (Consumer, error) {
-	if !enable {
-		return &ConsumerMock{
-			Logger: logger,
-		}, nil
-	}
-
-	consumer, err := rabbitmq.NewConsumer(
-		conn,
-		queueName,
-		rabbitmq.WithConsumerOptionsRoutingKey(routingKey),
-		rabbitmq.WithConsumerOptionsExchangeName(exchangeName),
-		rabbitmq.WithConsumerOptionsExchangeDeclare,
-	)
+	restorer Restorer,
+	prefetch int,
+	concurrency int,
+) (broker.Subscriber, error) {
+	subscriber := &SubscriberImpl{
+		logger:      logger,
+		pool:        pool,
+		topology:    topology,
+		routingKey:  routingKey,
+		restorer:    restorer,
+		prefetch:    prefetch,
+		concurrency: concurrency,
+		mutex:       sync.Mutex{},
+	}
+
+	channel, err := topology.Channel(pool)
+	if err != nil {
+		return nil, xerrors.WrapInternalError(fmt.Errorf("cannot create consumer: %w", err))
+	}
+	defer channel.Close()
+
+	err = topology.Declare(channel, routingKey)
 	if err != nil {
 		return nil, xerrors.WrapInternalError(fmt.Errorf("cannot create consumer: %w", err))
 	}
 
-	return &ConsumerImpl{
-		Conn:     conn,
-		Consumer: consumer,
-	}, nil
+	return subscriber, nil
 }
 
-func (c *ConsumerImpl) Close() error {
-	c.Consumer.Close()
+func (s *SubscriberImpl) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.closed = true
+	if s.channel != nil {
+		return s.channel.Close()
+	}
 	return nil
 }
 
-func (c *ConsumerImpl) Run(handler rabbitmq.Handler) error {
-	return c.Consumer.Run(handler)
+// Run consumes until subscriber is closed, deliveries of the lost channel are redelivered by the broker
+func (s *SubscriberImpl) Run(handler broker.Handler) error {
+	for attempt := 0; ; attempt++ {
+		deliveries, err := s.consume()
+		if err == nil {
+			attempt = 0
+			s.handle(deliveries, handler)
+		}
+
+		if s.isClosed() {
+			return nil
+		}
+
+		if err != nil {
+			s.logger.Sugar().Errorf("consume %s: %v", s.topology.QueueName, err)
+		} else {
+			s.logger.Sugar().Warnf("consumer of %s is stopped, restarting", s.topology.QueueName)
+		}
+		s.pool.ConsumerRestarted()
+		time.Sleep(s.pool.Backoff(attempt + 1))
+	}
+}
+
+// handle passes deliveries to the handler from concurrency goroutines until deliveries are closed
+func (s *SubscriberImpl) handle(deliveries <-chan amqp.Delivery, handler broker.Handler) {
+	wg := sync.WaitGroup{}
+	for i := 0; i < s.concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for d := range deliveries {
+				handler(messageFromDelivery(d))
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// consume takes new channel from the pool and starts consuming on it
+func (s *SubscriberImpl) consume() (<-chan amqp.Delivery, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.closed {
+		return nil, fmt.Errorf("subscriber is closed")
+	}
+
+	if s.channel != nil {
+		s.channel.Close()
+		s.channel = nil
+	}
+
+	channel, err := s.topology.Channel(s.pool)
+	if err != nil {
+		return nil, fmt.Errorf("take channel: %w", err)
+	}
+
+	err = s.topology.Declare(channel, s.routingKey)
+	if err != nil {
+		channel.Close()
+		return nil, err
+	}
+
+	if s.restorer != nil {
+		err = s.restorer.Restore()
+		if err != nil {
+			channel.Close()
+			return nil, fmt.Errorf("restore bindings: %w", err)
+		}
+	}
+
+	err = channel.Qos(s.prefetch, 0, false)
+	if err != nil {
+		channel.Close()
+		return nil, fmt.Errorf("qos: %w", err)
+	}
+
+	deliveries, err := channel.Consume(s.topology.QueueName, "", false, false, false, false, nil)
+	if err != nil {
+		channel.Close()
+		return nil, fmt.Errorf("consume: %w", err)
+	}
+
+	s.channel = channel
+	return deliveries, nil
+}
+
+func (s *SubscriberImpl) isClosed() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.closed
+}
+
+type deliverySettler struct {
+	delivery amqp.Delivery
+}
+
+func (s *deliverySettler) Ack() error {
+	return s.delivery.Ack(false)
+}
+
+func (s *deliverySettler) Nack() error {
+	return s.delivery.Nack(false, false)
+}
+
+func (s *deliverySettler) Requeue() error {
+	return s.delivery.Nack(false, true)
+}
+
+func messageFromDelivery(d amqp.Delivery) *broker.Message {
+	msg := broker.NewMessage(&deliverySettler{delivery: d})
+	msg.ID = d.MessageId
+	msg.Topic = d.Exchange
+	msg.Key = d.RoutingKey
+	msg.ContentType = d.ContentType
+	msg.Headers = d.Headers
+	msg.Timestamp = d.Timestamp
+	msg.Body = d.Body
+	return msg
+}
+
+func publishingFromMessage(msg *broker.Message) amqp.Publishing {
+	return amqp.Publishing{
+		Headers:      msg.Headers,
+		ContentType:  msg.ContentType,
+		DeliveryMode: amqp.Persistent,
+		MessageId:    msg.ID,
+		Timestamp:    msg.Timestamp,
+		Body:         msg.Body,
+	}
 }
@@ -0,0 +1,74 @@
+package rabbit
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// PoolMetrics exposes lifecycle events of pooled connections, channels and consumers
+type PoolMetrics struct {
+	Connections       prometheus.Gauge
+	Channels          prometheus.Gauge
+	ConnectionsLost   prometheus.Counter
+	Reconnects        prometheus.Counter
+	ReconnectFailures prometheus.Counter
+	ConsumerRestarts  prometheus.Counter
+	ChannelsExhausted prometheus.Counter
+}
+
+func NewPoolMetrics(registerer prometheus.Registerer) *PoolMetrics {
+	metrics := &PoolMetrics{
+		Connections: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: "rabbitmq",
+			Subsystem: "pool",
+			Name:      "connections",
+			Help:      "Number of open pooled connections.",
+		}),
+		Channels: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: "rabbitmq",
+			Subsystem: "pool",
+			Name:      "channels",
+			Help:      "Number of channels checked out of the pool.",
+		}),
+		ConnectionsLost: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "rabbitmq",
+			Subsystem: "pool",
+			Name:      "connections_lost_total",
+			Help:      "Number of pooled connections closed by the broker or network.",
+		}),
+		Reconnects: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "rabbitmq",
+			Subsystem: "pool",
+			Name:      "reconnects_total",
+			Help:      "Number of successful reconnects of pooled connections.",
+		}),
+		ReconnectFailures: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "rabbitmq",
+			Subsystem: "pool",
+			Name:      "reconnect_failures_total",
+			Help:      "Number of failed reconnect attempts of pooled connections.",
+		}),
+		ConsumerRestarts: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "rabbitmq",
+			Subsystem: "consumer",
+			Name:      "restarts_total",
+			Help:      "Number of consumers re-established after their channel was closed.",
+		}),
+		ChannelsExhausted: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "rabbitmq",
+			Subsystem: "pool",
+			Name:      "channels_exhausted_total",
+			Help:      "Number of channel requests rejected because all connections reached channel max.",
+		}),
+	}
+
+	registerer.MustRegister(
+		metrics.Connections,
+		metrics.Channels,
+		metrics.ConnectionsLost,
+		metrics.Reconnects,
+		metrics.ReconnectFailures,
+		metrics.ConsumerRestarts,
+		metrics.ChannelsExhausted,
+	)
+	return metrics
+}
@@ -1,20 +1,41 @@
 package rabbit
 
 import (
-	"github.com/wagslane/go-rabbitmq"
+	"fmt"
+
+	xerrors "github.com/syth0le/gopnik/errors"
 	"go.uber.org/zap"
+
+	"github.com/syth0le/realtime-notification-service/internal/clients/broker"
 )
 
-type ConsumerMock struct {
+type RetrierMock struct {
 	Logger *zap.Logger
 }
 
-func (m *ConsumerMock) Close() error {
-	m.Logger.Debug("closed consumer mock")
+func (m *RetrierMock) Retry(msg *broker.Message, reason string) error {
+	m.Logger.Sugar().Debugf("discard %s through rabbitmq mock: %s", msg.ID, reason)
+	return nil
+}
+
+func (m *RetrierMock) DeadLetter(msg *broker.Message, reason string) error {
+	m.Logger.Sugar().Debugf("discard %s through rabbitmq mock: %s", msg.ID, reason)
 	return nil
 }
 
-func (m *ConsumerMock) Run(handler rabbitmq.Handler) error {
-	m.Logger.Debug("run through rabbitmq mock")
+func (m *RetrierMock) ListDeadLetters(limit int) ([]*broker.DeadLetter, error) {
+	return nil, nil
+}
+
+func (m *RetrierMock) GetDeadLetter(messageID string) (*broker.DeadLetter, error) {
+	return nil, xerrors.WrapNotFoundError(fmt.Errorf("dead letters are disabled"), "not found dead letter")
+}
+
+func (m *RetrierMock) ReplayDeadLetter(messageID string) error {
+	return xerrors.WrapNotFoundError(fmt.Errorf("dead letters are disabled"), "not found dead letter")
+}
+
+func (m *RetrierMock) Close() error {
+	m.Logger.Debug("closed retrier mock")
 	return nil
 }
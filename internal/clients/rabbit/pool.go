@@ -0,0 +1,314 @@
+package rabbit
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	xerrors "github.com/syth0le/gopnik/errors"
+	"go.uber.org/zap"
+
+	"github.com/syth0le/realtime-notification-service/internal/clients/broker"
+)
+
+// ConnectionPool keeps a fixed number of connections and hands out channels of the least loaded one,
+// so channel max of a single connection is never hit. Lost connection is reconnected with backoff,
+// channels of the lost connection are closed and their owners take new ones from the pool
+type ConnectionPool struct {
+	logger  *zap.Logger
+	metrics *PoolMetrics
+
+	address             string
+	channelMax          int
+	healthCheckInterval time.Duration
+	initialBackoff      time.Duration
+	maxBackoff          time.Duration
+
+	connections []*pooledConnection
+	closed      bool
+	mutex       sync.Mutex
+
+	done chan struct{}
+	once sync.Once
+}
+
+type pooledConnection struct {
+	id           int
+	conn         *amqp.Connection // nil while reconnecting
+	generation   int              // incremented on every reconnect, channels of the previous generation are gone
+	channels     int
+	reconnecting bool
+}
+
+func NewConnectionPool(
+	logger *zap.Logger,
+	metrics *PoolMetrics,
+	address string,
+	size int,
+	channelMax int,
+	healthCheckInterval time.Duration,
+	initialBackoff time.Duration,
+	maxBackoff time.Duration,
+) (*ConnectionPool, error) {
+	pool := &ConnectionPool{
+		logger:              logger,
+		metrics:             metrics,
+		address:             address,
+		channelMax:          channelMax,
+		healthCheckInterval: healthCheckInterval,
+		initialBackoff:      initialBackoff,
+		maxBackoff:          maxBackoff,
+		connections:         make([]*pooledConnection, 0, size),
+		mutex:               sync.Mutex{},
+		done:                make(chan struct{}),
+	}
+
+	for i := 0; i < size; i++ {
+		conn, err := amqp.Dial(address)
+		if err != nil {
+			pool.Close()
+			return nil, xerrors.WrapInternalError(fmt.Errorf("cannot create connection pool: %w", err))
+		}
+
+		pc := &pooledConnection{id: i}
+		pool.attach(pc, conn)
+		pool.connections = append(pool.connections, pc)
+	}
+
+	return pool, nil
+}
+
+// Run checks connections periodically and reconnects closed ones which were not noticed by close notification
+func (p *ConnectionPool) Run() error {
+	ticker := time.NewTicker(p.healthCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.done:
+			return nil
+		case <-ticker.C:
+			p.healthCheck()
+		}
+	}
+}
+
+func (p *ConnectionPool) Close() error {
+	p.once.Do(func() {
+		close(p.done)
+
+		p.mutex.Lock()
+		defer p.mutex.Unlock()
+
+		p.closed = true
+		for _, pc := range p.connections {
+			if pc.conn != nil && !pc.conn.IsClosed() {
+				err := pc.conn.Close()
+				if err != nil {
+					p.logger.Sugar().Errorf("close connection %d: %v", pc.id, err)
+				}
+				p.metrics.Connections.Dec()
+			}
+			p.metrics.Channels.Sub(float64(pc.channels))
+			pc.channels = 0
+		}
+	})
+	return nil
+}
+
+// Channel opens channel on the healthy connection with the fewest channels
+func (p *ConnectionPool) Channel() (*PooledChannel, error) {
+	return p.channel(p.connections)
+}
+
+// PinnedChannel opens channel on the first connection of the pool. Exclusive queue is accessible only through
+// the connection which declared it and is deleted by the broker when that connection is lost
+func (p *ConnectionPool) PinnedChannel() (*PooledChannel, error) {
+	return p.channel(p.connections[:1])
+}
+
+func (p *ConnectionPool) channel(connections []*pooledConnection) (*PooledChannel, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.closed {
+		return nil, fmt.Errorf("connection pool is closed")
+	}
+
+	var (
+		least   *pooledConnection
+		healthy int
+	)
+	for _, pc := range connections {
+		if pc.conn == nil || pc.conn.IsClosed() {
+			continue
+		}
+		healthy++
+
+		if pc.channels >= p.channelMax {
+			continue
+		}
+		if least == nil || pc.channels < least.channels {
+			least = pc
+		}
+	}
+
+	if healthy == 0 {
+		return nil, fmt.Errorf("no healthy connection in the pool")
+	}
+	if least == nil {
+		p.metrics.ChannelsExhausted.Inc()
+		return nil, fmt.Errorf("all %d connections reached channel max %d", healthy, p.channelMax)
+	}
+
+	channel, err := least.conn.Channel()
+	if err != nil {
+		return nil, fmt.Errorf("open channel on connection %d: %w", least.id, err)
+	}
+
+	least.channels++
+	p.metrics.Channels.Inc()
+
+	return &PooledChannel{
+		Channel:    channel,
+		pool:       p,
+		connection: least,
+		generation: least.generation,
+	}, nil
+}
+
+// Backoff returns delay before the attempt to take a channel again
+func (p *ConnectionPool) Backoff(attempt int) time.Duration {
+	return broker.Backoff(p.initialBackoff, p.maxBackoff, attempt)
+}
+
+// ConsumerRestarted records that consumer was re-established after its channel was closed
+func (p *ConnectionPool) ConsumerRestarted() {
+	p.metrics.ConsumerRestarts.Inc()
+}
+
+func (p *ConnectionPool) release(pc *pooledConnection, generation int) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	// channels of the lost connection are already released
+	if p.closed || pc.generation != generation {
+		return
+	}
+
+	pc.channels--
+	p.metrics.Channels.Dec()
+}
+
+func (p *ConnectionPool) healthCheck() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	for _, pc := range p.connections {
+		if pc.reconnecting || (pc.conn != nil && !pc.conn.IsClosed()) {
+			continue
+		}
+
+		p.logger.Sugar().Warnf("health check: connection %d is closed", pc.id)
+		p.lost(pc)
+	}
+}
+
+// attach puts connection to the pool and watches for its close, it must be called under the lock
+// or before the pool is shared
+func (p *ConnectionPool) attach(pc *pooledConnection, conn *amqp.Connection) {
+	pc.conn = conn
+	pc.generation++
+	p.metrics.Connections.Inc()
+
+	go p.watch(pc, conn, conn.NotifyClose(make(chan *amqp.Error, 1)))
+}
+
+func (p *ConnectionPool) watch(pc *pooledConnection, conn *amqp.Connection, closeCh chan *amqp.Error) {
+	amqpErr, ok := <-closeCh
+	if !ok || amqpErr == nil {
+		// connection is closed by the pool
+		return
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	// connection may be already found closed by the health check
+	if p.closed || pc.conn != conn {
+		return
+	}
+
+	p.logger.Sugar().Warnf("connection %d closed: %v", pc.id, amqpErr)
+	p.lost(pc)
+}
+
+// lost forgets channels of the connection and starts reconnecting it, it must be called under the lock
+func (p *ConnectionPool) lost(pc *pooledConnection) {
+	if pc.conn != nil {
+		p.metrics.Connections.Dec()
+	}
+	p.metrics.ConnectionsLost.Inc()
+	p.metrics.Channels.Sub(float64(pc.channels))
+
+	pc.conn = nil
+	pc.channels = 0
+	pc.generation++
+	pc.reconnecting = true
+
+	go p.reconnect(pc)
+}
+
+func (p *ConnectionPool) reconnect(pc *pooledConnection) {
+	for attempt := 1; ; attempt++ {
+		select {
+		case <-p.done:
+			return
+		case <-time.After(p.Backoff(attempt)):
+		}
+
+		conn, err := amqp.Dial(p.address)
+		if err != nil {
+			p.metrics.ReconnectFailures.Inc()
+			p.logger.Sugar().Errorf("reconnect connection %d: %v", pc.id, err)
+			continue
+		}
+
+		p.mutex.Lock()
+		if p.closed {
+			p.mutex.Unlock()
+			conn.Close()
+			return
+		}
+
+		p.attach(pc, conn)
+		pc.reconnecting = false
+		p.metrics.Reconnects.Inc()
+		p.mutex.Unlock()
+
+		p.logger.Sugar().Infof("connection %d reconnected after %d attempts", pc.id, attempt)
+		return
+	}
+}
+
+// PooledChannel is a channel taken from the pool, it must be closed to be returned to the pool
+type PooledChannel struct {
+	*amqp.Channel
+
+	pool       *ConnectionPool
+	connection *pooledConnection
+	generation int
+	once       sync.Once
+}
+
+func (c *PooledChannel) Close() error {
+	var err error
+	c.once.Do(func() {
+		if !c.Channel.IsClosed() {
+			err = c.Channel.Close()
+		}
+		c.pool.release(c.connection, c.generation)
+	})
+	return err
+}
@@ -0,0 +1,284 @@
+package rabbit
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+const (
+	testBackoff = 100 * time.Millisecond
+	testWait    = 5 * time.Second
+
+	frameMethod = 1
+	frameEnd    = 0xCE
+
+	classConnection = 10
+	classChannel    = 20
+)
+
+// fakeServer speaks enough of AMQP 0-9-1 to open connections and channels, so the pool is tested without a broker
+type fakeServer struct {
+	listener net.Listener
+
+	conns    []net.Conn
+	accepted int
+	mutex    sync.Mutex
+}
+
+func runFakeServer(t *testing.T) *fakeServer {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+
+	s := &fakeServer{listener: listener}
+	go s.accept()
+	t.Cleanup(func() {
+		listener.Close()
+		s.drop()
+	})
+	return s
+}
+
+func (s *fakeServer) url() string {
+	return fmt.Sprintf("amqp://guest:guest@%s/", s.listener.Addr())
+}
+
+func (s *fakeServer) accept() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		s.mutex.Lock()
+		s.conns = append(s.conns, conn)
+		s.accepted++
+		s.mutex.Unlock()
+
+		go s.serve(conn)
+	}
+}
+
+// drop closes connections without closing handshake, as a lost network does
+func (s *fakeServer) drop() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, conn := range s.conns {
+		conn.Close()
+	}
+	s.conns = nil
+}
+
+func (s *fakeServer) acceptedCount() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.accepted
+}
+
+func (s *fakeServer) serve(conn net.Conn) {
+	defer conn.Close()
+
+	reader := bufio.NewReader(conn)
+	header := make([]byte, 8)
+	if _, err := io.ReadFull(reader, header); err != nil {
+		return
+	}
+
+	// connection.start: version 0-9, no server properties, plain mechanism, en_US locale
+	start := []byte{0, 9}
+	start = binary.BigEndian.AppendUint32(start, 0)
+	start = appendLongString(start, "PLAIN")
+	start = appendLongString(start, "en_US")
+	writeMethod(conn, 0, classConnection, 10, start)
+
+	for {
+		frameType, channel, payload, err := readFrame(reader)
+		if err != nil {
+			return
+		}
+		if frameType != frameMethod || len(payload) < 4 {
+			continue
+		}
+
+		class, method := binary.BigEndian.Uint16(payload), binary.BigEndian.Uint16(payload[2:])
+		switch {
+		case class == classConnection && method == 11:
+			// connection.tune: no channel max, frame max 128k, no heartbeat
+			tune := binary.BigEndian.AppendUint16(nil, 0)
+			tune = binary.BigEndian.AppendUint32(tune, 131072)
+			tune = binary.BigEndian.AppendUint16(tune, 0)
+			writeMethod(conn, 0, classConnection, 30, tune)
+		case class == classConnection && method == 40:
+			writeMethod(conn, 0, classConnection, 41, []byte{0})
+		case class == classConnection && method == 50:
+			writeMethod(conn, 0, classConnection, 51, nil)
+			return
+		case class == classChannel && method == 10:
+			writeMethod(conn, channel, classChannel, 11, appendLongString(nil, ""))
+		case class == classChannel && method == 40:
+			writeMethod(conn, channel, classChannel, 41, nil)
+		}
+	}
+}
+
+func readFrame(reader *bufio.Reader) (byte, uint16, []byte, error) {
+	header := make([]byte, 7)
+	if _, err := io.ReadFull(reader, header); err != nil {
+		return 0, 0, nil, err
+	}
+
+	payload := make([]byte, binary.BigEndian.Uint32(header[3:])+1)
+	if _, err := io.ReadFull(reader, payload); err != nil {
+		return 0, 0, nil, err
+	}
+	return header[0], binary.BigEndian.Uint16(header[1:]), payload[:len(payload)-1], nil
+}
+
+func writeMethod(w io.Writer, channel uint16, class uint16, method uint16, args []byte) {
+	payload := binary.BigEndian.AppendUint16(nil, class)
+	payload = binary.BigEndian.AppendUint16(payload, method)
+	payload = append(payload, args...)
+
+	frame := []byte{frameMethod}
+	frame = binary.BigEndian.AppendUint16(frame, channel)
+	frame = binary.BigEndian.AppendUint32(frame, uint32(len(payload)))
+	frame = append(frame, payload...)
+	frame = append(frame, frameEnd)
+	_, _ = w.Write(frame)
+}
+
+func appendLongString(b []byte, s string) []byte {
+	b = binary.BigEndian.AppendUint32(b, uint32(len(s)))
+	return append(b, s...)
+}
+
+func newTestPool(t *testing.T, url string, size int, channelMax int) *ConnectionPool {
+	t.Helper()
+
+	pool, err := NewConnectionPool(
+		zap.NewNop(),
+		NewPoolMetrics(prometheus.NewRegistry()),
+		url,
+		size,
+		channelMax,
+		time.Hour,
+		testBackoff,
+		testBackoff,
+	)
+	if err != nil {
+		t.Fatalf("new connection pool: %v", err)
+	}
+	t.Cleanup(func() { pool.Close() })
+	return pool
+}
+
+// connectionState returns state of the pooled connection under the pool lock
+func connectionState(pool *ConnectionPool, id int) (healthy bool, reconnecting bool, channels int) {
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+
+	pc := pool.connections[id]
+	return pc.conn != nil && !pc.conn.IsClosed(), pc.reconnecting, pc.channels
+}
+
+func waitConnection(t *testing.T, pool *ConnectionPool, id int, healthy bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(testWait)
+	for time.Now().Before(deadline) {
+		if current, _, _ := connectionState(pool, id); current == healthy {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("connection %d is not healthy: %v", id, !healthy)
+}
+
+func TestPoolReconnectsLostConnection(t *testing.T) {
+	server := runFakeServer(t)
+	pool := newTestPool(t, server.url(), 1, 8)
+
+	lost, err := pool.Channel()
+	if err != nil {
+		t.Fatalf("channel: %v", err)
+	}
+
+	// channels of the lost connection are forgotten and no channel is handed out until it is reconnected
+	server.drop()
+	waitConnection(t, pool, 0, false)
+	if _, reconnecting, channels := connectionState(pool, 0); !reconnecting || channels != 0 {
+		t.Fatalf("lost connection: reconnecting %v, channels %d", reconnecting, channels)
+	}
+	if _, err = pool.Channel(); err == nil {
+		t.Fatalf("channel is opened on the lost connection")
+	}
+
+	waitConnection(t, pool, 0, true)
+	if server.acceptedCount() != 2 {
+		t.Fatalf("accepted connections: expected 2, got %d", server.acceptedCount())
+	}
+
+	channel, err := pool.Channel()
+	if err != nil {
+		t.Fatalf("channel after reconnect: %v", err)
+	}
+
+	// channel of the previous connection does not release channel of the new one
+	_ = lost.Close()
+	if _, _, channels := connectionState(pool, 0); channels != 1 {
+		t.Fatalf("channels after reconnect: expected 1, got %d", channels)
+	}
+
+	err = channel.Close()
+	if err != nil {
+		t.Fatalf("close channel: %v", err)
+	}
+	if _, _, channels := connectionState(pool, 0); channels != 0 {
+		t.Fatalf("channels after close: expected 0, got %d", channels)
+	}
+}
+
+func TestPoolSpreadsChannelsUpToChannelMax(t *testing.T) {
+	server := runFakeServer(t)
+	pool := newTestPool(t, server.url(), 2, 1)
+
+	first, err := pool.Channel()
+	if err != nil {
+		t.Fatalf("channel: %v", err)
+	}
+	second, err := pool.Channel()
+	if err != nil {
+		t.Fatalf("channel: %v", err)
+	}
+	if first.connection == second.connection {
+		t.Fatalf("channels are opened on the same connection")
+	}
+
+	// every connection reached channel max
+	if _, err = pool.Channel(); err == nil {
+		t.Fatalf("channel is opened over channel max")
+	}
+
+	_ = first.Close()
+	third, err := pool.Channel()
+	if err != nil {
+		t.Fatalf("channel after release: %v", err)
+	}
+	if third.connection != first.connection {
+		t.Fatalf("channel is not opened on the released connection")
+	}
+}
@@ -0,0 +1,97 @@
+package rabbit
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	xerrors "github.com/syth0le/gopnik/errors"
+	"go.uber.org/zap"
+
+	"github.com/syth0le/realtime-notification-service/internal/clients/broker"
+)
+
+// PublisherImpl publishes messages to the exchange named by the message topic with the message key as routing key,
+// exchange is declared as durable topic exchange on the first publish to it unless it is declared by the node topology
+type PublisherImpl struct {
+	logger *zap.Logger
+	pool   *ConnectionPool
+
+	channel  *PooledChannel
+	declared map[string]struct{} // exchanges declared on the current channel
+	topology map[string]struct{} // exchanges declared by subscribers with their own arguments
+
+	mutex sync.Mutex
+}
+
+func NewRabbitPublisher(logger *zap.Logger, pool *ConnectionPool, topologyExchanges []string) (broker.Publisher, error) {
+	publisher := &PublisherImpl{
+		logger:   logger,
+		pool:     pool,
+		declared: make(map[string]struct{}),
+		topology: make(map[string]struct{}, len(topologyExchanges)),
+		mutex:    sync.Mutex{},
+	}
+	for _, exchange := range topologyExchanges {
+		publisher.topology[exchange] = struct{}{}
+	}
+
+	err := publisher.connect()
+	if err != nil {
+		return nil, xerrors.WrapInternalError(fmt.Errorf("cannot create publisher: %w", err))
+	}
+
+	return publisher, nil
+}
+
+func (p *PublisherImpl) Publish(ctx context.Context, msg *broker.Message) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.channel == nil || p.channel.IsClosed() {
+		p.logger.Warn("publisher channel is closed, reconnecting")
+		if p.channel != nil {
+			p.channel.Close()
+		}
+
+		err := p.connect()
+		if err != nil {
+			return err
+		}
+	}
+
+	_, declared := p.declared[msg.Topic]
+	_, topology := p.topology[msg.Topic]
+	if !declared && !topology {
+		err := p.channel.ExchangeDeclare(msg.Topic, amqp.ExchangeTopic, true, false, false, false, nil)
+		if err != nil {
+			return fmt.Errorf("exchange declare %s: %w", msg.Topic, err)
+		}
+		p.declared[msg.Topic] = struct{}{}
+	}
+
+	return p.channel.PublishWithContext(ctx, msg.Topic, msg.Key, false, false, publishingFromMessage(msg))
+}
+
+func (p *PublisherImpl) Close() error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.channel == nil {
+		return nil
+	}
+	return p.channel.Close()
+}
+
+// connect takes channel from the pool, exchanges are declared again on the new channel
+func (p *PublisherImpl) connect() error {
+	channel, err := p.pool.Channel()
+	if err != nil {
+		return fmt.Errorf("take channel: %w", err)
+	}
+
+	p.channel = channel
+	p.declared = make(map[string]struct{})
+	return nil
+}
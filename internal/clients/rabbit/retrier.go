@@ -0,0 +1,380 @@
+package rabbit
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	xerrors "github.com/syth0le/gopnik/errors"
+	"go.uber.org/zap"
+
+	"github.com/syth0le/realtime-notification-service/internal/clients/broker"
+	"github.com/syth0le/realtime-notification-service/internal/utils"
+)
+
+const defaultPublishTimeout = 5 * time.Second
+
+// Retrier republishes failed deliveries through delay queues with exponential backoff,
+// deliveries which are malformed or exhausted max attempts are published to the dead-letter exchange
+type Retrier interface {
+	broker.Retrier
+	broker.DeadLetters
+}
+
+type RetrierImpl struct {
+	logger *zap.Logger
+	pool   *ConnectionPool
+
+	queueName          string
+	exchangeName       string
+	deadLetterExchange string
+	deadLetterQueue    string
+
+	maxAttempts  int
+	initialDelay time.Duration
+	maxDelay     time.Duration
+
+	channel *PooledChannel
+
+	mutex sync.Mutex
+}
+
+// NewRabbitRetrier declares dead-letter exchange with its queue and delay queue for every backoff step.
+// Delay queue dead-letters expired messages back to the source exchange with the original routing key
+func NewRabbitRetrier(
+	logger *zap.Logger,
+	enable bool,
+	pool *ConnectionPool,
+	queueName string,
+	exchangeName string,
+	deadLetterExchange string,
+	deadLetterQueue string,
+	maxAttempts int,
+	initialDelay time.Duration,
+	maxDelay time.Duration,
+) (Retrier, error) {
+	if !enable {
+		return &RetrierMock{
+			Logger: logger,
+		}, nil
+	}
+
+	retrier := &RetrierImpl{
+		logger:             logger,
+		pool:               pool,
+		queueName:          queueName,
+		exchangeName:       exchangeName,
+		deadLetterExchange: deadLetterExchange,
+		deadLetterQueue:    deadLetterQueue,
+		maxAttempts:        maxAttempts,
+		initialDelay:       initialDelay,
+		maxDelay:           maxDelay,
+		mutex:              sync.Mutex{},
+	}
+
+	err := retrier.connect()
+	if err != nil {
+		return nil, xerrors.WrapInternalError(fmt.Errorf("cannot create retrier: %w", err))
+	}
+
+	return retrier, nil
+}
+
+// Retry publishes message to delay queue of the next attempt, message is dead-lettered after max attempts
+func (r *RetrierImpl) Retry(msg *broker.Message, reason string) error {
+	attempts := msg.Attempts() + 1
+	if attempts >= r.maxAttempts {
+		return r.DeadLetter(msg, reason)
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	retried := msg.Clone(nil)
+	retried.Headers[broker.AttemptsHeader] = int32(attempts)
+
+	err := r.publish(r.delayExchange(broker.Backoff(r.initialDelay, r.maxDelay, attempts)), retried)
+	if err != nil {
+		return fmt.Errorf("publish retry: %w", err)
+	}
+
+	r.logger.Sugar().Debugf("retry %s attempt %d: %s", msg.ID, attempts, reason)
+	return nil
+}
+
+func (r *RetrierImpl) DeadLetter(msg *broker.Message, reason string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	letter := msg.Clone(nil)
+	// dead letters are addressed by message id
+	if letter.ID == "" {
+		letter.ID = utils.GenerateEUID()
+	}
+	letter.Headers[broker.AttemptsHeader] = int32(msg.Attempts() + 1)
+	letter.Headers[broker.DeadLetterReasonHeader] = reason
+	letter.Headers[broker.OriginalTopicHeader] = msg.Topic
+	letter.Headers[broker.OriginalKeyHeader] = msg.Key
+
+	err := r.publish(r.deadLetterExchange, letter)
+	if err != nil {
+		return fmt.Errorf("publish dead letter: %w", err)
+	}
+
+	r.logger.Sugar().Warnf("dead-lettered %s: %s", letter.ID, reason)
+	return nil
+}
+
+// ListDeadLetters returns up to limit dead letters from the head of the queue, messages stay in the queue
+func (r *RetrierImpl) ListDeadLetters(limit int) ([]*broker.DeadLetter, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	var res []*broker.DeadLetter
+	err := r.browse(func(d amqp.Delivery) (bool, bool) {
+		res = append(res, deadLetterFromDelivery(d))
+		return false, len(res) >= limit
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func (r *RetrierImpl) GetDeadLetter(messageID string) (*broker.DeadLetter, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	var res *broker.DeadLetter
+	err := r.browse(func(d amqp.Delivery) (bool, bool) {
+		if d.MessageId != messageID {
+			return false, false
+		}
+		res = deadLetterFromDelivery(d)
+		return false, true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if res == nil {
+		return nil, xerrors.WrapNotFoundError(fmt.Errorf("not found dead letter %s", messageID), "not found dead letter")
+	}
+	return res, nil
+}
+
+// ReplayDeadLetter publishes dead letter to its original exchange with reset attempts and removes it from the queue
+func (r *RetrierImpl) ReplayDeadLetter(messageID string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	var (
+		found     bool
+		replayErr error
+	)
+	err := r.browse(func(d amqp.Delivery) (bool, bool) {
+		if d.MessageId != messageID {
+			return false, false
+		}
+		found = true
+
+		letter := deadLetterFromDelivery(d)
+		msg := messageFromDelivery(d).Clone(nil)
+		msg.Topic = letter.Topic
+		msg.Key = letter.Key
+		delete(msg.Headers, broker.AttemptsHeader)
+		delete(msg.Headers, broker.DeadLetterReasonHeader)
+		delete(msg.Headers, broker.OriginalTopicHeader)
+		delete(msg.Headers, broker.OriginalKeyHeader)
+
+		replayErr = r.publish(msg.Topic, msg)
+		return replayErr == nil, true
+	})
+	if err != nil {
+		return err
+	}
+
+	if !found {
+		return xerrors.WrapNotFoundError(fmt.Errorf("not found dead letter %s", messageID), "not found dead letter")
+	}
+	if replayErr != nil {
+		return fmt.Errorf("publish replay: %w", replayErr)
+	}
+
+	r.logger.Sugar().Infof("replayed dead letter %s", messageID)
+	return nil
+}
+
+func (r *RetrierImpl) Close() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.channel == nil {
+		return nil
+	}
+	return r.channel.Close()
+}
+
+// browse gets messages of the dead-letter queue one by one until visit stops it or the queue is over.
+// Message is acked if visit removes it, all other visited messages are returned to the queue
+func (r *RetrierImpl) browse(visit func(d amqp.Delivery) (remove bool, stop bool)) error {
+	err := r.ensureConnected()
+	if err != nil {
+		return err
+	}
+
+	var lastTag uint64
+	defer func() {
+		if lastTag != 0 {
+			err := r.channel.Nack(lastTag, true, true)
+			if err != nil {
+				r.logger.Sugar().Errorf("requeue dead letters: %v", err)
+			}
+		}
+	}()
+
+	for {
+		d, ok, err := r.channel.Get(r.deadLetterQueue, false)
+		if err != nil {
+			return fmt.Errorf("get dead letter: %w", err)
+		}
+		if !ok {
+			return nil
+		}
+
+		remove, stop := visit(d)
+		if remove {
+			err = r.channel.Ack(d.DeliveryTag, false)
+			if err != nil {
+				return fmt.Errorf("ack dead letter: %w", err)
+			}
+		} else {
+			lastTag = d.DeliveryTag
+		}
+
+		if stop {
+			return nil
+		}
+	}
+}
+
+// publish publishes message to the exchange with the message routing key
+func (r *RetrierImpl) publish(exchange string, msg *broker.Message) error {
+	err := r.ensureConnected()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), defaultPublishTimeout)
+	defer cancel()
+
+	return r.channel.PublishWithContext(ctx, exchange, msg.Key, false, false, publishingFromMessage(msg))
+}
+
+func (r *RetrierImpl) delayExchange(delay time.Duration) string {
+	return fmt.Sprintf("%s.retry.%d", r.queueName, delay.Milliseconds())
+}
+
+func (r *RetrierImpl) ensureConnected() error {
+	if r.channel != nil && !r.channel.IsClosed() {
+		return nil
+	}
+
+	r.logger.Warn("retrier channel is closed, reconnecting")
+	if r.channel != nil {
+		r.channel.Close()
+	}
+	return r.connect()
+}
+
+// connect takes channel from the pool and declares dead-letter and delay topology
+func (r *RetrierImpl) connect() error {
+	channel, err := r.pool.Channel()
+	if err != nil {
+		return fmt.Errorf("take channel: %w", err)
+	}
+
+	err = r.declare(channel)
+	if err != nil {
+		channel.Close()
+		return err
+	}
+
+	r.channel = channel
+	return nil
+}
+
+func (r *RetrierImpl) declare(channel *PooledChannel) error {
+	err := channel.ExchangeDeclare(r.deadLetterExchange, amqp.ExchangeFanout, true, false, false, false, nil)
+	if err != nil {
+		return fmt.Errorf("dead-letter exchange declare: %w", err)
+	}
+
+	_, err = channel.QueueDeclare(r.deadLetterQueue, true, false, false, false, nil)
+	if err != nil {
+		return fmt.Errorf("dead-letter queue declare: %w", err)
+	}
+
+	err = channel.QueueBind(r.deadLetterQueue, "", r.deadLetterExchange, false, nil)
+	if err != nil {
+		return fmt.Errorf("dead-letter queue bind: %w", err)
+	}
+
+	declared := make(map[time.Duration]struct{})
+	for attempt := 1; attempt < r.maxAttempts; attempt++ {
+		delay := broker.Backoff(r.initialDelay, r.maxDelay, attempt)
+		if _, ok := declared[delay]; ok {
+			continue
+		}
+		declared[delay] = struct{}{}
+
+		name := r.delayExchange(delay)
+		err = channel.ExchangeDeclare(name, amqp.ExchangeFanout, true, false, false, false, nil)
+		if err != nil {
+			return fmt.Errorf("delay exchange declare %s: %w", name, err)
+		}
+
+		// expired message is dead-lettered with its routing key, so it reaches the same bindings again
+		_, err = channel.QueueDeclare(name, true, false, false, false, amqp.Table{
+			"x-message-ttl":          delay.Milliseconds(),
+			"x-dead-letter-exchange": r.exchangeName,
+		})
+		if err != nil {
+			return fmt.Errorf("delay queue declare %s: %w", name, err)
+		}
+
+		err = channel.QueueBind(name, "", name, false, nil)
+		if err != nil {
+			return fmt.Errorf("delay queue bind %s: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+func deadLetterFromDelivery(d amqp.Delivery) *broker.DeadLetter {
+	msg := messageFromDelivery(d)
+	letter := &broker.DeadLetter{
+		MessageID: msg.ID,
+		Topic:     msg.Topic,
+		Key:       msg.Key,
+		Attempts:  msg.Attempts(),
+		Timestamp: msg.Timestamp,
+		Headers:   msg.Clone(nil).Headers,
+		Body:      msg.Body,
+	}
+
+	if exchange, ok := d.Headers[broker.OriginalTopicHeader].(string); ok {
+		letter.Topic = exchange
+	}
+	if routingKey, ok := d.Headers[broker.OriginalKeyHeader].(string); ok {
+		letter.Key = routingKey
+	}
+	if reason, ok := d.Headers[broker.DeadLetterReasonHeader].(string); ok {
+		letter.Reason = reason
+	}
+	return letter
+}
@@ -0,0 +1,51 @@
+package rabbit
+
+import (
+	"fmt"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// Topology is the exchange and the queue bound to it, every consumer and binder of the queue declare
+// the same topology, otherwise the broker rejects the declaration with precondition failed
+type Topology struct {
+	ExchangeName    string
+	ExchangeKind    string // topic, direct, fanout or headers
+	ExchangeDurable bool
+	ExchangeArgs    amqp.Table // e.g. alternate-exchange of unroutable messages
+
+	QueueName       string
+	QueueDurable    bool
+	QueueAutoDelete bool
+	QueueExclusive  bool // queue is used only through the first connection of the pool
+	QueueArgs       amqp.Table
+}
+
+// Declare declares exchange and queue, queue is bound to the exchange with the routing key if it is set
+func (t *Topology) Declare(channel *PooledChannel, routingKey string) error {
+	err := channel.ExchangeDeclare(t.ExchangeName, t.ExchangeKind, t.ExchangeDurable, false, false, false, t.ExchangeArgs)
+	if err != nil {
+		return fmt.Errorf("exchange declare: %w", err)
+	}
+
+	_, err = channel.QueueDeclare(t.QueueName, t.QueueDurable, t.QueueAutoDelete, t.QueueExclusive, false, t.QueueArgs)
+	if err != nil {
+		return fmt.Errorf("queue declare: %w", err)
+	}
+
+	if routingKey != "" {
+		err = channel.QueueBind(t.QueueName, routingKey, t.ExchangeName, false, nil)
+		if err != nil {
+			return fmt.Errorf("queue bind %s: %w", routingKey, err)
+		}
+	}
+	return nil
+}
+
+// Channel takes channel of the pool the queue is accessible through
+func (t *Topology) Channel(pool *ConnectionPool) (*PooledChannel, error) {
+	if t.QueueExclusive {
+		return pool.PinnedChannel()
+	}
+	return pool.Channel()
+}
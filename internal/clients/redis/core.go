@@ -0,0 +1,131 @@
+package redis
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	goredis "github.com/redis/go-redis/v9"
+
+	"github.com/syth0le/realtime-notification-service/internal/clients/broker"
+)
+
+type Mode string
+
+const (
+	PubSubMode  Mode = "pubsub"
+	StreamsMode Mode = "streams"
+)
+
+func (m Mode) Validate() error {
+	switch m {
+	case PubSubMode, StreamsMode:
+		return nil
+	default:
+		return fmt.Errorf("unexpected redis mode: %s", m)
+	}
+}
+
+// stream entry fields, unknown fields are message headers
+const (
+	KeyField         = "key"
+	BodyField        = "body"
+	MessageIDField   = "message_id"
+	ContentTypeField = "content_type"
+
+	headerFieldPrefix = "header:"
+	userChannelToken  = "user"
+)
+
+// UserChannel returns pub/sub channel notifications of the user are published to, e.g. notifications:user:<id>
+func UserChannel(prefix string, userID string) string {
+	return fmt.Sprintf("%s:%s:%s", prefix, userChannelToken, userID)
+}
+
+// UserPattern returns pub/sub pattern matching channels of all users
+func UserPattern(prefix string) string {
+	return UserChannel(prefix, "*")
+}
+
+func messageFromPubSub(prefix string, m *goredis.Message) *broker.Message {
+	msg := broker.NewMessage(&pubSubSettler{})
+	msg.Topic = m.Channel
+	msg.Key = strings.TrimPrefix(m.Channel, fmt.Sprintf("%s:%s:", prefix, userChannelToken))
+	msg.Headers = make(map[string]any)
+	msg.Timestamp = time.Now()
+	msg.Body = []byte(m.Payload)
+	return msg
+}
+
+// pubSubSettler does nothing, pub/sub delivery is at most once
+type pubSubSettler struct{}
+
+func (s *pubSubSettler) Ack() error {
+	return nil
+}
+
+func (s *pubSubSettler) Nack() error {
+	return nil
+}
+
+func (s *pubSubSettler) Requeue() error {
+	return fmt.Errorf("pub/sub message cannot be requeued")
+}
+
+func messageFromEntry(stream string, entry goredis.XMessage, settler broker.Settler) *broker.Message {
+	msg := broker.NewMessage(settler)
+	msg.ID = entry.ID
+	msg.Topic = stream
+	msg.Headers = make(map[string]any)
+	msg.Timestamp = timestampFromEntryID(entry.ID)
+
+	for field, raw := range entry.Values {
+		value := fmt.Sprint(raw)
+		switch {
+		case field == KeyField:
+			msg.Key = value
+		case field == BodyField:
+			msg.Body = []byte(value)
+		case field == MessageIDField:
+			msg.ID = value
+		case field == ContentTypeField:
+			msg.ContentType = value
+		case field == headerFieldPrefix+broker.AttemptsHeader:
+			attempts, err := strconv.Atoi(value)
+			if err == nil {
+				msg.Headers[broker.AttemptsHeader] = attempts
+			}
+		case strings.HasPrefix(field, headerFieldPrefix):
+			msg.Headers[strings.TrimPrefix(field, headerFieldPrefix)] = value
+		}
+	}
+	return msg
+}
+
+func valuesFromMessage(msg *broker.Message) map[string]any {
+	values := map[string]any{
+		KeyField:  msg.Key,
+		BodyField: msg.Body,
+	}
+	if msg.ID != "" {
+		values[MessageIDField] = msg.ID
+	}
+	if msg.ContentType != "" {
+		values[ContentTypeField] = msg.ContentType
+	}
+	for key, value := range msg.Headers {
+		values[headerFieldPrefix+key] = fmt.Sprint(value)
+	}
+	return values
+}
+
+// timestampFromEntryID returns time of the entry, entry id is <milliseconds>-<sequence>
+func timestampFromEntryID(id string) time.Time {
+	millis, _, _ := strings.Cut(id, "-")
+	ms, err := strconv.ParseInt(millis, 10, 64)
+	if err != nil {
+		return time.Time{}
+	}
+	return time.UnixMilli(ms)
+}
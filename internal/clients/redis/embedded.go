@@ -0,0 +1,46 @@
+package redis
+
+import (
+	"fmt"
+
+	"github.com/alicebob/miniredis/v2"
+	xerrors "github.com/syth0le/gopnik/errors"
+	"go.uber.org/zap"
+)
+
+// EmbeddedServer is redis-compatible in-memory server running in the process, it is used for local runs.
+// Its data is lost on restart
+type EmbeddedServer struct {
+	logger *zap.Logger
+	server *miniredis.Miniredis
+}
+
+// NewEmbeddedServer starts server listening on the address, random port is used if the address is empty
+func NewEmbeddedServer(logger *zap.Logger, address string) (*EmbeddedServer, error) {
+	srv := miniredis.NewMiniRedis()
+
+	if address == "" {
+		address = "127.0.0.1:0"
+	}
+	err := srv.StartAddr(address)
+	if err != nil {
+		return nil, xerrors.WrapInternalError(fmt.Errorf("cannot start embedded redis: %w", err))
+	}
+
+	logger.Sugar().Infof("embedded redis is listening on %s", srv.Addr())
+	return &EmbeddedServer{
+		logger: logger,
+		server: srv,
+	}, nil
+}
+
+// Addr returns address to connect to the server
+func (s *EmbeddedServer) Addr() string {
+	return s.server.Addr()
+}
+
+func (s *EmbeddedServer) Close() error {
+	s.server.Close()
+	s.logger.Info("embedded redis is stopped")
+	return nil
+}
@@ -0,0 +1,42 @@
+package redis
+
+import (
+	"context"
+
+	goredis "github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+
+	"github.com/syth0le/realtime-notification-service/internal/clients/broker"
+)
+
+// PublisherImpl adds message to the stream named by its topic, in pub/sub mode only the body
+// is published to the channel named by its topic
+type PublisherImpl struct {
+	logger *zap.Logger
+	client *goredis.Client
+	mode   Mode
+}
+
+func NewRedisPublisher(logger *zap.Logger, client *goredis.Client, mode Mode) broker.Publisher {
+	return &PublisherImpl{
+		logger: logger,
+		client: client,
+		mode:   mode,
+	}
+}
+
+func (p *PublisherImpl) Publish(ctx context.Context, msg *broker.Message) error {
+	if p.mode == PubSubMode {
+		return p.client.Publish(ctx, msg.Topic, msg.Body).Err()
+	}
+
+	return p.client.XAdd(ctx, &goredis.XAddArgs{
+		Stream: msg.Topic,
+		Values: valuesFromMessage(msg),
+	}).Err()
+}
+
+// Close does nothing, client is shared and closed by its owner
+func (p *PublisherImpl) Close() error {
+	return nil
+}
@@ -0,0 +1,91 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	goredis "github.com/redis/go-redis/v9"
+	xerrors "github.com/syth0le/gopnik/errors"
+	"go.uber.org/zap"
+
+	"github.com/syth0le/realtime-notification-service/internal/clients/broker"
+)
+
+// PubSubImpl subscribes to user channels, delivery is at most once and messages published while
+// the node is not subscribed are lost. If per user channels are enabled, it is the binder of the node as well,
+// so the node gets only notifications of the users connected to it
+type PubSubImpl struct {
+	logger *zap.Logger
+	pubsub *goredis.PubSub
+
+	prefix  string
+	perUser bool
+
+	done chan struct{}
+	once sync.Once
+}
+
+func NewRedisPubSub(
+	logger *zap.Logger,
+	client *goredis.Client,
+	prefix string,
+	perUser bool,
+) (*PubSubImpl, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultCommandTimeout)
+	defer cancel()
+
+	pubsub := client.Subscribe(ctx)
+	if !perUser {
+		err := pubsub.PSubscribe(ctx, UserPattern(prefix))
+		if err != nil {
+			return nil, xerrors.WrapInternalError(fmt.Errorf("cannot subscribe: %w", err))
+		}
+	}
+
+	return &PubSubImpl{
+		logger:  logger,
+		pubsub:  pubsub,
+		prefix:  prefix,
+		perUser: perUser,
+		done:    make(chan struct{}),
+	}, nil
+}
+
+func (s *PubSubImpl) Run(handler broker.Handler) error {
+	channel := s.pubsub.Channel()
+	for {
+		select {
+		case <-s.done:
+			return nil
+		case m, ok := <-channel:
+			if !ok {
+				return nil
+			}
+			handler(messageFromPubSub(s.prefix, m))
+		}
+	}
+}
+
+func (s *PubSubImpl) Bind(key string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultCommandTimeout)
+	defer cancel()
+
+	return s.pubsub.Subscribe(ctx, UserChannel(s.prefix, key))
+}
+
+func (s *PubSubImpl) Unbind(key string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultCommandTimeout)
+	defer cancel()
+
+	return s.pubsub.Unsubscribe(ctx, UserChannel(s.prefix, key))
+}
+
+func (s *PubSubImpl) Close() error {
+	var err error
+	s.once.Do(func() {
+		close(s.done)
+		err = s.pubsub.Close()
+	})
+	return err
+}
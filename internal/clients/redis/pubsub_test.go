@@ -0,0 +1,119 @@
+package redis
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	goredis "github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+
+	"github.com/syth0le/realtime-notification-service/internal/clients/broker/brokertest"
+)
+
+func runPubSub(t *testing.T, client *goredis.Client, perUser bool) (*PubSubImpl, *brokertest.Subscription) {
+	t.Helper()
+
+	pubsub, err := NewRedisPubSub(zap.NewNop(), client, testPrefix, perUser)
+	if err != nil {
+		t.Fatalf("new pubsub: %v", err)
+	}
+
+	s := brokertest.NewSubscription(t, testWait, testQuiet)
+	s.Run(pubsub)
+	return pubsub, s
+}
+
+func TestPubSubPerUserChannels(t *testing.T) {
+	client := newClient(t)
+
+	first, firstMessages := runPubSub(t, client, true)
+	second, secondMessages := runPubSub(t, client, true)
+	brokertest.Bind(t, first, "alice", "carol")
+	brokertest.Bind(t, second, "bob", "carol")
+	waitSubscribers(t, client, "alice", 1)
+	waitSubscribers(t, client, "bob", 1)
+	waitSubscribers(t, client, "carol", 2)
+
+	publish(t, client, PubSubMode, UserChannel(testPrefix, "alice"), "", "alice")
+	publish(t, client, PubSubMode, UserChannel(testPrefix, "bob"), "", "bob")
+	publish(t, client, PubSubMode, UserChannel(testPrefix, "dave"), "", "dave")
+	brokertest.Settle(t, firstMessages.Expect(t, "", "alice").Ack)
+	brokertest.Settle(t, secondMessages.Expect(t, "", "bob").Ack)
+
+	// every node of the user gets its notification
+	publish(t, client, PubSubMode, UserChannel(testPrefix, "carol"), "", "carol")
+	firstMessages.Expect(t, "", "carol")
+	secondMessages.Expect(t, "", "carol")
+	firstMessages.None(t)
+	secondMessages.None(t)
+
+	err := first.Unbind("alice")
+	if err != nil {
+		t.Fatalf("unbind: %v", err)
+	}
+	waitSubscribers(t, client, "alice", 0)
+	publish(t, client, PubSubMode, UserChannel(testPrefix, "alice"), "", "alice")
+	firstMessages.None(t)
+}
+
+func TestPubSubPattern(t *testing.T) {
+	client := newClient(t)
+
+	_, messages := runPubSub(t, client, false)
+	waitPatterns(t, client, 1)
+
+	// without per user channels the node gets notifications of all users
+	publish(t, client, PubSubMode, UserChannel(testPrefix, "alice"), "", "alice")
+	publish(t, client, PubSubMode, UserChannel(testPrefix, "bob"), "", "bob")
+	messages.Expect(t, "", "alice")
+	msg := messages.Expect(t, "", "bob")
+	if err := msg.Requeue(); err == nil {
+		t.Fatalf("pub/sub message is requeued")
+	}
+
+	// other channels are not matched by the pattern
+	publish(t, client, PubSubMode, testPrefix+":other", "", "alice")
+	messages.None(t)
+}
+
+// waitSubscribers waits until the server has subscribers of the user channel,
+// subscription commands are sent by the client without waiting for the reply
+func waitSubscribers(t *testing.T, client *goredis.Client, key string, expected int64) {
+	t.Helper()
+
+	channel := UserChannel(testPrefix, key)
+	deadline := time.Now().Add(testWait)
+	for {
+		subscribers, err := client.PubSubNumSub(context.Background(), channel).Result()
+		if err != nil {
+			t.Fatalf("subscribers of %s: %v", channel, err)
+		}
+		if subscribers[channel] == expected {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("subscribers of %s: expected %d, got %d", channel, expected, subscribers[channel])
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func waitPatterns(t *testing.T, client *goredis.Client, expected int64) {
+	t.Helper()
+
+	deadline := time.Now().Add(testWait)
+	for {
+		patterns, err := client.PubSubNumPat(context.Background()).Result()
+		if err != nil {
+			t.Fatalf("patterns: %v", err)
+		}
+		if patterns == expected {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("patterns: expected %d, got %d", expected, patterns)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,235 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	goredis "github.com/redis/go-redis/v9"
+	xerrors "github.com/syth0le/gopnik/errors"
+	"go.uber.org/zap"
+
+	"github.com/syth0le/realtime-notification-service/internal/clients/broker"
+	"github.com/syth0le/realtime-notification-service/internal/utils"
+)
+
+const deadLettersPageSize = 100
+
+// Retrier adds failed entries to their stream again after backoff,
+// messages which are malformed or exhausted max attempts are added to the dead-letter stream
+type Retrier interface {
+	broker.Retrier
+	broker.DeadLetters
+}
+
+type RetrierImpl struct {
+	logger *zap.Logger
+	client *goredis.Client
+
+	stream           string // empty in pub/sub mode
+	deadLetterStream string
+
+	maxAttempts  int
+	initialDelay time.Duration
+	maxDelay     time.Duration
+}
+
+func NewRedisRetrier(
+	logger *zap.Logger,
+	enable bool,
+	client *goredis.Client,
+	stream string,
+	deadLetterStream string,
+	maxAttempts int,
+	initialDelay time.Duration,
+	maxDelay time.Duration,
+) Retrier {
+	if !enable {
+		return &RetrierMock{
+			Logger: logger,
+		}
+	}
+
+	return &RetrierImpl{
+		logger:           logger,
+		client:           client,
+		stream:           stream,
+		deadLetterStream: deadLetterStream,
+		maxAttempts:      maxAttempts,
+		initialDelay:     initialDelay,
+		maxDelay:         maxDelay,
+	}
+}
+
+// Retry adds entry to the stream after backoff, entry is dead-lettered after max attempts.
+// Pub/sub message cannot carry attempts, so it is dead-lettered at once.
+// Entry waiting for retry is lost if the node is stopped
+func (r *RetrierImpl) Retry(msg *broker.Message, reason string) error {
+	if r.stream == "" {
+		return r.DeadLetter(msg, reason)
+	}
+
+	attempts := msg.Attempts() + 1
+	if attempts >= r.maxAttempts {
+		return r.DeadLetter(msg, reason)
+	}
+
+	retried := msg.Clone(nil)
+	retried.Headers[broker.AttemptsHeader] = attempts
+
+	time.AfterFunc(broker.Backoff(r.initialDelay, r.maxDelay, attempts), func() {
+		err := r.add(r.stream, retried)
+		if err != nil {
+			r.logger.Sugar().Errorf("add retry %s: %v", retried.ID, err)
+		}
+	})
+
+	r.logger.Sugar().Debugf("retry %s attempt %d: %s", msg.ID, attempts, reason)
+	return nil
+}
+
+func (r *RetrierImpl) DeadLetter(msg *broker.Message, reason string) error {
+	letter := msg.Clone(nil)
+	// dead letters are addressed by message id
+	if letter.ID == "" {
+		letter.ID = utils.GenerateEUID()
+	}
+	letter.Headers[broker.AttemptsHeader] = msg.Attempts() + 1
+	letter.Headers[broker.DeadLetterReasonHeader] = reason
+	letter.Headers[broker.OriginalTopicHeader] = msg.Topic
+	letter.Headers[broker.OriginalKeyHeader] = msg.Key
+
+	err := r.add(r.deadLetterStream, letter)
+	if err != nil {
+		return fmt.Errorf("add dead letter: %w", err)
+	}
+
+	r.logger.Sugar().Warnf("dead-lettered %s: %s", letter.ID, reason)
+	return nil
+}
+
+// ListDeadLetters returns up to limit oldest dead letters
+func (r *RetrierImpl) ListDeadLetters(limit int) ([]*broker.DeadLetter, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultCommandTimeout)
+	defer cancel()
+
+	entries, err := r.client.XRangeN(ctx, r.deadLetterStream, "-", "+", int64(limit)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("range dead letters: %w", err)
+	}
+
+	res := make([]*broker.DeadLetter, 0, len(entries))
+	for _, entry := range entries {
+		res = append(res, deadLetterFromMessage(messageFromEntry(r.deadLetterStream, entry, nil)))
+	}
+	return res, nil
+}
+
+func (r *RetrierImpl) GetDeadLetter(messageID string) (*broker.DeadLetter, error) {
+	msg, _, err := r.find(messageID)
+	if err != nil {
+		return nil, err
+	}
+
+	return deadLetterFromMessage(msg), nil
+}
+
+// ReplayDeadLetter publishes dead letter to its original stream or channel with reset attempts and deletes it
+func (r *RetrierImpl) ReplayDeadLetter(messageID string) error {
+	msg, entryID, err := r.find(messageID)
+	if err != nil {
+		return err
+	}
+
+	letter := deadLetterFromMessage(msg)
+	replayed := msg.Clone(nil)
+	replayed.Topic = letter.Topic
+	replayed.Key = letter.Key
+	delete(replayed.Headers, broker.AttemptsHeader)
+	delete(replayed.Headers, broker.DeadLetterReasonHeader)
+	delete(replayed.Headers, broker.OriginalTopicHeader)
+	delete(replayed.Headers, broker.OriginalKeyHeader)
+
+	ctx, cancel := context.WithTimeout(context.Background(), defaultCommandTimeout)
+	defer cancel()
+
+	if r.stream != "" {
+		err = r.add(replayed.Topic, replayed)
+	} else {
+		err = r.client.Publish(ctx, replayed.Topic, replayed.Body).Err()
+	}
+	if err != nil {
+		return fmt.Errorf("publish replay: %w", err)
+	}
+
+	err = r.client.XDel(ctx, r.deadLetterStream, entryID).Err()
+	if err != nil {
+		return fmt.Errorf("delete dead letter: %w", err)
+	}
+
+	r.logger.Sugar().Infof("replayed dead letter %s", messageID)
+	return nil
+}
+
+func (r *RetrierImpl) Close() error {
+	return nil
+}
+
+// find scans the dead-letter stream page by page for the message
+func (r *RetrierImpl) find(messageID string) (*broker.Message, string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultCommandTimeout)
+	defer cancel()
+
+	start := "-"
+	for {
+		entries, err := r.client.XRangeN(ctx, r.deadLetterStream, start, "+", deadLettersPageSize).Result()
+		if err != nil {
+			return nil, "", fmt.Errorf("range dead letters: %w", err)
+		}
+
+		for _, entry := range entries {
+			msg := messageFromEntry(r.deadLetterStream, entry, nil)
+			if msg.ID == messageID {
+				return msg, entry.ID, nil
+			}
+		}
+
+		if len(entries) < deadLettersPageSize {
+			return nil, "", xerrors.WrapNotFoundError(fmt.Errorf("not found dead letter %s", messageID), "not found dead letter")
+		}
+		start = "(" + entries[len(entries)-1].ID
+	}
+}
+
+func (r *RetrierImpl) add(stream string, msg *broker.Message) error {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultCommandTimeout)
+	defer cancel()
+
+	return r.client.XAdd(ctx, &goredis.XAddArgs{
+		Stream: stream,
+		Values: valuesFromMessage(msg),
+	}).Err()
+}
+
+func deadLetterFromMessage(msg *broker.Message) *broker.DeadLetter {
+	letter := &broker.DeadLetter{
+		MessageID: msg.ID,
+		Topic:     msg.Topic,
+		Key:       msg.Key,
+		Attempts:  msg.Attempts(),
+		Timestamp: msg.Timestamp,
+		Headers:   msg.Clone(nil).Headers,
+		Body:      msg.Body,
+	}
+
+	if topic, ok := msg.Headers[broker.OriginalTopicHeader].(string); ok {
+		letter.Topic = topic
+	}
+	if key, ok := msg.Headers[broker.OriginalKeyHeader].(string); ok {
+		letter.Key = key
+	}
+	if reason, ok := msg.Headers[broker.DeadLetterReasonHeader].(string); ok {
+		letter.Reason = reason
+	}
+	return letter
+}
@@ -0,0 +1,285 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	goredis "github.com/redis/go-redis/v9"
+	xerrors "github.com/syth0le/gopnik/errors"
+	"go.uber.org/zap"
+
+	"github.com/syth0le/realtime-notification-service/internal/clients/broker"
+)
+
+const (
+	defaultCommandTimeout = 5 * time.Second
+	defaultReadCount      = 64
+	readErrorDelay        = time.Second
+)
+
+// StreamSubscriberImpl reads the stream as a member of the consumer group of the node, entry is acknowledged with XACK.
+// Every node reads all entries and handles only ones of the users bound to it, entries of other users are acknowledged.
+// Requeued entry stays pending and is claimed by any member of the node group after claim timeout
+type StreamSubscriberImpl struct {
+	logger *zap.Logger
+	client *goredis.Client
+	binder *StreamBinderImpl
+
+	stream   string
+	group    string
+	consumer string
+
+	blockTimeout time.Duration
+	claimTimeout time.Duration
+
+	done chan struct{}
+	once sync.Once
+}
+
+// NewStreamSubscriber creates consumer group of the node if it does not exist, the group reads entries added from now on
+func NewStreamSubscriber(
+	logger *zap.Logger,
+	client *goredis.Client,
+	binder *StreamBinderImpl,
+	consumer string,
+	blockTimeout time.Duration,
+	claimTimeout time.Duration,
+) (broker.Subscriber, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultCommandTimeout)
+	defer cancel()
+
+	err := client.XGroupCreateMkStream(ctx, binder.stream, binder.group, "$").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return nil, xerrors.WrapInternalError(fmt.Errorf("cannot create consumer group: %w", err))
+	}
+
+	return &StreamSubscriberImpl{
+		logger:       logger,
+		client:       client,
+		binder:       binder,
+		stream:       binder.stream,
+		group:        binder.group,
+		consumer:     consumer,
+		blockTimeout: blockTimeout,
+		claimTimeout: claimTimeout,
+		done:         make(chan struct{}),
+	}, nil
+}
+
+func (s *StreamSubscriberImpl) Run(handler broker.Handler) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() {
+		select {
+		case <-s.done:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	// entries left pending by the previous run of the consumer are delivered first
+	s.readPending(ctx, handler)
+
+	claimed := time.Now()
+	for ctx.Err() == nil {
+		if time.Since(claimed) >= s.claimTimeout/2 {
+			s.claim(ctx, handler)
+			claimed = time.Now()
+		}
+
+		streams, err := s.client.XReadGroup(ctx, &goredis.XReadGroupArgs{
+			Group:    s.group,
+			Consumer: s.consumer,
+			Streams:  []string{s.stream, ">"},
+			Count:    defaultReadCount,
+			Block:    s.blockTimeout,
+		}).Result()
+		if errors.Is(err, goredis.Nil) || ctx.Err() != nil {
+			continue
+		}
+		if err != nil {
+			s.logger.Sugar().Errorf("read stream %s: %v", s.stream, err)
+			s.wait(ctx, readErrorDelay)
+			continue
+		}
+
+		for _, stream := range streams {
+			s.deliver(stream.Messages, handler)
+		}
+	}
+
+	return nil
+}
+
+func (s *StreamSubscriberImpl) Close() error {
+	s.once.Do(func() {
+		close(s.done)
+	})
+	return nil
+}
+
+// readPending reads history of the consumer pending entries page by page
+func (s *StreamSubscriberImpl) readPending(ctx context.Context, handler broker.Handler) {
+	start := "0"
+	for ctx.Err() == nil {
+		streams, err := s.client.XReadGroup(ctx, &goredis.XReadGroupArgs{
+			Group:    s.group,
+			Consumer: s.consumer,
+			Streams:  []string{s.stream, start},
+			Count:    defaultReadCount,
+		}).Result()
+		if err != nil {
+			if !errors.Is(err, goredis.Nil) && ctx.Err() == nil {
+				s.logger.Sugar().Errorf("read pending entries %s: %v", s.stream, err)
+			}
+			return
+		}
+
+		if len(streams) == 0 || len(streams[0].Messages) == 0 {
+			return
+		}
+
+		messages := streams[0].Messages
+		s.deliver(messages, handler)
+		start = messages[len(messages)-1].ID
+	}
+}
+
+// claim takes over entries which are pending longer than claim timeout, including ones of the gone consumers
+func (s *StreamSubscriberImpl) claim(ctx context.Context, handler broker.Handler) {
+	messages, _, err := s.client.XAutoClaim(ctx, &goredis.XAutoClaimArgs{
+		Stream:   s.stream,
+		Group:    s.group,
+		MinIdle:  s.claimTimeout,
+		Start:    "0-0",
+		Count:    defaultReadCount,
+		Consumer: s.consumer,
+	}).Result()
+	if err != nil {
+		if ctx.Err() == nil {
+			s.logger.Sugar().Errorf("claim pending entries %s: %v", s.stream, err)
+		}
+		return
+	}
+
+	s.deliver(messages, handler)
+}
+
+func (s *StreamSubscriberImpl) deliver(entries []goredis.XMessage, handler broker.Handler) {
+	for _, entry := range entries {
+		msg := messageFromEntry(s.stream, entry, &entrySettler{subscriber: s, entryID: entry.ID})
+		if s.binder.Bound(msg.Key) {
+			handler(msg)
+			continue
+		}
+
+		// entry of the user connected to another node is handled by the group of that node
+		err := msg.Ack()
+		if err != nil {
+			s.logger.Sugar().Errorf("ack entry %s of unbound user: %v", entry.ID, err)
+		}
+	}
+}
+
+func (s *StreamSubscriberImpl) ack(entryID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultCommandTimeout)
+	defer cancel()
+
+	return s.client.XAck(ctx, s.stream, s.group, entryID).Err()
+}
+
+func (s *StreamSubscriberImpl) wait(ctx context.Context, delay time.Duration) {
+	select {
+	case <-ctx.Done():
+	case <-time.After(delay):
+	}
+}
+
+type entrySettler struct {
+	subscriber *StreamSubscriberImpl
+	entryID    string
+}
+
+func (s *entrySettler) Ack() error {
+	return s.subscriber.ack(s.entryID)
+}
+
+// Nack acknowledges the entry as well, so it is not claimed again
+func (s *entrySettler) Nack() error {
+	return s.subscriber.ack(s.entryID)
+}
+
+// Requeue leaves the entry pending, it is claimed again after claim timeout
+func (s *entrySettler) Requeue() error {
+	return nil
+}
+
+// StreamBinderImpl keeps users bound to the node, subscribers of the node handle only entries of these users.
+// Consumer group of the node is destroyed on close, so entries added after the node is stopped are not kept for it
+type StreamBinderImpl struct {
+	logger *zap.Logger
+	client *goredis.Client
+
+	stream string
+	group  string
+
+	keys  map[string]struct{}
+	mutex sync.RWMutex
+}
+
+func NewStreamBinder(
+	logger *zap.Logger,
+	client *goredis.Client,
+	stream string,
+	group string,
+) *StreamBinderImpl {
+	return &StreamBinderImpl{
+		logger: logger,
+		client: client,
+		stream: stream,
+		group:  group,
+		keys:   make(map[string]struct{}),
+		mutex:  sync.RWMutex{},
+	}
+}
+
+func (b *StreamBinderImpl) Bind(key string) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.keys[key] = struct{}{}
+	return nil
+}
+
+func (b *StreamBinderImpl) Unbind(key string) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	delete(b.keys, key)
+	return nil
+}
+
+// Bound reports if entries of the user are handled by the node
+func (b *StreamBinderImpl) Bound(key string) bool {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+
+	_, ok := b.keys[key]
+	return ok
+}
+
+func (b *StreamBinderImpl) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultCommandTimeout)
+	defer cancel()
+
+	err := b.client.XGroupDestroy(ctx, b.stream, b.group).Err()
+	if err != nil {
+		return fmt.Errorf("destroy consumer group %s: %w", b.group, err)
+	}
+	return nil
+}
@@ -0,0 +1,169 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	goredis "github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+
+	"github.com/syth0le/realtime-notification-service/internal/clients/broker/brokertest"
+)
+
+const (
+	testStream       = "notifications"
+	testGroup        = "realtime-notifications"
+	testPrefix       = "notifications"
+	testBlockTimeout = 50 * time.Millisecond
+	testClaimTimeout = 200 * time.Millisecond
+	testWait         = 2 * time.Second
+	testQuiet        = 300 * time.Millisecond
+)
+
+func newClient(t *testing.T) *goredis.Client {
+	t.Helper()
+
+	server := miniredis.RunT(t)
+	client := goredis.NewClient(&goredis.Options{Addr: server.Addr()})
+	t.Cleanup(func() {
+		client.Close()
+	})
+	return client
+}
+
+// testNode runs subscribers of one node and passes consumed messages to the test
+type testNode struct {
+	*brokertest.Subscription
+	binder *StreamBinderImpl
+}
+
+func runStreamNode(t *testing.T, client *goredis.Client, nodeID string, consumersCount int) *testNode {
+	t.Helper()
+
+	node := &testNode{
+		Subscription: brokertest.NewSubscription(t, testWait, testQuiet),
+		binder:       NewStreamBinder(zap.NewNop(), client, testStream, testGroup+"."+nodeID),
+	}
+	for i := 0; i < consumersCount; i++ {
+		subscriber, err := NewStreamSubscriber(
+			zap.NewNop(),
+			client,
+			node.binder,
+			fmt.Sprintf("%s-%d", nodeID, i),
+			testBlockTimeout,
+			testClaimTimeout,
+		)
+		if err != nil {
+			t.Fatalf("new stream subscriber: %v", err)
+		}
+		node.Run(subscriber)
+	}
+	return node
+}
+
+func (n *testNode) bind(t *testing.T, keys ...string) {
+	t.Helper()
+
+	brokertest.Bind(t, n.binder, keys...)
+}
+
+func publish(t *testing.T, client *goredis.Client, mode Mode, topic string, id string, key string) {
+	t.Helper()
+
+	brokertest.Publish(t, NewRedisPublisher(zap.NewNop(), client, mode), topic, id, key)
+}
+
+func TestStreamRoutesToBoundNodes(t *testing.T) {
+	client := newClient(t)
+
+	first := runStreamNode(t, client, "node-1", 2)
+	second := runStreamNode(t, client, "node-2", 1)
+	first.bind(t, "alice", "carol")
+	second.bind(t, "bob", "carol")
+
+	publish(t, client, StreamsMode, testStream, "m1", "alice")
+	publish(t, client, StreamsMode, testStream, "m2", "bob")
+	publish(t, client, StreamsMode, testStream, "m3", "dave")
+	brokertest.Settle(t, first.Expect(t, "m1", "alice").Ack)
+	brokertest.Settle(t, second.Expect(t, "m2", "bob").Ack)
+
+	// every node of the user gets its notification
+	publish(t, client, StreamsMode, testStream, "m4", "carol")
+	brokertest.Settle(t, first.Expect(t, "m4", "carol").Ack)
+	brokertest.Settle(t, second.Expect(t, "m4", "carol").Ack)
+	first.None(t)
+	second.None(t)
+
+	// entries of other users are acknowledged, so nothing is left pending in the node groups
+	assertPending(t, client, first.binder.group, 0)
+	assertPending(t, client, second.binder.group, 0)
+
+	err := first.binder.Unbind("alice")
+	if err != nil {
+		t.Fatalf("unbind: %v", err)
+	}
+	publish(t, client, StreamsMode, testStream, "m5", "alice")
+	first.None(t)
+}
+
+func TestStreamRequeuedEntryIsClaimed(t *testing.T) {
+	client := newClient(t)
+
+	node := runStreamNode(t, client, "node-1", 1)
+	node.bind(t, "alice")
+
+	publish(t, client, StreamsMode, testStream, "m1", "alice")
+	brokertest.Settle(t, node.Expect(t, "m1", "alice").Requeue)
+	assertPending(t, client, node.binder.group, 1)
+
+	// requeued entry stays pending and is delivered again after claim timeout
+	brokertest.Settle(t, node.Expect(t, "m1", "alice").Ack)
+	assertPending(t, client, node.binder.group, 0)
+	node.NoneFor(t, 2*testClaimTimeout)
+}
+
+func TestStreamNodeGroupReadsNewEntries(t *testing.T) {
+	client := newClient(t)
+
+	// entries added before the node is started are not delivered to the node
+	publish(t, client, StreamsMode, testStream, "m1", "alice")
+	node := runStreamNode(t, client, "node-1", 1)
+	node.bind(t, "alice")
+
+	publish(t, client, StreamsMode, testStream, "m2", "alice")
+	brokertest.Settle(t, node.Expect(t, "m2", "alice").Ack)
+	node.None(t)
+}
+
+func TestStreamBinderDestroysNodeGroup(t *testing.T) {
+	client := newClient(t)
+
+	node := runStreamNode(t, client, "node-1", 1)
+	err := node.binder.Close()
+	if err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	groups, err := client.XInfoGroups(context.Background(), testStream).Result()
+	if err != nil {
+		t.Fatalf("groups: %v", err)
+	}
+	if len(groups) != 0 {
+		t.Fatalf("group of the closed node is left: %+v", groups)
+	}
+}
+
+func assertPending(t *testing.T, client *goredis.Client, group string, expected int64) {
+	t.Helper()
+
+	pending, err := client.XPending(context.Background(), testStream, group).Result()
+	if err != nil {
+		t.Fatalf("pending entries: %v", err)
+	}
+	if pending.Count != expected {
+		t.Fatalf("pending entries of %s: expected %d, got %d", group, expected, pending.Count)
+	}
+}
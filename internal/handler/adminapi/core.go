@@ -0,0 +1,168 @@
+package adminapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-http-utils/headers"
+	xerrors "github.com/syth0le/gopnik/errors"
+	"go.uber.org/zap"
+
+	"github.com/syth0le/realtime-notification-service/internal/clients/broker"
+	"github.com/syth0le/realtime-notification-service/internal/service/admin"
+	"github.com/syth0le/realtime-notification-service/internal/service/presence"
+	"github.com/syth0le/realtime-notification-service/internal/service/publish"
+)
+
+const (
+	limitParam        = "limit"
+	messageIDURLParam = "messageID"
+
+	defaultDeadLettersLimit = 100
+)
+
+type Handler struct {
+	logger          *zap.Logger
+	adminService    admin.Service
+	publishService  publish.Service
+	presenceService presence.Service
+}
+
+func NewHandler(
+	logger *zap.Logger,
+	adminService admin.Service,
+	publishService publish.Service,
+	presenceService presence.Service,
+) *Handler {
+	return &Handler{
+		logger:          logger,
+		adminService:    adminService,
+		publishService:  publishService,
+		presenceService: presenceService,
+	}
+}
+
+type deadLetterResponse struct {
+	MessageID string          `json:"message_id"`
+	Topic     string          `json:"topic"`
+	Key       string          `json:"key"`
+	Reason    string          `json:"reason"`
+	Attempts  int             `json:"attempts"`
+	Timestamp string          `json:"timestamp,omitempty"`
+	Headers   map[string]any  `json:"headers,omitempty"`
+	Body      json.RawMessage `json:"body,omitempty"`
+}
+
+type listDeadLettersResponse struct {
+	DeadLetters []*deadLetterResponse `json:"dead_letters"`
+}
+
+// ListDeadLetters returns dead letters from the head of the dead-letter queue without bodies
+func (h *Handler) ListDeadLetters(w http.ResponseWriter, r *http.Request) {
+	limit := defaultDeadLettersLimit
+	if limitStr := r.URL.Query().Get(limitParam); limitStr != "" {
+		var err error
+		limit, err = strconv.Atoi(limitStr)
+		if err != nil {
+			h.writeError(r.Context(), w, xerrors.WrapValidationError(fmt.Errorf("parse limit: %w", err)))
+			return
+		}
+	}
+
+	letters, err := h.adminService.ListDeadLetters(r.Context(), limit)
+	if err != nil {
+		h.writeError(r.Context(), w, fmt.Errorf("list dead letters: %w", err))
+		return
+	}
+
+	response := listDeadLettersResponse{
+		DeadLetters: make([]*deadLetterResponse, 0, len(letters)),
+	}
+	for _, letter := range letters {
+		response.DeadLetters = append(response.DeadLetters, deadLetterToResponse(letter, false))
+	}
+
+	h.writeJSON(w, response)
+}
+
+// GetDeadLetter returns dead letter with its headers and body
+func (h *Handler) GetDeadLetter(w http.ResponseWriter, r *http.Request) {
+	letter, err := h.adminService.GetDeadLetter(r.Context(), chi.URLParam(r, messageIDURLParam))
+	if err != nil {
+		h.writeError(r.Context(), w, fmt.Errorf("get dead letter: %w", err))
+		return
+	}
+
+	h.writeJSON(w, deadLetterToResponse(letter, true))
+}
+
+// ReplayDeadLetter publishes dead letter to its original exchange
+func (h *Handler) ReplayDeadLetter(w http.ResponseWriter, r *http.Request) {
+	err := h.adminService.ReplayDeadLetter(r.Context(), chi.URLParam(r, messageIDURLParam))
+	if err != nil {
+		h.writeError(r.Context(), w, fmt.Errorf("replay dead letter: %w", err))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func deadLetterToResponse(letter *broker.DeadLetter, full bool) *deadLetterResponse {
+	response := &deadLetterResponse{
+		MessageID: letter.MessageID,
+		Topic:     letter.Topic,
+		Key:       letter.Key,
+		Reason:    letter.Reason,
+		Attempts:  letter.Attempts,
+	}
+	if !letter.Timestamp.IsZero() {
+		response.Timestamp = letter.Timestamp.Format(time.RFC3339Nano)
+	}
+
+	if !full {
+		return response
+	}
+
+	response.Headers = letter.Headers
+	if json.Valid(letter.Body) {
+		response.Body = letter.Body
+	} else {
+		// body which is not json is returned as base64 json string
+		response.Body, _ = json.Marshal(letter.Body)
+	}
+	return response
+}
+
+func (h *Handler) writeJSON(w http.ResponseWriter, response any) {
+	w.Header().Set(headers.ContentType, "application/json")
+	err := json.NewEncoder(w).Encode(response)
+	if err != nil {
+		h.logger.Sugar().Errorf("encode response: %v", err)
+	}
+}
+
+func (h *Handler) writeError(ctx context.Context, w http.ResponseWriter, err error) {
+	h.logger.Sugar().Warnf("http response error: %v", err)
+
+	w.Header().Set(headers.ContentType, "application/json")
+	errorResult, ok := xerrors.FromError(err)
+	if !ok {
+		h.logger.Sugar().Errorf("cannot write log message: %v", err)
+		return
+	}
+	w.WriteHeader(errorResult.StatusCode)
+	err = json.NewEncoder(w).Encode(
+		map[string]any{
+			"message": errorResult.Msg,
+			"code":    errorResult.StatusCode,
+		})
+
+	if err != nil {
+		http.Error(w, xerrors.InternalErrorMessage, http.StatusInternalServerError) // TODO: make error mapping
+	}
+}
@@ -0,0 +1,31 @@
+package adminapi
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	xerrors "github.com/syth0le/gopnik/errors"
+
+	"github.com/syth0le/realtime-notification-service/internal/utils"
+)
+
+const (
+	authHeader   = "Authorization"
+	bearerPrefix = "Bearer "
+)
+
+// TokenInterceptor lets through requests which present one of the tokens as a bearer token
+func (h *Handler) TokenInterceptor(tokens []string) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token, ok := strings.CutPrefix(r.Header.Get(authHeader), bearerPrefix)
+			if !ok || !utils.ValidToken(tokens, token) {
+				h.writeError(r.Context(), w, xerrors.WrapForbiddenError(fmt.Errorf("invalid service token"), "token validation failed"))
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
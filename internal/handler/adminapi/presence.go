@@ -0,0 +1,124 @@
+package adminapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	xerrors "github.com/syth0le/gopnik/errors"
+
+	"github.com/syth0le/realtime-notification-service/internal/model"
+)
+
+const userIDURLParam = "userID"
+
+// presenceResponse tells nodes of the cluster holding connections of the user, connections are of this node only
+type presenceResponse struct {
+	UserID      model.UserID          `json:"user_id"`
+	Online      bool                  `json:"online"`
+	Nodes       []string              `json:"nodes"`
+	Since       *time.Time            `json:"since,omitempty"`
+	LastSeen    *time.Time            `json:"last_seen,omitempty"`
+	Connections []*connectionResponse `json:"connections"`
+}
+
+type connectionResponse struct {
+	ID          model.ConnectionID `json:"id"`
+	Transport   model.Transport    `json:"transport"`
+	RemoteAddr  string             `json:"remote_addr"`
+	UserAgent   string             `json:"user_agent"`
+	ConnectedAt time.Time          `json:"connected_at"`
+}
+
+type onlineResponse struct {
+	UserID model.UserID `json:"user_id"`
+	Online bool         `json:"online"`
+}
+
+type presenceLookupRequest struct {
+	UserIDs []model.UserID `json:"user_ids"`
+}
+
+type presenceLookupResponse struct {
+	Presences []*presenceResponse `json:"presences"`
+}
+
+// IsOnline tells whether the user has at least one connection
+func (h *Handler) IsOnline(w http.ResponseWriter, r *http.Request) {
+	userID := model.UserID(chi.URLParam(r, userIDURLParam))
+
+	online, err := h.presenceService.IsOnline(r.Context(), userID)
+	if err != nil {
+		h.writeError(r.Context(), w, fmt.Errorf("is online: %w", err))
+		return
+	}
+
+	h.writeJSON(w, &onlineResponse{UserID: userID, Online: online})
+}
+
+// LookupPresence returns presence of every user of the list in the same order
+func (h *Handler) LookupPresence(w http.ResponseWriter, r *http.Request) {
+	var request presenceLookupRequest
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		h.writeError(r.Context(), w, xerrors.WrapValidationError(fmt.Errorf("decode request: %w", err)))
+		return
+	}
+
+	presences, err := h.presenceService.GetPresence(r.Context(), request.UserIDs)
+	if err != nil {
+		h.writeError(r.Context(), w, fmt.Errorf("lookup presence: %w", err))
+		return
+	}
+
+	response := presenceLookupResponse{
+		Presences: make([]*presenceResponse, 0, len(presences)),
+	}
+	for _, presence := range presences {
+		response.Presences = append(response.Presences, presenceToResponse(presence))
+	}
+
+	h.writeJSON(w, response)
+}
+
+// GetPresence tells whether the user is connected to any node of the cluster and to which ones
+func (h *Handler) GetPresence(w http.ResponseWriter, r *http.Request) {
+	presence, err := h.presenceService.GetUserPresence(r.Context(), model.UserID(chi.URLParam(r, userIDURLParam)))
+	if err != nil {
+		h.writeError(r.Context(), w, fmt.Errorf("get user presence: %w", err))
+		return
+	}
+
+	h.writeJSON(w, presenceToResponse(presence))
+}
+
+func presenceToResponse(presence *model.Presence) *presenceResponse {
+	response := &presenceResponse{
+		UserID:      presence.UserID,
+		Online:      presence.Online,
+		Nodes:       presence.Nodes,
+		Connections: make([]*connectionResponse, 0, len(presence.Connections)),
+	}
+	if response.Nodes == nil {
+		response.Nodes = []string{}
+	}
+	if !presence.Since.IsZero() {
+		response.Since = &presence.Since
+	}
+	if !presence.LastSeen.IsZero() {
+		response.LastSeen = &presence.LastSeen
+	}
+
+	for _, connection := range presence.Connections {
+		response.Connections = append(response.Connections, &connectionResponse{
+			ID:          connection.ID,
+			Transport:   connection.Transport,
+			RemoteAddr:  connection.RemoteAddr,
+			UserAgent:   connection.UserAgent,
+			ConnectedAt: connection.ConnectedAt,
+		})
+	}
+	return response
+}
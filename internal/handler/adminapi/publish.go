@@ -0,0 +1,113 @@
+package adminapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	xerrors "github.com/syth0le/gopnik/errors"
+
+	"github.com/syth0le/realtime-notification-service/internal/model"
+	"github.com/syth0le/realtime-notification-service/internal/service/publish"
+)
+
+type publishRequest struct {
+	ID         model.EventID          `json:"id,omitempty"` // generated if empty
+	Type       model.NotificationType `json:"type"`
+	CreatedAt  time.Time              `json:"created_at,omitempty"`
+	Actor      model.UserID           `json:"actor,omitempty"`
+	Recipients []model.UserID         `json:"recipients"`
+	Payload    json.RawMessage        `json:"payload"`
+}
+
+type publishBatchRequest struct {
+	Notifications []*publishRequest `json:"notifications"`
+}
+
+type publishedEventResponse struct {
+	ID        model.EventID          `json:"id"`
+	Type      model.NotificationType `json:"type"`
+	Recipient model.UserID           `json:"recipient"`
+	Error     string                 `json:"error,omitempty"` // event is not delivered and can be published again
+}
+
+type publishResponse struct {
+	Events []*publishedEventResponse `json:"events"`
+}
+
+// Publish delivers notification to every recipient, failed recipients are reported in the response
+func (h *Handler) Publish(w http.ResponseWriter, r *http.Request) {
+	request := new(publishRequest)
+	err := json.NewDecoder(r.Body).Decode(request)
+	if err != nil {
+		h.writeError(r.Context(), w, xerrors.WrapValidationError(fmt.Errorf("decode request: %w", err)))
+		return
+	}
+
+	results, err := h.publishService.Publish(r.Context(), request.toPublication())
+	if err != nil {
+		h.writeError(r.Context(), w, fmt.Errorf("publish: %w", err))
+		return
+	}
+
+	h.writeJSON(w, resultsToResponse(results))
+}
+
+// PublishBatch delivers notifications, nothing is delivered if any of them is invalid
+func (h *Handler) PublishBatch(w http.ResponseWriter, r *http.Request) {
+	request := new(publishBatchRequest)
+	err := json.NewDecoder(r.Body).Decode(request)
+	if err != nil {
+		h.writeError(r.Context(), w, xerrors.WrapValidationError(fmt.Errorf("decode request: %w", err)))
+		return
+	}
+
+	publications := make([]*publish.Publication, 0, len(request.Notifications))
+	for _, notification := range request.Notifications {
+		if notification == nil {
+			h.writeError(r.Context(), w, xerrors.WrapValidationError(fmt.Errorf("empty notification in batch")))
+			return
+		}
+		publications = append(publications, notification.toPublication())
+	}
+
+	results, err := h.publishService.PublishBatch(r.Context(), publications)
+	if err != nil {
+		h.writeError(r.Context(), w, fmt.Errorf("publish batch: %w", err))
+		return
+	}
+
+	h.writeJSON(w, resultsToResponse(results))
+}
+
+func (r *publishRequest) toPublication() *publish.Publication {
+	return &publish.Publication{
+		Notification: &model.Notification{
+			ID:        r.ID,
+			Type:      r.Type,
+			CreatedAt: r.CreatedAt,
+			Actor:     r.Actor,
+			Payload:   r.Payload,
+		},
+		Recipients: r.Recipients,
+	}
+}
+
+func resultsToResponse(results []*publish.Result) *publishResponse {
+	response := &publishResponse{
+		Events: make([]*publishedEventResponse, 0, len(results)),
+	}
+	for _, result := range results {
+		event := &publishedEventResponse{
+			ID:        result.Event.ID,
+			Type:      result.Event.Type,
+			Recipient: result.Event.UserID,
+		}
+		if result.Err != nil {
+			event.Error = result.Err.Error()
+		}
+		response.Events = append(response.Events, event)
+	}
+	return response
+}
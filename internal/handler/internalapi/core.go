@@ -0,0 +1,198 @@
+package internalapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	xerrors "github.com/syth0le/gopnik/errors"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/syth0le/realtime-notification-service/internal/clients/auth"
+	"github.com/syth0le/realtime-notification-service/internal/model"
+	"github.com/syth0le/realtime-notification-service/internal/service/notifications"
+	"github.com/syth0le/realtime-notification-service/internal/service/presence"
+	"github.com/syth0le/realtime-notification-service/internal/service/publish"
+	"github.com/syth0le/realtime-notification-service/proto/internalapi"
+)
+
+type NotificationHandler struct {
+	internalapi.UnimplementedNotificationServiceServer
+
+	Logger               *zap.Logger
+	AuthClient           auth.Client
+	PublishService       publish.Service
+	PresenceService      presence.Service
+	NotificationsService notifications.Service
+}
+
+func (h *NotificationHandler) Publish(ctx context.Context, request *internalapi.PublishRequest) (*internalapi.PublishResponse, error) {
+	results, err := h.PublishService.Publish(ctx, publicationFromRequest(request))
+	if err != nil {
+		return nil, h.grpcError(fmt.Errorf("publish: %w", err))
+	}
+
+	return resultsToResponse(results), nil
+}
+
+func (h *NotificationHandler) PublishBatch(ctx context.Context, request *internalapi.PublishBatchRequest) (*internalapi.PublishResponse, error) {
+	publications := make([]*publish.Publication, 0, len(request.Notifications))
+	for _, notification := range request.Notifications {
+		publications = append(publications, publicationFromRequest(notification))
+	}
+
+	results, err := h.PublishService.PublishBatch(ctx, publications)
+	if err != nil {
+		return nil, h.grpcError(fmt.Errorf("publish batch: %w", err))
+	}
+
+	return resultsToResponse(results), nil
+}
+
+// PublishStream publishes notifications one by one, so the stream is not limited by the batch size.
+// Notifications published before an invalid one are delivered
+func (h *NotificationHandler) PublishStream(stream internalapi.NotificationService_PublishStreamServer) error {
+	var (
+		results       []*publish.Result
+		notifications int
+	)
+	for {
+		request, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return stream.SendAndClose(resultsToResponse(results))
+		}
+		if err != nil {
+			return fmt.Errorf("receive notification: %w", err)
+		}
+
+		published, err := h.PublishService.Publish(stream.Context(), publicationFromRequest(request))
+		if err != nil {
+			return h.grpcError(fmt.Errorf("publish notification %d: %w", notifications, err))
+		}
+		results = append(results, published...)
+		notifications++
+	}
+}
+
+func (h *NotificationHandler) GetPresence(ctx context.Context, request *internalapi.GetPresenceRequest) (*internalapi.GetPresenceResponse, error) {
+	userIDs := make([]model.UserID, 0, len(request.UserIds))
+	for _, userID := range request.UserIds {
+		userIDs = append(userIDs, model.UserID(userID))
+	}
+
+	presences, err := h.PresenceService.GetPresence(ctx, userIDs)
+	if err != nil {
+		return nil, h.grpcError(fmt.Errorf("get presence: %w", err))
+	}
+
+	response := &internalapi.GetPresenceResponse{
+		Presences: make([]*internalapi.Presence, 0, len(presences)),
+	}
+	for _, presence := range presences {
+		response.Presences = append(response.Presences, presenceToResponse(presence))
+	}
+	return response, nil
+}
+
+func (h *NotificationHandler) DisconnectUser(ctx context.Context, request *internalapi.DisconnectUserRequest) (*internalapi.DisconnectUserResponse, error) {
+	disconnected, err := h.PresenceService.DisconnectUser(ctx, model.UserID(request.UserId))
+	if err != nil {
+		return nil, h.grpcError(fmt.Errorf("disconnect user: %w", err))
+	}
+
+	return &internalapi.DisconnectUserResponse{Connections: int32(disconnected)}, nil
+}
+
+// grpcError converts service error to grpc status, details of internal errors are only logged
+func (h *NotificationHandler) grpcError(err error) error {
+	resError, ok := xerrors.FromError(err)
+	if !ok {
+		h.Logger.Sugar().Errorf("internal api: %v", err)
+		return status.Error(codes.Internal, xerrors.InternalErrorMessage)
+	}
+
+	switch resError.StatusCode {
+	case http.StatusBadRequest:
+		return status.Errorf(codes.InvalidArgument, "%s: %v", resError.Msg, resError.Err)
+	case http.StatusForbidden:
+		return status.Error(codes.PermissionDenied, resError.Msg)
+	case http.StatusNotFound:
+		return status.Error(codes.NotFound, resError.Msg)
+	default:
+		h.Logger.Sugar().Errorf("internal api: %v", err)
+		return status.Error(codes.Internal, resError.Msg)
+	}
+}
+
+func publicationFromRequest(request *internalapi.PublishRequest) *publish.Publication {
+	publication := &publish.Publication{
+		Recipients: make([]model.UserID, 0, len(request.GetRecipients())),
+	}
+	for _, recipient := range request.GetRecipients() {
+		publication.Recipients = append(publication.Recipients, model.UserID(recipient))
+	}
+
+	// empty notification is rejected by the publish service
+	if notification := request.GetNotification(); notification != nil {
+		publication.Notification = &model.Notification{
+			ID:      model.EventID(notification.Id),
+			Type:    model.NotificationType(notification.Type),
+			Actor:   model.UserID(notification.Actor),
+			Payload: notification.Payload,
+		}
+		if notification.CreatedAt != nil {
+			publication.Notification.CreatedAt = notification.CreatedAt.AsTime()
+		}
+	}
+
+	return publication
+}
+
+func resultsToResponse(results []*publish.Result) *internalapi.PublishResponse {
+	response := &internalapi.PublishResponse{
+		Events: make([]*internalapi.PublishedEvent, 0, len(results)),
+	}
+	for _, result := range results {
+		event := &internalapi.PublishedEvent{
+			Id:        result.Event.ID.String(),
+			Type:      result.Event.Type.String(),
+			Recipient: result.Event.UserID.String(),
+		}
+		if result.Err != nil {
+			event.Error = result.Err.Error()
+		}
+		response.Events = append(response.Events, event)
+	}
+	return response
+}
+
+func presenceToResponse(presence *model.Presence) *internalapi.Presence {
+	response := &internalapi.Presence{
+		UserId:      presence.UserID.String(),
+		Online:      presence.Online,
+		Connections: make([]*internalapi.Connection, 0, len(presence.Connections)),
+		Nodes:       presence.Nodes,
+	}
+	if !presence.Since.IsZero() {
+		response.Since = timestamppb.New(presence.Since)
+	}
+	if !presence.LastSeen.IsZero() {
+		response.LastSeen = timestamppb.New(presence.LastSeen)
+	}
+
+	for _, connection := range presence.Connections {
+		response.Connections = append(response.Connections, &internalapi.Connection{
+			Id:          connection.ID.String(),
+			Transport:   string(connection.Transport),
+			RemoteAddr:  connection.RemoteAddr,
+			UserAgent:   connection.UserAgent,
+			ConnectedAt: timestamppb.New(connection.ConnectedAt),
+		})
+	}
+	return response
+}
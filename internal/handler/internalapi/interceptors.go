@@ -0,0 +1,49 @@
+package internalapi
+
+import (
+	"context"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/syth0le/realtime-notification-service/internal/utils"
+)
+
+const (
+	authMetadataKey = "authorization"
+	bearerPrefix    = "Bearer "
+)
+
+// TokenUnaryInterceptor lets through calls of internal services which present one of the tokens as a bearer token
+func TokenUnaryInterceptor(tokens []string) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if err := authorize(ctx, tokens); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// TokenStreamInterceptor is TokenUnaryInterceptor for streaming calls
+func TokenStreamInterceptor(tokens []string) grpc.StreamServerInterceptor {
+	return func(srv any, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := authorize(stream.Context(), tokens); err != nil {
+			return err
+		}
+		return handler(srv, stream)
+	}
+}
+
+func authorize(ctx context.Context, tokens []string) error {
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, value := range md.Get(authMetadataKey) {
+		token, ok := strings.CutPrefix(value, bearerPrefix)
+		if ok && utils.ValidToken(tokens, token) {
+			return nil
+		}
+	}
+	return status.Error(codes.Unauthenticated, "token validation failed")
+}
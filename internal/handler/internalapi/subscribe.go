@@ -0,0 +1,92 @@
+package internalapi
+
+import (
+	"context"
+	"fmt"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/syth0le/realtime-notification-service/internal/infrastructure_services/connections_pool"
+	"github.com/syth0le/realtime-notification-service/internal/model"
+	"github.com/syth0le/realtime-notification-service/proto/internalapi"
+)
+
+const (
+	userTokenMetadataKey = "user-token"
+	userAgentMetadataKey = "user-agent"
+)
+
+// Subscribe delivers notifications of the user to the stream until the call ends or the connection is closed by the server
+func (h *NotificationHandler) Subscribe(request *internalapi.SubscribeRequest, stream internalapi.NotificationService_SubscribeServer) error {
+	md, _ := metadata.FromIncomingContext(stream.Context())
+
+	var userToken string
+	if values := md.Get(userTokenMetadataKey); len(values) > 0 {
+		userToken = values[0]
+	}
+	userID, err := h.AuthClient.ValidateToken(stream.Context(), userToken)
+	if err != nil {
+		return h.grpcError(fmt.Errorf("validate user token: %w", err))
+	}
+
+	var remoteAddr, userAgent string
+	if p, ok := peer.FromContext(stream.Context()); ok {
+		remoteAddr = p.Addr.String()
+	}
+	if values := md.Get(userAgentMetadataKey); len(values) > 0 {
+		userAgent = values[0]
+	}
+
+	// call context is canceled as soon as the client goes away, cleanup must not depend on it
+	ctx := context.WithoutCancel(stream.Context())
+
+	sink := connections_pool.NewGRPCSink(stream.Context())
+	connection := connections_pool.NewConnection(userID, sink, remoteAddr, userAgent)
+
+	topics := make([]model.NotificationType, 0, len(request.Topics))
+	for _, topic := range request.Topics {
+		topics = append(topics, model.NotificationType(topic))
+	}
+	err = h.NotificationsService.SubscribeTopics(ctx, connection, topics)
+	if err != nil {
+		return h.grpcError(fmt.Errorf("subscribe topics: %w", err))
+	}
+
+	defer func() {
+		err := h.NotificationsService.UnsubscribeFeedNotifications(ctx, connection)
+		if err != nil {
+			h.Logger.Sugar().Errorf("unsubscribe notifications: %v", err)
+		}
+	}()
+
+	err = h.NotificationsService.SubscribeFeedNotifications(ctx, connection, model.EventID(request.LastEventId))
+	if err != nil {
+		return h.grpcError(fmt.Errorf("subscribe notifications: %w", err))
+	}
+	h.Logger.Sugar().Debugf("opened grpc connection: %s: %s", userID, connection.ID)
+
+	// events are sent from the handler only, grpc does not allow to send from other goroutines
+	err = sink.Serve(connection.Done(), func(event *model.Event) error {
+		return stream.Send(eventToResponse(event))
+	})
+	if err != nil {
+		h.Logger.Sugar().Debugf("closed grpc connection: %s: %s", userID, connection.ID)
+		return nil
+	}
+	h.Logger.Sugar().Debugf("closed grpc connection by server: %s: %s", userID, connection.ID)
+	// client resumes from the last received event after reconnect
+	return status.Error(codes.Unavailable, "connection closed by server")
+}
+
+func eventToResponse(event *model.Event) *internalapi.Event {
+	return &internalapi.Event{
+		Id:        event.ID.String(),
+		Type:      event.Type.String(),
+		CreatedAt: timestamppb.New(event.CreatedAt),
+		Data:      event.Data,
+	}
+}
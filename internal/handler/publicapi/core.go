@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/gobwas/ws"
 	"github.com/gobwas/ws/wsutil"
@@ -14,19 +15,25 @@ import (
 	"github.com/go-http-utils/headers"
 
 	"github.com/syth0le/realtime-notification-service/internal/clients/auth"
+	"github.com/syth0le/realtime-notification-service/internal/infrastructure_services/connections_pool"
 	"github.com/syth0le/realtime-notification-service/internal/model"
 	"github.com/syth0le/realtime-notification-service/internal/service/notifications"
+	"github.com/syth0le/realtime-notification-service/internal/service/presence"
 )
 
+const controlWriteTimeout = 5 * time.Second
+
 type Handler struct {
 	logger               *zap.Logger
 	notificationsService notifications.Service
+	presenceService      presence.Service
 }
 
-func NewHandler(logger *zap.Logger, notificationsService notifications.Service) *Handler {
+func NewHandler(logger *zap.Logger, notificationsService notifications.Service, presenceService presence.Service) *Handler {
 	return &Handler{
 		logger:               logger,
 		notificationsService: notificationsService,
+		presenceService:      presenceService,
 	}
 }
 
@@ -34,16 +41,14 @@ func NewHandler(logger *zap.Logger, notificationsService notifications.Service)
 func (h *Handler) SubscribeFeedNotifications(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
-	userIDStr := ctx.Value(auth.UserIDValue)
-	if userIDStr == "" {
-		h.writeError(
-			r.Context(),
-			w,
-			xerrors.WrapNotFoundError(fmt.Errorf("cannot recognize userID"), xerrors.NotFoundMessage),
-		)
+	userID, err := userIDFromContext(ctx)
+	if err != nil {
+		h.writeError(r.Context(), w, err)
 		return
 	}
-	userID := userIDStr.(model.UserID)
+
+	// client resumes the session from the last event it has seen
+	lastEventID := model.EventID(r.URL.Query().Get(lastEventIDParam))
 
 	conn, _, _, err := ws.UpgradeHTTP(r, w)
 	if err != nil {
@@ -52,26 +57,77 @@ func (h *Handler) SubscribeFeedNotifications(w http.ResponseWriter, r *http.Requ
 	}
 
 	go func() {
-		defer conn.Close()
+		// request context is canceled as soon as the handler returns
+		ctx := context.WithoutCancel(ctx)
+
+		sink := connections_pool.NewWebSocketSink(conn, false)
+		connection := connections_pool.NewConnection(userID, sink, conn.RemoteAddr().String(), r.UserAgent())
+		connection.SubscribeTopics(model.FeedPostedType)
+		defer func() {
+			err := h.notificationsService.UnsubscribeFeedNotifications(ctx, connection)
+			if err != nil {
+				h.logger.Sugar().Errorf("unsubscribe feed notifications: %v", err)
+			}
+		}()
 
-		err = h.notificationsService.SubscribeFeedNotifications(ctx, conn, &userID)
+		err := h.notificationsService.SubscribeFeedNotifications(ctx, connection, lastEventID)
 		if err != nil {
 			h.logger.Sugar().Errorf("subscribe feed notifications: %v", err)
 			return
 		}
+		h.logger.Sugar().Debugf("opened connection: %s: %s", userID, connection.ID)
 
-		for {
-			_, op, err := wsutil.ReadClientData(conn)
-			if err != nil {
-				return
-			}
-			if op == ws.OpClose {
-				// TODO: close connections and remove all pools
+		h.readLoop(connection, sink, nil)
+		h.logger.Sugar().Debugf("closed connection: %s: %s", userID, connection.ID)
+	}()
+
+}
+
+// readLoop reads client frames until the connection is closed, any frame from the client marks connection as alive.
+// Text messages are passed to onText if it is set, otherwise they are ignored
+func (h *Handler) readLoop(
+	connection *connections_pool.Connection,
+	sink *connections_pool.WebSocketSink,
+	onText func(payload []byte) error,
+) {
+	for {
+		messages, err := wsutil.ReadClientMessage(sink.Conn, nil)
+		if err != nil {
+			return
+		}
+		connection.Touch()
+
+		for _, message := range messages {
+			switch message.OpCode {
+			case ws.OpClose:
+				_ = sink.WriteMessage(ws.OpClose, ws.NewCloseFrameBody(ws.StatusNormalClosure, ""), time.Now().Add(controlWriteTimeout))
 				return
+			case ws.OpPing:
+				err = sink.WriteMessage(ws.OpPong, message.Payload, time.Now().Add(controlWriteTimeout))
+				if err != nil {
+					return
+				}
+			case ws.OpText:
+				if onText == nil {
+					continue
+				}
+				err = onText(message.Payload)
+				if err != nil {
+					h.logger.Sugar().Infof("handle client message: %s: %v", connection.ID, err)
+					return
+				}
 			}
 		}
-	}()
+	}
+}
+
+func userIDFromContext(ctx context.Context) (model.UserID, error) {
+	userID, ok := ctx.Value(auth.UserIDValue).(model.UserID)
+	if !ok || userID == "" {
+		return "", xerrors.WrapNotFoundError(fmt.Errorf("cannot recognize userID"), xerrors.NotFoundMessage)
+	}
 
+	return userID, nil
 }
 
 func (h *Handler) writeError(ctx context.Context, w http.ResponseWriter, err error) {
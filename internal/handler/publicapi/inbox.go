@@ -0,0 +1,77 @@
+package publicapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/go-http-utils/headers"
+	xerrors "github.com/syth0le/gopnik/errors"
+
+	"github.com/syth0le/realtime-notification-service/internal/model"
+)
+
+type inboxResponse struct {
+	Events []polledEvent `json:"events"`
+}
+
+type deleteInboxRequest struct {
+	EventIDs []model.EventID `json:"event_ids"`
+}
+
+// GetInbox returns notifications stored while the user had no connections
+func (h *Handler) GetInbox(w http.ResponseWriter, r *http.Request) {
+	userID, err := userIDFromContext(r.Context())
+	if err != nil {
+		h.writeError(r.Context(), w, err)
+		return
+	}
+
+	events, err := h.notificationsService.GetInbox(r.Context(), userID)
+	if err != nil {
+		h.writeError(r.Context(), w, fmt.Errorf("get inbox: %w", err))
+		return
+	}
+
+	response := inboxResponse{
+		Events: make([]polledEvent, 0, len(events)),
+	}
+	for _, event := range events {
+		response.Events = append(response.Events, polledEvent{
+			ID:        event.ID.String(),
+			Type:      event.Type.String(),
+			Data:      event.Data,
+			CreatedAt: event.CreatedAt,
+		})
+	}
+
+	w.Header().Set(headers.ContentType, "application/json")
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		h.logger.Sugar().Errorf("encode inbox response: %v", err)
+	}
+}
+
+// DeleteInbox removes notifications fetched by the client from the inbox
+func (h *Handler) DeleteInbox(w http.ResponseWriter, r *http.Request) {
+	userID, err := userIDFromContext(r.Context())
+	if err != nil {
+		h.writeError(r.Context(), w, err)
+		return
+	}
+
+	var request deleteInboxRequest
+	err = json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		h.writeError(r.Context(), w, xerrors.WrapValidationError(fmt.Errorf("decode request: %w", err)))
+		return
+	}
+
+	err = h.notificationsService.DeleteInbox(r.Context(), userID, request.EventIDs)
+	if err != nil {
+		h.writeError(r.Context(), w, fmt.Errorf("delete inbox: %w", err))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
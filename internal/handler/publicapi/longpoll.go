@@ -0,0 +1,79 @@
+package publicapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-http-utils/headers"
+	xerrors "github.com/syth0le/gopnik/errors"
+
+	"github.com/syth0le/realtime-notification-service/internal/service/notifications"
+)
+
+const (
+	cursorParam  = "cursor"
+	timeoutParam = "timeout"
+)
+
+type polledEvent struct {
+	ID        string          `json:"id"`
+	Type      string          `json:"type"`
+	Data      json.RawMessage `json:"data"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+type pollResponse struct {
+	Events []polledEvent `json:"events"`
+	Cursor string        `json:"cursor"`
+}
+
+// PollFeedNotifications holds the request until feed notifications arrive or timeout elapses
+func (h *Handler) PollFeedNotifications(w http.ResponseWriter, r *http.Request) {
+	userID, err := userIDFromContext(r.Context())
+	if err != nil {
+		h.writeError(r.Context(), w, err)
+		return
+	}
+
+	var timeout time.Duration
+	if timeoutStr := r.URL.Query().Get(timeoutParam); timeoutStr != "" {
+		timeout, err = time.ParseDuration(timeoutStr)
+		if err != nil {
+			h.writeError(r.Context(), w, xerrors.WrapValidationError(fmt.Errorf("parse timeout: %w", err)))
+			return
+		}
+	}
+
+	result, err := h.notificationsService.PollFeedNotifications(r.Context(), &notifications.PollParams{
+		UserID:     userID,
+		Cursor:     r.URL.Query().Get(cursorParam),
+		Timeout:    timeout,
+		RemoteAddr: r.RemoteAddr,
+		UserAgent:  r.UserAgent(),
+	})
+	if err != nil {
+		h.writeError(r.Context(), w, fmt.Errorf("poll feed notifications: %w", err))
+		return
+	}
+
+	response := pollResponse{
+		Events: make([]polledEvent, 0, len(result.Events)),
+		Cursor: result.Cursor,
+	}
+	for _, event := range result.Events {
+		response.Events = append(response.Events, polledEvent{
+			ID:        event.ID.String(),
+			Type:      event.Type.String(),
+			Data:      event.Data,
+			CreatedAt: event.CreatedAt,
+		})
+	}
+
+	w.Header().Set(headers.ContentType, "application/json")
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		h.logger.Sugar().Errorf("encode poll response: %v", err)
+	}
+}
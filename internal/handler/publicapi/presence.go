@@ -0,0 +1,98 @@
+package publicapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-http-utils/headers"
+
+	"github.com/syth0le/realtime-notification-service/internal/model"
+)
+
+type presenceConnection struct {
+	Transport   model.Transport `json:"transport"`
+	ConnectedAt time.Time       `json:"connected_at"`
+}
+
+// presenceResponse does not expose addresses and user agents of the connections
+type presenceResponse struct {
+	UserID      model.UserID          `json:"user_id"`
+	Online      bool                  `json:"online"`
+	Count       int                   `json:"connections_count"`
+	Since       *time.Time            `json:"since,omitempty"`
+	LastSeen    *time.Time            `json:"last_seen,omitempty"`
+	Connections []*presenceConnection `json:"connections"`
+}
+
+type onlineResponse struct {
+	UserID model.UserID `json:"user_id"`
+	Online bool         `json:"online"`
+}
+
+// IsOnline tells whether the authenticated user has at least one connection,
+// presence of other users is served by the admin api only
+func (h *Handler) IsOnline(w http.ResponseWriter, r *http.Request) {
+	userID, err := userIDFromContext(r.Context())
+	if err != nil {
+		h.writeError(r.Context(), w, err)
+		return
+	}
+
+	online, err := h.presenceService.IsOnline(r.Context(), userID)
+	if err != nil {
+		h.writeError(r.Context(), w, fmt.Errorf("is online: %w", err))
+		return
+	}
+
+	h.writeJSON(w, &onlineResponse{UserID: userID, Online: online})
+}
+
+// GetPresence returns number of connections of the authenticated user and time the user is online since
+func (h *Handler) GetPresence(w http.ResponseWriter, r *http.Request) {
+	userID, err := userIDFromContext(r.Context())
+	if err != nil {
+		h.writeError(r.Context(), w, err)
+		return
+	}
+
+	presence, err := h.presenceService.GetUserPresence(r.Context(), userID)
+	if err != nil {
+		h.writeError(r.Context(), w, fmt.Errorf("get presence: %w", err))
+		return
+	}
+
+	h.writeJSON(w, presenceToResponse(presence))
+}
+
+func (h *Handler) writeJSON(w http.ResponseWriter, response any) {
+	w.Header().Set(headers.ContentType, "application/json")
+	err := json.NewEncoder(w).Encode(response)
+	if err != nil {
+		h.logger.Sugar().Errorf("encode response: %v", err)
+	}
+}
+
+func presenceToResponse(presence *model.Presence) *presenceResponse {
+	response := &presenceResponse{
+		UserID:      presence.UserID,
+		Online:      presence.Online,
+		Count:       len(presence.Connections),
+		Connections: make([]*presenceConnection, 0, len(presence.Connections)),
+	}
+	if !presence.Since.IsZero() {
+		response.Since = &presence.Since
+	}
+	if !presence.LastSeen.IsZero() {
+		response.LastSeen = &presence.LastSeen
+	}
+
+	for _, connection := range presence.Connections {
+		response.Connections = append(response.Connections, &presenceConnection{
+			Transport:   connection.Transport,
+			ConnectedAt: connection.ConnectedAt,
+		})
+	}
+	return response
+}
@@ -0,0 +1,208 @@
+package publicapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gobwas/ws"
+	xerrors "github.com/syth0le/gopnik/errors"
+
+	"github.com/syth0le/realtime-notification-service/internal/infrastructure_services/connections_pool"
+	"github.com/syth0le/realtime-notification-service/internal/model"
+)
+
+type commandType string
+
+const (
+	subscribeCommand   commandType = "subscribe"
+	unsubscribeCommand commandType = "unsubscribe"
+	pingCommand        commandType = "ping"
+	ackCommand         commandType = "ack"
+)
+
+const (
+	replyFrameType = "reply"
+	pongFrameType  = "pong"
+	errorFrameType = "error"
+)
+
+const (
+	badRequestCode     = "bad_request"
+	unknownCommandCode = "unknown_command"
+	unknownTopicCode   = "unknown_topic"
+)
+
+// command is a client message of the websocket protocol
+type command struct {
+	ID       string                   `json:"id"`
+	Type     commandType              `json:"type"`
+	Topics   []model.NotificationType `json:"topics,omitempty"`
+	EventIDs []model.EventID          `json:"event_ids,omitempty"`
+}
+
+type replyFrame struct {
+	Type   string                   `json:"type"`
+	ID     string                   `json:"id,omitempty"`
+	OK     bool                     `json:"ok,omitempty"`
+	Topics []model.NotificationType `json:"topics,omitempty"`
+	Error  *frameError              `json:"error,omitempty"`
+}
+
+type frameError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+const (
+	// clientAcksParam enables at-least-once delivery, events are redelivered until the client acks them
+	clientAcksParam = "ack"
+	// topicsParam is a comma separated list of topics the connection is subscribed to before missed events are delivered
+	topicsParam = "topics"
+)
+
+// SubscribeNotifications opens websocket connection with topics of the handshake, client manages its topics
+// with protocol commands. Missed events are delivered for the handshake topics on open and for other topics on subscribe
+func (h *Handler) SubscribeNotifications(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userID, err := userIDFromContext(ctx)
+	if err != nil {
+		h.writeError(r.Context(), w, err)
+		return
+	}
+
+	var clientAcks bool
+	if clientAcksStr := r.URL.Query().Get(clientAcksParam); clientAcksStr != "" {
+		clientAcks, err = strconv.ParseBool(clientAcksStr)
+		if err != nil {
+			h.writeError(r.Context(), w, xerrors.WrapValidationError(fmt.Errorf("parse ack: %w", err)))
+			return
+		}
+	}
+
+	topics, err := topicsFromQuery(r)
+	if err != nil {
+		h.writeError(r.Context(), w, err)
+		return
+	}
+
+	// client resumes the session from the last event it has seen
+	lastEventID := model.EventID(r.URL.Query().Get(lastEventIDParam))
+
+	conn, _, _, err := ws.UpgradeHTTP(r, w)
+	if err != nil {
+		h.writeError(r.Context(), w, fmt.Errorf("cannot upgrade connection: %w", err))
+		return
+	}
+
+	go func() {
+		// request context is canceled as soon as the handler returns
+		ctx := context.WithoutCancel(ctx)
+
+		sink := connections_pool.NewWebSocketSink(conn, true)
+		connection := connections_pool.NewConnection(userID, sink, conn.RemoteAddr().String(), r.UserAgent())
+		connection.ClientAcks = clientAcks
+		connection.SubscribeTopics(topics...)
+		defer func() {
+			err := h.notificationsService.UnsubscribeFeedNotifications(ctx, connection)
+			if err != nil {
+				h.logger.Sugar().Errorf("unsubscribe notifications: %v", err)
+			}
+		}()
+
+		err := h.notificationsService.SubscribeFeedNotifications(ctx, connection, lastEventID)
+		if err != nil {
+			h.logger.Sugar().Errorf("subscribe notifications: %v", err)
+			return
+		}
+		h.logger.Sugar().Debugf("opened protocol connection: %s: %s", userID, connection.ID)
+
+		h.readLoop(connection, sink, func(payload []byte) error {
+			return h.handleCommand(ctx, connection, sink, payload)
+		})
+		h.logger.Sugar().Debugf("closed protocol connection: %s: %s", userID, connection.ID)
+	}()
+}
+
+func topicsFromQuery(r *http.Request) ([]model.NotificationType, error) {
+	topicsStr := r.URL.Query().Get(topicsParam)
+	if topicsStr == "" {
+		return nil, nil
+	}
+
+	topics := make([]model.NotificationType, 0)
+	for _, topic := range strings.Split(topicsStr, ",") {
+		topic := model.NotificationType(strings.TrimSpace(topic))
+		if !model.KnownNotificationType(topic) {
+			return nil, xerrors.WrapValidationError(fmt.Errorf("unknown topic: %s", topic))
+		}
+		topics = append(topics, topic)
+	}
+	return topics, nil
+}
+
+// handleCommand executes client command and writes reply, error is returned only if the reply cannot be written
+func (h *Handler) handleCommand(
+	ctx context.Context,
+	connection *connections_pool.Connection,
+	sink *connections_pool.WebSocketSink,
+	payload []byte,
+) error {
+	var cmd command
+	err := json.Unmarshal(payload, &cmd)
+	if err != nil {
+		return h.writeFrame(sink, errorFrame("", badRequestCode, fmt.Sprintf("cannot decode command: %v", err)))
+	}
+
+	switch cmd.Type {
+	case subscribeCommand:
+		err = h.notificationsService.SubscribeTopics(ctx, connection, cmd.Topics)
+	case unsubscribeCommand:
+		err = h.notificationsService.UnsubscribeTopics(ctx, connection, cmd.Topics)
+	case pingCommand:
+		return h.writeFrame(sink, &replyFrame{Type: pongFrameType, ID: cmd.ID})
+	case ackCommand:
+		err = h.notificationsService.AckEvents(ctx, connection, cmd.EventIDs)
+	default:
+		return h.writeFrame(sink, errorFrame(cmd.ID, unknownCommandCode, fmt.Sprintf("unknown command: %s", cmd.Type)))
+	}
+	if err != nil {
+		return h.writeFrame(sink, commandErrorFrame(cmd.ID, err))
+	}
+
+	return h.writeFrame(sink, &replyFrame{Type: replyFrameType, ID: cmd.ID, OK: true, Topics: connection.Topics()})
+}
+
+func (h *Handler) writeFrame(sink *connections_pool.WebSocketSink, frame *replyFrame) error {
+	payload, err := json.Marshal(frame)
+	if err != nil {
+		return fmt.Errorf("marshal frame: %w", err)
+	}
+
+	return sink.WriteMessage(ws.OpText, payload, time.Now().Add(controlWriteTimeout))
+}
+
+func errorFrame(id string, code string, message string) *replyFrame {
+	return &replyFrame{
+		Type:  errorFrameType,
+		ID:    id,
+		Error: &frameError{Code: code, Message: message},
+	}
+}
+
+func commandErrorFrame(id string, err error) *replyFrame {
+	errorResult, ok := xerrors.FromError(err)
+	if !ok {
+		return errorFrame(id, badRequestCode, err.Error())
+	}
+
+	if errorResult.StatusCode == http.StatusNotFound {
+		return errorFrame(id, unknownTopicCode, errorResult.Error())
+	}
+	return errorFrame(id, badRequestCode, errorResult.Error())
+}
@@ -0,0 +1,68 @@
+package publicapi
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/go-http-utils/headers"
+
+	"github.com/syth0le/realtime-notification-service/internal/infrastructure_services/connections_pool"
+	"github.com/syth0le/realtime-notification-service/internal/model"
+)
+
+const (
+	lastEventIDHeader = "Last-Event-ID"
+	lastEventIDParam  = "last_event_id"
+)
+
+// StreamFeedNotifications delivers feed notifications as server-sent events of the default type
+func (h *Handler) StreamFeedNotifications(w http.ResponseWriter, r *http.Request) {
+	userID, err := userIDFromContext(r.Context())
+	if err != nil {
+		h.writeError(r.Context(), w, err)
+		return
+	}
+
+	lastEventID := r.Header.Get(lastEventIDHeader)
+	if lastEventID == "" {
+		lastEventID = r.URL.Query().Get(lastEventIDParam)
+	}
+
+	w.Header().Set(headers.ContentType, "text/event-stream")
+	w.Header().Set(headers.CacheControl, "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	err = http.NewResponseController(w).Flush()
+	if err != nil {
+		h.logger.Sugar().Errorf("flush sse headers: %v", err)
+		return
+	}
+
+	// request context is canceled as soon as the client goes away, cleanup must not depend on it
+	ctx := context.WithoutCancel(r.Context())
+
+	sink := connections_pool.NewSSESink(w, model.FeedPostedType)
+	connection := connections_pool.NewConnection(userID, sink, r.RemoteAddr, r.UserAgent())
+	connection.SubscribeTopics(model.FeedPostedType)
+	defer func() {
+		err := h.notificationsService.UnsubscribeFeedNotifications(ctx, connection)
+		if err != nil {
+			h.logger.Sugar().Errorf("unsubscribe feed notifications: %v", err)
+		}
+	}()
+
+	err = h.notificationsService.SubscribeFeedNotifications(ctx, connection, model.EventID(lastEventID))
+	if err != nil {
+		h.logger.Sugar().Errorf("subscribe feed notifications: %v", err)
+		return
+	}
+	h.logger.Sugar().Debugf("opened sse connection: %s: %s", userID, connection.ID)
+
+	select {
+	case <-r.Context().Done():
+	case <-connection.Done():
+	}
+	h.logger.Sugar().Debugf("closed sse connection: %s: %s", userID, connection.ID)
+}
@@ -0,0 +1,214 @@
+package acknowledgements
+
+import (
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/syth0le/realtime-notification-service/internal/infrastructure_services/connections_pool"
+	"github.com/syth0le/realtime-notification-service/internal/infrastructure_services/inbox"
+	"github.com/syth0le/realtime-notification-service/internal/model"
+)
+
+// Service keeps events sent to connections with client acknowledgements until the client acknowledges them,
+// unacknowledged events are redelivered after timeout and on reconnect. Events are persisted to the inbox
+// by the dispatcher before they are tracked, so broker messages are settled without waiting for the client
+type Service interface {
+	Run() error
+	Close() error
+	// Track returns false if the event is already pending
+	Track(event *model.Event) bool
+	// Ack stops tracking of the user events and removes them from the inbox, unknown events are ignored
+	Ack(userID *model.UserID, eventIDs ...model.EventID)
+	Pending(userID *model.UserID) []*model.Event
+}
+
+type pendingEvent struct {
+	event    *model.Event
+	attempts int
+	deadline time.Time
+}
+
+type ServiceImpl struct {
+	logger *zap.Logger
+
+	redeliveryTimeout time.Duration
+	maxRedeliveries   int
+
+	pending map[model.UserID][]*pendingEvent
+	mutex   sync.Mutex
+
+	done chan struct{}
+
+	connectionsPoolService connections_pool.Service
+	inboxService           inbox.Service
+}
+
+func NewServiceImpl(
+	logger *zap.Logger,
+	redeliveryTimeout time.Duration,
+	maxRedeliveries int,
+	connectionsPoolService connections_pool.Service,
+	inboxService inbox.Service,
+) *ServiceImpl {
+	return &ServiceImpl{
+		logger:                 logger,
+		redeliveryTimeout:      redeliveryTimeout,
+		maxRedeliveries:        maxRedeliveries,
+		pending:                make(map[model.UserID][]*pendingEvent),
+		mutex:                  sync.Mutex{},
+		done:                   make(chan struct{}),
+		connectionsPoolService: connectionsPoolService,
+		inboxService:           inboxService,
+	}
+}
+
+// Run redelivers events which have not been acknowledged within redelivery timeout
+func (s *ServiceImpl) Run() error {
+	ticker := time.NewTicker(s.redeliveryTimeout / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return nil
+		case <-ticker.C:
+			s.redeliver()
+		}
+	}
+}
+
+// Close stops redelivery, pending events are kept in the inbox and delivered on reconnect
+func (s *ServiceImpl) Close() error {
+	close(s.done)
+	return nil
+}
+
+// Track keeps the event until it is acknowledged
+func (s *ServiceImpl) Track(event *model.Event) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, p := range s.pending[event.UserID] {
+		if p.event.ID == event.ID {
+			return false
+		}
+	}
+
+	s.pending[event.UserID] = append(s.pending[event.UserID], &pendingEvent{
+		event:    event,
+		deadline: time.Now().Add(s.redeliveryTimeout),
+	})
+	return true
+}
+
+// Ack stops tracking of the user events, acknowledged events are removed from the inbox out of the service lock
+func (s *ServiceImpl) Ack(userID *model.UserID, eventIDs ...model.EventID) {
+	released := s.release(userID, eventIDs)
+	if len(released) == 0 {
+		return
+	}
+
+	ids := make([]model.EventID, 0, len(released))
+	for _, p := range released {
+		ids = append(ids, p.event.ID)
+	}
+
+	err := s.inboxService.Delete(userID, ids...)
+	if err != nil {
+		s.logger.Sugar().Errorf("delete acknowledged events: %s: %v", userID, err)
+	}
+}
+
+// release stops tracking of the user events and returns them
+func (s *ServiceImpl) release(userID *model.UserID, eventIDs []model.EventID) []*pendingEvent {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	acked := make(map[model.EventID]struct{}, len(eventIDs))
+	for _, id := range eventIDs {
+		acked[id] = struct{}{}
+	}
+
+	released := make([]*pendingEvent, 0, len(eventIDs))
+	userPending := s.pending[*userID][:0]
+	for _, p := range s.pending[*userID] {
+		if _, ok := acked[p.event.ID]; ok {
+			released = append(released, p)
+			continue
+		}
+		userPending = append(userPending, p)
+	}
+
+	if len(userPending) == 0 {
+		delete(s.pending, *userID)
+	} else {
+		s.pending[*userID] = userPending
+	}
+	return released
+}
+
+// Pending returns unacknowledged user events in order of tracking
+func (s *ServiceImpl) Pending(userID *model.UserID) []*model.Event {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	res := make([]*model.Event, 0, len(s.pending[*userID]))
+	for _, p := range s.pending[*userID] {
+		res = append(res, p.event)
+	}
+	return res
+}
+
+func (s *ServiceImpl) redeliver() {
+	now := time.Now()
+	due := make([]*model.Event, 0)
+
+	s.mutex.Lock()
+	for userID, userPending := range s.pending {
+		kept := userPending[:0]
+		for _, p := range userPending {
+			if now.Before(p.deadline) {
+				kept = append(kept, p)
+				continue
+			}
+
+			p.attempts++
+			if p.attempts > s.maxRedeliveries {
+				// event stays in the inbox, so it is delivered again on reconnect
+				s.logger.Sugar().Warnf("event %s is not acknowledged after %d redeliveries: %s", p.event.ID, s.maxRedeliveries, userID)
+				continue
+			}
+
+			p.deadline = now.Add(s.redeliveryTimeout)
+			due = append(due, p.event)
+			kept = append(kept, p)
+		}
+
+		if len(kept) == 0 {
+			delete(s.pending, userID)
+			continue
+		}
+		s.pending[userID] = kept
+	}
+	s.mutex.Unlock()
+
+	for _, event := range due {
+		connections, err := s.connectionsPoolService.GetUserConnections(&event.UserID)
+		if err != nil {
+			continue
+		}
+
+		for _, conn := range connections {
+			if !conn.ClientAcks || !conn.Subscribed(event.Type) {
+				continue
+			}
+
+			err = conn.Send(event)
+			if err != nil {
+				s.logger.Sugar().Errorf("redeliver event: %s: %v", conn.ID, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,30 @@
+package acknowledgements
+
+import (
+	"github.com/syth0le/realtime-notification-service/internal/model"
+)
+
+// ServiceMock does not track events, events are considered acknowledged as soon as they are sent
+type ServiceMock struct{}
+
+func NewServiceMock() *ServiceMock {
+	return &ServiceMock{}
+}
+
+func (s *ServiceMock) Run() error {
+	return nil
+}
+
+func (s *ServiceMock) Close() error {
+	return nil
+}
+
+func (s *ServiceMock) Track(event *model.Event) bool {
+	return false
+}
+
+func (s *ServiceMock) Ack(userID *model.UserID, eventIDs ...model.EventID) {}
+
+func (s *ServiceMock) Pending(userID *model.UserID) []*model.Event {
+	return nil
+}
@@ -2,53 +2,285 @@ package connections_pool
 
 import (
 	"fmt"
-	"net"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	xerrors "github.com/syth0le/gopnik/errors"
 	"go.uber.org/zap"
 
 	"github.com/syth0le/realtime-notification-service/internal/model"
+	"github.com/syth0le/realtime-notification-service/internal/utils"
 )
 
+type SlowConsumerPolicy string
+
+const (
+	DropOldestPolicy SlowConsumerPolicy = "drop_oldest"
+	DropNewestPolicy SlowConsumerPolicy = "drop_newest"
+	DisconnectPolicy SlowConsumerPolicy = "disconnect"
+)
+
+func (p SlowConsumerPolicy) Validate() error {
+	switch p {
+	case DropOldestPolicy, DropNewestPolicy, DisconnectPolicy:
+		return nil
+	default:
+		return fmt.Errorf("unexpected slow consumer policy: %s", p)
+	}
+}
+
+type Connection struct {
+	model.ConnectionInfo
+	Sink Sink
+
+	// ClientAcks is set for connections whose client acknowledges received events,
+	// events written to other connections are considered acknowledged
+	ClientAcks bool
+	// LastEventID is the last event seen by the client before the connection was opened
+	LastEventID model.EventID
+
+	lastSeen atomic.Int64
+	dropped  atomic.Int64
+
+	queue        chan *model.Event
+	policy       SlowConsumerPolicy
+	writeTimeout time.Duration
+
+	topics      map[model.NotificationType]struct{}
+	topicsMutex sync.RWMutex
+
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func NewConnection(userID model.UserID, sink Sink, remoteAddr string, userAgent string) *Connection {
+	connection := &Connection{
+		ConnectionInfo: model.ConnectionInfo{
+			ID:          model.ConnectionID(utils.GenerateCUID()),
+			UserID:      userID,
+			Transport:   sink.Transport(),
+			RemoteAddr:  remoteAddr,
+			UserAgent:   userAgent,
+			ConnectedAt: time.Now(),
+		},
+		Sink:        sink,
+		topics:      make(map[model.NotificationType]struct{}),
+		topicsMutex: sync.RWMutex{},
+		done:        make(chan struct{}),
+		closeOnce:   sync.Once{},
+	}
+	connection.Touch()
+
+	return connection
+}
+
+// Send enqueues payload for the connection writer, full queue is handled according to slow consumer policy.
+// Error is returned only if the connection cannot be used anymore
+func (c *Connection) Send(event *model.Event) error {
+	select {
+	case <-c.done:
+		return fmt.Errorf("connection closed")
+	case c.queue <- event:
+		return nil
+	default:
+	}
+
+	switch c.policy {
+	case DropNewestPolicy:
+		c.dropped.Add(1)
+		return nil
+	case DropOldestPolicy:
+		for {
+			select {
+			case c.queue <- event:
+				return nil
+			default:
+			}
+
+			select {
+			case <-c.queue:
+				c.dropped.Add(1)
+			default:
+			}
+		}
+	default:
+		_ = c.Close()
+		return fmt.Errorf("send queue is full, connection closed")
+	}
+}
+
+// SubscribeTopics adds notification types delivered to the connection
+func (c *Connection) SubscribeTopics(topics ...model.NotificationType) {
+	c.topicsMutex.Lock()
+	defer c.topicsMutex.Unlock()
+
+	for _, topic := range topics {
+		c.topics[topic] = struct{}{}
+	}
+}
+
+// UnsubscribeTopics removes notification types delivered to the connection
+func (c *Connection) UnsubscribeTopics(topics ...model.NotificationType) {
+	c.topicsMutex.Lock()
+	defer c.topicsMutex.Unlock()
+
+	for _, topic := range topics {
+		delete(c.topics, topic)
+	}
+}
+
+func (c *Connection) Subscribed(topic model.NotificationType) bool {
+	c.topicsMutex.RLock()
+	defer c.topicsMutex.RUnlock()
+
+	_, ok := c.topics[topic]
+	return ok
+}
+
+func (c *Connection) Topics() []model.NotificationType {
+	c.topicsMutex.RLock()
+	defer c.topicsMutex.RUnlock()
+
+	res := make([]model.NotificationType, 0, len(c.topics))
+	for topic := range c.topics {
+		res = append(res, topic)
+	}
+	return res
+}
+
+// Ping pings the client, connection of a sink which does not answer pings is considered alive after successful ping
+func (c *Connection) Ping() error {
+	err := c.Sink.Ping(c.writeDeadline())
+	if err != nil {
+		return err
+	}
+
+	if !c.Sink.AnswersPings() {
+		c.Touch()
+	}
+	return nil
+}
+
+// Touch marks connection as alive, it is called on any message received from the client
+func (c *Connection) Touch() {
+	c.lastSeen.Store(time.Now().UnixNano())
+}
+
+func (c *Connection) LastSeen() time.Time {
+	return time.Unix(0, c.lastSeen.Load())
+}
+
+// Dropped returns number of messages dropped by slow consumer policy
+func (c *Connection) Dropped() int64 {
+	return c.dropped.Load()
+}
+
+func (c *Connection) Done() <-chan struct{} {
+	return c.done
+}
+
+func (c *Connection) Close() error {
+	var err error
+	c.closeOnce.Do(func() {
+		close(c.done)
+		err = c.Sink.Close()
+	})
+	return err
+}
+
+func (c *Connection) writeDeadline() time.Time {
+	if c.writeTimeout <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(c.writeTimeout)
+}
+
+// runWriter writes queued events until the connection is closed, failed write closes the connection
+func (c *Connection) runWriter(logger *zap.Logger) {
+	for {
+		select {
+		case <-c.done:
+			return
+		case event := <-c.queue:
+			err := c.Sink.Write(event, c.writeDeadline())
+			if err != nil {
+				logger.Sugar().Infof("write message: %s: %v", c.ID, err)
+				_ = c.Close()
+				return
+			}
+		}
+	}
+}
+
 type Service interface {
-	AddConnection(userID *model.UserID, conn net.Conn)
-	DeleteConnection(userID *model.UserID, conn net.Conn) error
+	AddConnection(conn *Connection) model.ConnectionID
+	DeleteConnection(userID *model.UserID, connectionID model.ConnectionID) error
 	FlushAllUserConnections(userID *model.UserID) error
 	FlushAllConnections()
-	GetUserConnections(userID *model.UserID) ([]net.Conn, error)
+	GetConnection(userID *model.UserID, connectionID model.ConnectionID) (*Connection, error)
+	GetUserConnections(userID *model.UserID) ([]*Connection, error)
+	ListConnections() []*Connection
 }
 
 type ServiceImpl struct {
 	logger *zap.Logger
 
-	pool map[model.UserID]map[net.Addr]net.Conn
+	pool map[model.UserID]map[model.ConnectionID]*Connection
 
 	mutex sync.Mutex
+
+	sendQueueSize      int
+	slowConsumerPolicy SlowConsumerPolicy
+	writeTimeout       time.Duration
+
+	onPresenceChange func(event *model.PresenceEvent)
 }
 
-func NewServiceImpl(logger *zap.Logger) *ServiceImpl {
+func NewServiceImpl(
+	logger *zap.Logger,
+	sendQueueSize int,
+	slowConsumerPolicy SlowConsumerPolicy,
+	writeTimeout time.Duration,
+) *ServiceImpl {
 	return &ServiceImpl{
-		logger: logger,
-		pool:   make(map[model.UserID]map[net.Addr]net.Conn),
-		mutex:  sync.Mutex{},
+		logger:             logger,
+		pool:               make(map[model.UserID]map[model.ConnectionID]*Connection),
+		mutex:              sync.Mutex{},
+		sendQueueSize:      sendQueueSize,
+		slowConsumerPolicy: slowConsumerPolicy,
+		writeTimeout:       writeTimeout,
 	}
 }
 
-func (s *ServiceImpl) AddConnection(userID *model.UserID, conn net.Conn) {
+// AddConnection saves connection and starts its writer
+func (s *ServiceImpl) AddConnection(conn *Connection) model.ConnectionID {
+	conn.queue = make(chan *model.Event, s.sendQueueSize)
+	conn.policy = s.slowConsumerPolicy
+	conn.writeTimeout = s.writeTimeout
+	go conn.runWriter(s.logger)
+
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 
-	s.addElem(*userID, conn)
+	s.addElem(conn)
+	return conn.ID
+}
+
+// OnPresenceChange sets callback called when the user gets the first connection or loses the last one,
+// it is called under the pool lock, so it must not block. It must be set before connections are added
+func (s *ServiceImpl) OnPresenceChange(fn func(event *model.PresenceEvent)) {
+	s.onPresenceChange = fn
 }
 
-func (s *ServiceImpl) DeleteConnection(userID *model.UserID, conn net.Conn) error {
+func (s *ServiceImpl) DeleteConnection(userID *model.UserID, connectionID model.ConnectionID) error {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 
-	return s.delElem(*userID, conn)
+	return s.delElem(*userID, connectionID)
 }
 
+// FlushAllUserConnections closes all user connections, they are removed from the pool by their owners
 func (s *ServiceImpl) FlushAllUserConnections(userID *model.UserID) error {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
@@ -56,50 +288,93 @@ func (s *ServiceImpl) FlushAllUserConnections(userID *model.UserID) error {
 	return s.flushAllConnections(*userID)
 }
 
+// FlushAllConnections closes all connections, they are removed from the pool by their owners
 func (s *ServiceImpl) FlushAllConnections() {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 
-	for userID, userConns := range s.pool {
+	for _, userConns := range s.pool {
 		for _, conn := range userConns {
 			conn.Close()
 		}
-		s.pool[userID] = nil
 	}
 }
 
-func (s *ServiceImpl) GetUserConnections(userID *model.UserID) ([]net.Conn, error) {
+func (s *ServiceImpl) GetConnection(userID *model.UserID, connectionID model.ConnectionID) (*Connection, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	conn, ok := s.pool[*userID][connectionID]
+	if !ok {
+		return nil, xerrors.WrapNotFoundError(fmt.Errorf("not found connection"), "not found connection")
+	}
+
+	return conn, nil
+}
+
+func (s *ServiceImpl) GetUserConnections(userID *model.UserID) ([]*Connection, error) {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 
 	return s.getAllConnections(*userID)
 }
 
-func (s *ServiceImpl) addElem(userID model.UserID, conn net.Conn) {
-	s.logger.Sugar().Debugf("before add: (%d)  %s", len(s.pool[userID]), userID)
+func (s *ServiceImpl) ListConnections() []*Connection {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var res []*Connection
+	for _, userConns := range s.pool {
+		for _, conn := range userConns {
+			res = append(res, conn)
+		}
+	}
+
+	return res
+}
+
+func (s *ServiceImpl) addElem(conn *Connection) {
+	s.logger.Sugar().Debugf("before add: (%d)  %s", len(s.pool[conn.UserID]), conn.UserID)
 
-	if _, ok := s.pool[userID]; ok {
-		s.pool[userID][conn.RemoteAddr()] = conn
+	if _, ok := s.pool[conn.UserID]; ok {
+		s.pool[conn.UserID][conn.ID] = conn
 	} else {
-		s.pool[userID] = map[net.Addr]net.Conn{conn.RemoteAddr(): conn}
+		s.pool[conn.UserID] = map[model.ConnectionID]*Connection{conn.ID: conn}
+		s.presenceChanged(conn.UserID, model.OnlinePresenceEvent)
 	}
 
-	s.logger.Sugar().Debugf("after add (%d)  %s", len(s.pool[userID]), userID)
+	s.logger.Sugar().Debugf("after add (%d)  %s: %s", len(s.pool[conn.UserID]), conn.UserID, conn.ID)
 }
 
-func (s *ServiceImpl) delElem(userID model.UserID, conn net.Conn) error {
+func (s *ServiceImpl) delElem(userID model.UserID, connectionID model.ConnectionID) error {
 	if _, ok := s.pool[userID]; !ok {
 		return xerrors.WrapNotFoundError(fmt.Errorf("not found user id"), "not found user id")
 	}
 
-	if _, ok := s.pool[userID][conn.RemoteAddr()]; !ok {
+	if _, ok := s.pool[userID][connectionID]; !ok {
 		return xerrors.WrapNotFoundError(fmt.Errorf("not found connection"), "not found connection")
 	}
 
-	delete(s.pool[userID], conn.RemoteAddr())
+	delete(s.pool[userID], connectionID)
+	if len(s.pool[userID]) == 0 {
+		delete(s.pool, userID)
+		s.presenceChanged(userID, model.OfflinePresenceEvent)
+	}
 	return nil
 }
 
+func (s *ServiceImpl) presenceChanged(userID model.UserID, eventType model.PresenceEventType) {
+	if s.onPresenceChange == nil {
+		return
+	}
+
+	s.onPresenceChange(&model.PresenceEvent{
+		Type:   eventType,
+		UserID: userID,
+		At:     time.Now(),
+	})
+}
+
 func (s *ServiceImpl) flushAllConnections(userID model.UserID) error {
 	if _, ok := s.pool[userID]; !ok {
 		return xerrors.WrapNotFoundError(fmt.Errorf("not found userID"), "not found user id")
@@ -109,16 +384,15 @@ func (s *ServiceImpl) flushAllConnections(userID model.UserID) error {
 		conn.Close()
 	}
 
-	delete(s.pool, userID)
 	return nil
 }
 
-func (s *ServiceImpl) getAllConnections(userID model.UserID) ([]net.Conn, error) {
+func (s *ServiceImpl) getAllConnections(userID model.UserID) ([]*Connection, error) {
 	if _, ok := s.pool[userID]; !ok {
 		return nil, xerrors.WrapNotFoundError(fmt.Errorf("not found userID"), "not found user id")
 	}
 
-	res := make([]net.Conn, len(s.pool[userID]))
+	res := make([]*Connection, len(s.pool[userID]))
 	acc := 0
 	for _, val := range s.pool[userID] {
 		res[acc] = val
@@ -0,0 +1,147 @@
+package connections_pool
+
+import (
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/syth0le/realtime-notification-service/internal/model"
+)
+
+const (
+	testQueueSize = 2
+	testWait      = 2 * time.Second
+	testQuiet     = 200 * time.Millisecond
+)
+
+// blockingSink holds the first write until it is released, so events sent meanwhile stay in the send queue
+type blockingSink struct {
+	written chan *model.Event
+	release chan struct{}
+}
+
+func newBlockingSink() *blockingSink {
+	return &blockingSink{
+		written: make(chan *model.Event, 16),
+		release: make(chan struct{}),
+	}
+}
+
+func (s *blockingSink) Write(event *model.Event, _ time.Time) error {
+	s.written <- event
+	<-s.release
+	return nil
+}
+
+func (s *blockingSink) Ping(_ time.Time) error {
+	return nil
+}
+
+func (s *blockingSink) Close() error {
+	return nil
+}
+
+func (s *blockingSink) Transport() model.Transport {
+	return model.WebSocketTransport
+}
+
+func (s *blockingSink) AnswersPings() bool {
+	return true
+}
+
+func (s *blockingSink) expect(t *testing.T, ids ...model.EventID) {
+	t.Helper()
+
+	for _, id := range ids {
+		select {
+		case event := <-s.written:
+			if event.ID != id {
+				t.Fatalf("unexpected event %s, expected %s", event.ID, id)
+			}
+		case <-time.After(testWait):
+			t.Fatalf("event %s is not written", id)
+		}
+	}
+
+	select {
+	case event := <-s.written:
+		t.Fatalf("unexpected event %s", event.ID)
+	case <-time.After(testQuiet):
+	}
+}
+
+// connectSlow returns connection whose writer is blocked on e1 and whose send queue is full of e2 and e3
+func connectSlow(t *testing.T, policy SlowConsumerPolicy) (*Connection, *blockingSink) {
+	t.Helper()
+
+	pool := NewServiceImpl(zap.NewNop(), testQueueSize, policy, time.Second)
+	sink := newBlockingSink()
+	conn := NewConnection("alice", sink, "", "")
+	pool.AddConnection(conn)
+	t.Cleanup(func() { conn.Close() })
+
+	send(t, conn, "e1")
+	select {
+	case <-sink.written:
+	case <-time.After(testWait):
+		t.Fatalf("writer has not taken e1")
+	}
+	send(t, conn, "e2")
+	send(t, conn, "e3")
+	return conn, sink
+}
+
+func send(t *testing.T, conn *Connection, id model.EventID) {
+	t.Helper()
+
+	err := conn.Send(&model.Event{ID: id})
+	if err != nil {
+		t.Fatalf("send %s: %v", id, err)
+	}
+}
+
+func TestDropNewestPolicy(t *testing.T) {
+	conn, sink := connectSlow(t, DropNewestPolicy)
+
+	send(t, conn, "e4")
+	if conn.Dropped() != 1 {
+		t.Fatalf("dropped: expected 1, got %d", conn.Dropped())
+	}
+
+	close(sink.release)
+	sink.expect(t, "e2", "e3")
+}
+
+func TestDropOldestPolicy(t *testing.T) {
+	conn, sink := connectSlow(t, DropOldestPolicy)
+
+	send(t, conn, "e4")
+	send(t, conn, "e5")
+	if conn.Dropped() != 2 {
+		t.Fatalf("dropped: expected 2, got %d", conn.Dropped())
+	}
+
+	close(sink.release)
+	sink.expect(t, "e4", "e5")
+}
+
+func TestDisconnectPolicy(t *testing.T) {
+	conn, sink := connectSlow(t, DisconnectPolicy)
+
+	err := conn.Send(&model.Event{ID: "e4"})
+	if err == nil {
+		t.Fatalf("event is sent to the full queue")
+	}
+	select {
+	case <-conn.Done():
+	default:
+		t.Fatalf("slow connection is not closed")
+	}
+
+	err = conn.Send(&model.Event{ID: "e5"})
+	if err == nil {
+		t.Fatalf("event is sent to the closed connection")
+	}
+	close(sink.release)
+}
@@ -0,0 +1,100 @@
+package connections_pool
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/syth0le/realtime-notification-service/internal/model"
+)
+
+type grpcSend struct {
+	event  *model.Event
+	result chan error
+}
+
+// GRPCSink writes events to the server stream of a grpc call, ctx is the context of the call.
+// grpc allows to send only from the handler of the call, so events are passed to the handler serving the sink
+type GRPCSink struct {
+	ctx   context.Context
+	sends chan grpcSend
+
+	closed atomic.Bool
+}
+
+func NewGRPCSink(ctx context.Context) *GRPCSink {
+	return &GRPCSink{
+		ctx:   ctx,
+		sends: make(chan grpcSend),
+	}
+}
+
+// Serve sends events written to the sink until the call ends or done is closed, it must be called by the handler of the call
+func (s *GRPCSink) Serve(done <-chan struct{}, send func(event *model.Event) error) error {
+	for {
+		select {
+		case req := <-s.sends:
+			req.result <- send(req.event)
+		case <-done:
+			return nil
+		case <-s.ctx.Done():
+			return s.ctx.Err()
+		}
+	}
+}
+
+// Write passes event to the handler and waits until it is sent, grpc stream has no write deadline so the deadline is awaited aside.
+// Send blocked after the deadline is released when the call ends
+func (s *GRPCSink) Write(event *model.Event, deadline time.Time) error {
+	if s.closed.Load() {
+		return fmt.Errorf("sink closed")
+	}
+
+	var expired <-chan time.Time
+	if !deadline.IsZero() {
+		timer := time.NewTimer(time.Until(deadline))
+		defer timer.Stop()
+		expired = timer.C
+	}
+
+	req := grpcSend{event: event, result: make(chan error, 1)}
+	select {
+	case s.sends <- req:
+	case <-expired:
+		return fmt.Errorf("write deadline exceeded")
+	case <-s.ctx.Done():
+		return fmt.Errorf("call ended: %w", s.ctx.Err())
+	}
+
+	select {
+	case err := <-req.result:
+		return err
+	case <-expired:
+		return fmt.Errorf("write deadline exceeded")
+	case <-s.ctx.Done():
+		return fmt.Errorf("call ended: %w", s.ctx.Err())
+	}
+}
+
+// Ping checks the call only, http/2 keepalive of the grpc server detects dead clients
+func (s *GRPCSink) Ping(deadline time.Time) error {
+	if err := s.ctx.Err(); err != nil {
+		return fmt.Errorf("call ended: %w", err)
+	}
+	return nil
+}
+
+// Close does not end the call, handler of the call returns when the connection is closed
+func (s *GRPCSink) Close() error {
+	s.closed.Store(true)
+	return nil
+}
+
+func (s *GRPCSink) Transport() model.Transport {
+	return model.GRPCTransport
+}
+
+func (s *GRPCSink) AnswersPings() bool {
+	return false
+}
@@ -0,0 +1,77 @@
+package connections_pool
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/syth0le/realtime-notification-service/internal/model"
+)
+
+func TestGRPCSinkSendsFromServingHandler(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sink := NewGRPCSink(ctx)
+
+	// nothing sends while the handler does not serve the sink
+	err := sink.Write(&model.Event{ID: "e1"}, time.Now().Add(testQuiet))
+	if err == nil {
+		t.Fatalf("event is written to the sink not being served")
+	}
+
+	sent := make(chan model.EventID, 1)
+	done := make(chan struct{})
+	served := make(chan error, 1)
+	go func() {
+		served <- sink.Serve(done, func(event *model.Event) error {
+			sent <- event.ID
+			return nil
+		})
+	}()
+
+	err = sink.Write(&model.Event{ID: "e2"}, time.Now().Add(testWait))
+	if err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if id := <-sent; id != "e2" {
+		t.Fatalf("unexpected event %s, expected e2", id)
+	}
+
+	close(done)
+	if err = <-served; err != nil {
+		t.Fatalf("serve: %v", err)
+	}
+}
+
+func TestGRPCSinkWriteEndsWithCall(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	sink := NewGRPCSink(ctx)
+
+	served := make(chan error, 1)
+	go func() {
+		served <- sink.Serve(nil, func(event *model.Event) error {
+			<-ctx.Done()
+			return ctx.Err()
+		})
+	}()
+
+	written := make(chan error, 1)
+	go func() {
+		written <- sink.Write(&model.Event{ID: "e1"}, time.Time{})
+	}()
+
+	cancel()
+	select {
+	case err := <-written:
+		if err == nil {
+			t.Fatalf("write succeeded after the call ended")
+		}
+	case <-time.After(testWait):
+		t.Fatalf("write is not released when the call ended")
+	}
+	select {
+	case <-served:
+	case <-time.After(testWait):
+		t.Fatalf("handler does not return when the call ended")
+	}
+}
@@ -0,0 +1,190 @@
+package connections_pool
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/syth0le/realtime-notification-service/internal/model"
+)
+
+type PolledEvent struct {
+	Seq   uint64
+	Event *model.Event
+}
+
+// LongPollSink buffers events between polls, buffered events are removed only
+// after the client acknowledges them by passing the cursor of the next poll.
+// Sink is idle when the client has not polled for idle timeout, it does not depend on heartbeat to be reaped
+type LongPollSink struct {
+	bufferSize  int
+	idleTimeout time.Duration
+
+	events   []PolledEvent
+	seq      uint64
+	polling  int
+	lastPoll time.Time
+	closed   bool
+
+	// wake is closed and replaced on every write, so every concurrent poll of the session is woken up
+	wake chan struct{}
+
+	idle      chan struct{}
+	idleTimer *time.Timer
+	idleOnce  sync.Once
+
+	mutex sync.Mutex
+}
+
+func NewLongPollSink(bufferSize int, idleTimeout time.Duration) *LongPollSink {
+	s := &LongPollSink{
+		bufferSize:  bufferSize,
+		idleTimeout: idleTimeout,
+		lastPoll:    time.Now(),
+		wake:        make(chan struct{}),
+		idle:        make(chan struct{}),
+		mutex:       sync.Mutex{},
+	}
+	s.idleTimer = time.AfterFunc(idleTimeout, s.checkIdle)
+	return s
+}
+
+func (s *LongPollSink) Write(event *model.Event, _ time.Time) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.closed {
+		return fmt.Errorf("sink closed")
+	}
+
+	s.seq++
+	s.events = append(s.events, PolledEvent{Seq: s.seq, Event: event})
+	if len(s.events) > s.bufferSize {
+		s.events = s.events[len(s.events)-s.bufferSize:]
+	}
+
+	close(s.wake)
+	s.wake = make(chan struct{})
+	return nil
+}
+
+// Ping fails when the client has not polled for longer than idle timeout, so abandoned sink is reaped
+func (s *LongPollSink) Ping(_ time.Time) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.isIdle() {
+		return fmt.Errorf("long poll idle timeout exceeded")
+	}
+	return nil
+}
+
+// Idle is closed when the client has not polled for idle timeout, owner of the session closes the connection then
+func (s *LongPollSink) Idle() <-chan struct{} {
+	return s.idle
+}
+
+func (s *LongPollSink) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if !s.closed {
+		s.closed = true
+		s.idleTimer.Stop()
+		close(s.wake)
+	}
+	return nil
+}
+
+func (s *LongPollSink) Transport() model.Transport {
+	return model.LongPollingTransport
+}
+
+func (s *LongPollSink) AnswersPings() bool {
+	return false
+}
+
+// Poll drops events acknowledged by cursor and waits until new events arrive or timeout elapses.
+// Concurrent polls of the session get the same events
+func (s *LongPollSink) Poll(ctx context.Context, cursor uint64, timeout time.Duration) ([]PolledEvent, uint64, error) {
+	s.begin(cursor)
+	defer s.end()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	for {
+		events, wake, closed := s.pending(cursor)
+		if len(events) > 0 {
+			return events, events[len(events)-1].Seq, nil
+		}
+		if closed {
+			return nil, cursor, fmt.Errorf("sink closed")
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, cursor, ctx.Err()
+		case <-timer.C:
+			return nil, cursor, nil
+		case <-wake:
+		}
+	}
+}
+
+func (s *LongPollSink) begin(cursor uint64) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.polling++
+	s.lastPoll = time.Now()
+	s.idleTimer.Stop()
+
+	acked := 0
+	for acked < len(s.events) && s.events[acked].Seq <= cursor {
+		acked++
+	}
+	s.events = s.events[acked:]
+}
+
+func (s *LongPollSink) end() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.polling--
+	s.lastPoll = time.Now()
+	if s.polling == 0 && !s.closed {
+		s.idleTimer.Reset(s.idleTimeout)
+	}
+}
+
+// checkIdle is called by the idle timer, poll which has begun after the timer fired keeps the sink alive
+func (s *LongPollSink) checkIdle() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.closed || !s.isIdle() {
+		return
+	}
+	s.idleOnce.Do(func() {
+		close(s.idle)
+	})
+}
+
+func (s *LongPollSink) isIdle() bool {
+	return s.polling == 0 && time.Since(s.lastPoll) >= s.idleTimeout
+}
+
+func (s *LongPollSink) pending(cursor uint64) ([]PolledEvent, <-chan struct{}, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var res []PolledEvent
+	for _, event := range s.events {
+		if event.Seq > cursor {
+			res = append(res, event)
+		}
+	}
+	return res, s.wake, s.closed
+}
@@ -0,0 +1,157 @@
+package connections_pool
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/syth0le/realtime-notification-service/internal/model"
+)
+
+const (
+	testPollTimeout = 5 * time.Second
+	testIdleTimeout = 200 * time.Millisecond
+)
+
+type pollResult struct {
+	events []PolledEvent
+	cursor uint64
+	err    error
+}
+
+func poll(sink *LongPollSink, cursor uint64) <-chan pollResult {
+	res := make(chan pollResult, 1)
+	go func() {
+		events, cursor, err := sink.Poll(context.Background(), cursor, testPollTimeout)
+		res <- pollResult{events: events, cursor: cursor, err: err}
+	}()
+	return res
+}
+
+func waitPolling(t *testing.T, sink *LongPollSink, polling int) {
+	t.Helper()
+
+	deadline := time.Now().Add(testPollTimeout)
+	for time.Now().Before(deadline) {
+		sink.mutex.Lock()
+		current := sink.polling
+		sink.mutex.Unlock()
+		if current == polling {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("sink is not polled by %d polls", polling)
+}
+
+func TestConcurrentPollsAreWokenUp(t *testing.T) {
+	sink := NewLongPollSink(16, time.Minute)
+	defer sink.Close()
+
+	first, second := poll(sink, 0), poll(sink, 0)
+	waitPolling(t, sink, 2)
+
+	err := sink.Write(&model.Event{ID: "e1"}, time.Now())
+	if err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	for _, polled := range []<-chan pollResult{first, second} {
+		select {
+		case res := <-polled:
+			if res.err != nil || len(res.events) != 1 || res.events[0].Event.ID != "e1" || res.cursor != 1 {
+				t.Fatalf("unexpected poll result: %+v", res)
+			}
+		case <-time.After(testPollTimeout):
+			t.Fatalf("poll is not woken up by the write")
+		}
+	}
+}
+
+func TestIdleSinkIsReported(t *testing.T) {
+	sink := NewLongPollSink(16, testIdleTimeout)
+	defer sink.Close()
+
+	// poll in flight keeps the sink alive for longer than idle timeout
+	res := poll(sink, 0)
+	waitPolling(t, sink, 1)
+	select {
+	case <-sink.Idle():
+		t.Fatalf("sink being polled is idle")
+	case <-time.After(2 * testIdleTimeout):
+	}
+
+	err := sink.Write(&model.Event{ID: "e1"}, time.Now())
+	if err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	<-res
+
+	select {
+	case <-sink.Idle():
+	case <-time.After(testPollTimeout):
+		t.Fatalf("sink is not idle after the client stopped polling")
+	}
+	if err = sink.Ping(time.Now()); err == nil {
+		t.Fatalf("idle sink answers ping")
+	}
+}
+
+func assertPolled(t *testing.T, res pollResult, cursor uint64, ids ...model.EventID) {
+	t.Helper()
+
+	if res.err != nil {
+		t.Fatalf("poll: %v", res.err)
+	}
+	if res.cursor != cursor || len(res.events) != len(ids) {
+		t.Fatalf("unexpected poll result: cursor %d, %d events, expected cursor %d, events %v", res.cursor, len(res.events), cursor, ids)
+	}
+	for i, event := range res.events {
+		if event.Event.ID != ids[i] {
+			t.Fatalf("unexpected event %s at %d, expected %s", event.Event.ID, i, ids[i])
+		}
+	}
+}
+
+func TestPollCursorAcknowledgesEvents(t *testing.T) {
+	sink := NewLongPollSink(16, time.Minute)
+	defer sink.Close()
+
+	for _, id := range []model.EventID{"e1", "e2"} {
+		if err := sink.Write(&model.Event{ID: id}, time.Now()); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+	assertPolled(t, <-poll(sink, 0), 2, "e1", "e2")
+
+	// response is lost, so the client polls with the previous cursor and gets the events again
+	assertPolled(t, <-poll(sink, 0), 2, "e1", "e2")
+
+	// cursor acknowledges events up to it, they are removed from the buffer
+	if err := sink.Write(&model.Event{ID: "e3"}, time.Now()); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	assertPolled(t, <-poll(sink, 1), 3, "e2", "e3")
+
+	// acknowledged events are not returned even for a stale cursor
+	events, cursor, err := sink.Poll(context.Background(), 3, testQuiet)
+	if err != nil || len(events) != 0 || cursor != 3 {
+		t.Fatalf("unexpected poll result: cursor %d, %d events, err %v", cursor, len(events), err)
+	}
+	events, _, err = sink.Poll(context.Background(), 0, testQuiet)
+	if err != nil || len(events) != 0 {
+		t.Fatalf("acknowledged events are polled again: %d events, err %v", len(events), err)
+	}
+}
+
+func TestPollBufferKeepsNewestEvents(t *testing.T) {
+	sink := NewLongPollSink(2, time.Minute)
+	defer sink.Close()
+
+	for _, id := range []model.EventID{"e1", "e2", "e3"} {
+		if err := sink.Write(&model.Event{ID: id}, time.Now()); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+	assertPolled(t, <-poll(sink, 0), 3, "e2", "e3")
+}
@@ -0,0 +1,17 @@
+package connections_pool
+
+import (
+	"time"
+
+	"github.com/syth0le/realtime-notification-service/internal/model"
+)
+
+// Sink is a transport specific writer of a pooled connection
+type Sink interface {
+	Write(event *model.Event, deadline time.Time) error
+	Ping(deadline time.Time) error
+	Close() error
+	Transport() model.Transport
+	// AnswersPings reports whether the client replies to pings, otherwise successful ping keeps connection alive
+	AnswersPings() bool
+}
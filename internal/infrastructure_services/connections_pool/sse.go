@@ -0,0 +1,93 @@
+package connections_pool
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/syth0le/realtime-notification-service/internal/model"
+)
+
+// SSESink writes events in text/event-stream format, it must be closed before the http handler returns.
+// Events of the default type are written without event field, so they are received by EventSource.onmessage,
+// events of other types are received by listeners of their type
+type SSESink struct {
+	writer      http.ResponseWriter
+	controller  *http.ResponseController
+	defaultType model.NotificationType
+
+	closed bool
+	mutex  sync.Mutex
+}
+
+func NewSSESink(w http.ResponseWriter, defaultType model.NotificationType) *SSESink {
+	return &SSESink{
+		writer:      w,
+		controller:  http.NewResponseController(w),
+		defaultType: defaultType,
+		mutex:       sync.Mutex{},
+	}
+}
+
+func (s *SSESink) Write(event *model.Event, deadline time.Time) error {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "id: %s\n", event.ID)
+	if event.Type != "" && event.Type != s.defaultType {
+		fmt.Fprintf(&buf, "event: %s\n", event.Type)
+	}
+	for _, line := range bytes.Split(event.Data, []byte("\n")) {
+		fmt.Fprintf(&buf, "data: %s\n", line)
+	}
+	buf.WriteString("\n")
+
+	return s.write(buf.Bytes(), deadline)
+}
+
+func (s *SSESink) Ping(deadline time.Time) error {
+	return s.write([]byte(": ping\n\n"), deadline)
+}
+
+func (s *SSESink) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.closed = true
+	return nil
+}
+
+func (s *SSESink) Transport() model.Transport {
+	return model.ServerSentEventsTransport
+}
+
+func (s *SSESink) AnswersPings() bool {
+	return false
+}
+
+func (s *SSESink) write(payload []byte, deadline time.Time) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.closed {
+		return fmt.Errorf("sink closed")
+	}
+
+	err := s.controller.SetWriteDeadline(deadline)
+	if err != nil && !errors.Is(err, http.ErrNotSupported) {
+		return fmt.Errorf("set write deadline: %w", err)
+	}
+
+	_, err = s.writer.Write(payload)
+	if err != nil {
+		return fmt.Errorf("write: %w", err)
+	}
+
+	err = s.controller.Flush()
+	if err != nil {
+		return fmt.Errorf("flush: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,79 @@
+package connections_pool
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/gobwas/ws"
+	"github.com/gobwas/ws/wsutil"
+
+	"github.com/syth0le/realtime-notification-service/internal/model"
+)
+
+const EventFrameType = "event"
+
+type WebSocketSink struct {
+	Conn net.Conn
+
+	// framed sink wraps events into protocol frames, otherwise bare payloads are written as the legacy feed expects
+	framed bool
+
+	writeMutex sync.Mutex
+}
+
+func NewWebSocketSink(conn net.Conn, framed bool) *WebSocketSink {
+	return &WebSocketSink{
+		Conn:       conn,
+		framed:     framed,
+		writeMutex: sync.Mutex{},
+	}
+}
+
+type eventFrame struct {
+	Type  string          `json:"type"`
+	Event json.RawMessage `json:"event"`
+}
+
+func (s *WebSocketSink) Write(event *model.Event, deadline time.Time) error {
+	if !s.framed {
+		return s.WriteMessage(ws.OpText, event.Payload, deadline)
+	}
+
+	frame, err := json.Marshal(eventFrame{Type: EventFrameType, Event: event.Data})
+	if err != nil {
+		return fmt.Errorf("marshal event frame: %w", err)
+	}
+	return s.WriteMessage(ws.OpText, frame, deadline)
+}
+
+func (s *WebSocketSink) Ping(deadline time.Time) error {
+	return s.WriteMessage(ws.OpPing, nil, deadline)
+}
+
+// WriteMessage writes a server frame, writes of data and control frames are serialized
+func (s *WebSocketSink) WriteMessage(op ws.OpCode, payload []byte, deadline time.Time) error {
+	s.writeMutex.Lock()
+	defer s.writeMutex.Unlock()
+
+	err := s.Conn.SetWriteDeadline(deadline)
+	if err != nil {
+		return fmt.Errorf("set write deadline: %w", err)
+	}
+
+	return wsutil.WriteServerMessage(s.Conn, op, payload)
+}
+
+func (s *WebSocketSink) Close() error {
+	return s.Conn.Close()
+}
+
+func (s *WebSocketSink) Transport() model.Transport {
+	return model.WebSocketTransport
+}
+
+func (s *WebSocketSink) AnswersPings() bool {
+	return true
+}
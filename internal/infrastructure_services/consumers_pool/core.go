@@ -1,125 +1,252 @@
 package consumers_pool
 
 import (
+	"errors"
 	"fmt"
-	"log"
 	"sync"
+	"time"
 
-	"github.com/gobwas/ws"
-	"github.com/gobwas/ws/wsutil"
-	"github.com/wagslane/go-rabbitmq"
 	"go.uber.org/zap"
 
-	"github.com/syth0le/realtime-notification-service/internal/clients/rabbit"
-	"github.com/syth0le/realtime-notification-service/internal/infrastructure_services/connections_pool"
+	"github.com/syth0le/realtime-notification-service/internal/clients/broker"
+	"github.com/syth0le/realtime-notification-service/internal/infrastructure_services/dispatcher"
+	"github.com/syth0le/realtime-notification-service/internal/infrastructure_services/inbox"
 	"github.com/syth0le/realtime-notification-service/internal/model"
+	"github.com/syth0le/realtime-notification-service/internal/utils"
 )
 
 type Service interface {
-	AddConsumer(userID *model.UserID) error
+	Run() []func() error
+	Close() error
+	Subscribe(userID *model.UserID) error
+	Unsubscribe(userID *model.UserID) error
 }
 
 type ServiceImpl struct {
 	logger *zap.Logger
 
-	pool map[model.UserID]rabbit.Consumer
+	consumers []broker.Subscriber
+	binder    broker.Binder
+	retrier   broker.Retrier
 
-	mutex sync.Mutex
+	subscriptions map[model.UserID]int
+	mutex         sync.Mutex
 
-	conn *rabbitmq.Conn
-
-	enable       bool
-	queueName    string
-	exchangeName string
-
-	connectionsPoolService connections_pool.Service
+	dispatcherService dispatcher.Service
 }
 
 func NewServiceImpl(
 	logger *zap.Logger,
-	conn *rabbitmq.Conn,
-	enable bool,
-	queueName string,
-	exchangeName string,
-	connectionsPoolService connections_pool.Service,
+	consumers []broker.Subscriber,
+	binder broker.Binder,
+	retrier broker.Retrier,
+	dispatcherService dispatcher.Service,
 ) *ServiceImpl {
 	return &ServiceImpl{
-		logger:                 logger,
-		pool:                   make(map[model.UserID]rabbit.Consumer),
-		mutex:                  sync.Mutex{},
-		conn:                   conn,
-		enable:                 enable,
-		queueName:              queueName,
-		exchangeName:           exchangeName,
-		connectionsPoolService: connectionsPoolService,
+		logger:            logger,
+		consumers:         consumers,
+		binder:            binder,
+		retrier:           retrier,
+		subscriptions:     make(map[model.UserID]int),
+		mutex:             sync.Mutex{},
+		dispatcherService: dispatcherService,
+	}
+}
+
+func (s *ServiceImpl) Run() []func() error {
+	response := make([]func() error, 0, len(s.consumers))
+	for _, consumer := range s.consumers {
+		consumer := consumer
+		response = append(response, func() error {
+			err := consumer.Run(s.handleMessage)
+			if err != nil {
+				return fmt.Errorf("consumer run: %w", err)
+			}
+			return nil
+		})
 	}
+	return response
+}
+
+func (s *ServiceImpl) Close() error {
+	for _, consumer := range s.consumers {
+		err := consumer.Close()
+		if err != nil {
+			return fmt.Errorf("consumer close: %w", err)
+		}
+	}
+
+	err := s.binder.Close()
+	if err != nil {
+		return fmt.Errorf("binder close: %w", err)
+	}
+
+	err = s.retrier.Close()
+	if err != nil {
+		return fmt.Errorf("retrier close: %w", err)
+	}
+	return nil
 }
 
-func (s *ServiceImpl) AddConsumer(userID *model.UserID) error {
+// Subscribe starts routing user's deliveries to the node queue, it must be called once per user connection.
+// Failed subscription is not counted, so the user is bound again on the next subscribe
+func (s *ServiceImpl) Subscribe(userID *model.UserID) error {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 
-	if _, ok := s.pool[*userID]; ok {
+	if s.subscriptions[*userID] > 0 {
+		s.subscriptions[*userID]++
 		return nil
 	}
 
-	consumer, err := rabbit.NewRabbitConsumer(
-		s.logger,
-		s.enable,
-		s.queueName,
-		s.exchangeName,
-		userID.String(),
-		s.conn,
-	)
+	err := s.binder.Bind(userID.String())
 	if err != nil {
-		return fmt.Errorf("new rabbit consumer for user: %s: %w", userID, err)
+		return fmt.Errorf("bind user %s: %w", userID, err)
 	}
 
-	s.pool[*userID] = consumer
+	s.subscriptions[*userID] = 1
+	return nil
+}
+
+// Unsubscribe stops routing user's deliveries to the node queue when the last user connection is gone
+func (s *ServiceImpl) Unsubscribe(userID *model.UserID) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.subscriptions[*userID] == 0 {
+		return nil
+	}
+
+	s.subscriptions[*userID]--
+	if s.subscriptions[*userID] > 0 {
+		return nil
+	}
+	delete(s.subscriptions, *userID)
 
-	go s.runConsumer(consumer, userID)
+	err := s.binder.Unbind(userID.String())
+	if err != nil {
+		return fmt.Errorf("unbind user %s: %w", userID, err)
+	}
 	return nil
 }
 
-func (s *ServiceImpl) runConsumer(consumer rabbit.Consumer, userID *model.UserID) error {
-	defer consumer.Close()
+// handleMessage routes a notification to the recipient's connections.
+// Malformed notification is dead-lettered, failed dispatch is retried with backoff
+func (s *ServiceImpl) handleMessage(msg *broker.Message) {
+	s.logger.Sugar().Debugf("consumed: %s: %v", msg.Key, string(msg.Body))
 
-	err := consumer.Run(func(d rabbitmq.Delivery) rabbitmq.Action {
-		log.Printf("consumed: %v", string(d.Body))
+	notification, err := notificationFromMessage(msg)
+	if err != nil {
+		s.logger.Sugar().Errorf("decode notification: %v", err)
+		s.deadLetter(msg, fmt.Sprintf("decode notification: %v", err))
+		return
+	}
 
-		post := new(model.Post)
-		err := post.UnmarshalBinary(d.Body)
-		if err != nil {
-			s.logger.Sugar().Errorf("unmarshal binary: %v", err)
-			return rabbitmq.NackDiscard
+	err = notification.Validate()
+	if err != nil {
+		if errors.Is(err, model.ErrUnknownNotificationType) {
+			s.logger.Sugar().Warnf("unknown notification %s: %v", notification.ID, err)
+		} else {
+			s.logger.Sugar().Errorf("invalid notification %s: %v", notification.ID, err)
 		}
+		s.deadLetter(msg, fmt.Sprintf("invalid notification: %v", err))
+		return
+	}
 
-		connections, err := s.connectionsPoolService.GetUserConnections(userID)
-		if err != nil {
-			s.logger.Sugar().Errorf("get user connections: %v", err)
-			return rabbitmq.NackDiscard
-		}
+	event, err := model.NewEvent(notification)
+	if err != nil {
+		s.logger.Sugar().Errorf("new event: %v", err)
+		s.deadLetter(msg, fmt.Sprintf("new event: %v", err))
+		return
+	}
+
+	// event awaiting client acknowledgement is persisted by the dispatcher, so the message is settled right away
+	err = s.dispatcherService.Dispatch(event)
+	if err != nil {
+		s.logger.Sugar().Debugf("dispatch event: %s: %v", event.UserID, err)
+	}
+
+	switch {
+	case errors.Is(err, inbox.ErrDisabled):
+		// user is offline and there is nowhere to keep the notification
+		s.settle(msg, msg.Nack)
+	case err != nil:
+		s.retry(msg, fmt.Sprintf("dispatch event: %v", err))
+	default:
+		s.settle(msg, msg.Ack)
+	}
+}
+
+// deadLetter hands message over to the dead-letter queue, message is discarded if it cannot be handed over
+func (s *ServiceImpl) deadLetter(msg *broker.Message, reason string) {
+	err := s.retrier.DeadLetter(msg, reason)
+	if err != nil {
+		s.logger.Sugar().Errorf("dead letter: %v", err)
+		s.settle(msg, msg.Nack)
+		return
+	}
+	s.settle(msg, msg.Ack)
+}
+
+// retry hands message over to be delivered later, message is requeued if it cannot be handed over
+func (s *ServiceImpl) retry(msg *broker.Message, reason string) {
+	err := s.retrier.Retry(msg, reason)
+	if err != nil {
+		s.logger.Sugar().Errorf("retry: %v", err)
+		s.settle(msg, msg.Requeue)
+		return
+	}
+	s.settle(msg, msg.Ack)
+}
 
-		if len(connections) == 0 {
-			s.logger.Sugar().Infof("empty list of connections: %v", err)
-			s.pool[*userID].Close()
-			delete(s.pool, *userID)
-			return rabbitmq.NackRequeue
+func (s *ServiceImpl) settle(msg *broker.Message, settle func() error) {
+	err := settle()
+	if err != nil {
+		s.logger.Sugar().Errorf("settle message %s: %v", msg.ID, err)
+	}
+}
+
+// notificationFromMessage decodes notification envelope, missing envelope fields are taken from the message.
+// Bare social-network post is wrapped into feed.posted notification
+func notificationFromMessage(msg *broker.Message) (*model.Notification, error) {
+	notification := new(model.Notification)
+	err := notification.UnmarshalBinary(msg.Body)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshal binary: %w", err)
+	}
+
+	if notification.Type == "" {
+		post := new(model.Post)
+		err = post.UnmarshalBinary(msg.Body)
+		if err != nil {
+			return nil, fmt.Errorf("unmarshal post: %w", err)
 		}
 
-		for _, conn := range connections {
-			err = wsutil.WriteServerMessage(conn, ws.OpText, d.Body)
-			if err != nil {
-				s.logger.Sugar().Errorf("write message body: %v", err)
-				err := s.connectionsPoolService.DeleteConnection(userID, conn)
-				if err != nil {
-					s.logger.Sugar().Errorf("delete connection: %v", err)
-				}
-			}
+		notification = &model.Notification{
+			Type:    model.FeedPostedType,
+			Actor:   post.AuthorID,
+			Payload: msg.Body,
 		}
+	}
 
-		return rabbitmq.Ack
-	})
+	if notification.ID == "" {
+		notification.ID = model.EventID(msg.ID)
+	}
+	if notification.ID == "" {
+		notification.ID = model.EventID(utils.GenerateEUID())
+	}
+	if notification.Version == 0 {
+		notification.Version = model.CurrentNotificationVersion
+	}
+	if notification.CreatedAt.IsZero() {
+		notification.CreatedAt = msg.Timestamp
+	}
+	if notification.CreatedAt.IsZero() {
+		notification.CreatedAt = time.Now()
+	}
+	if notification.Recipient == "" {
+		notification.Recipient = model.UserID(msg.Key)
+	}
 
-	return err
+	return notification, nil
 }
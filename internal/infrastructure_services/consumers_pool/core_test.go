@@ -0,0 +1,467 @@
+package consumers_pool
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/syth0le/realtime-notification-service/internal/clients/broker"
+	"github.com/syth0le/realtime-notification-service/internal/clients/broker/brokertest"
+	"github.com/syth0le/realtime-notification-service/internal/infrastructure_services/acknowledgements"
+	"github.com/syth0le/realtime-notification-service/internal/infrastructure_services/connections_pool"
+	"github.com/syth0le/realtime-notification-service/internal/infrastructure_services/dispatcher"
+	"github.com/syth0le/realtime-notification-service/internal/infrastructure_services/history"
+	"github.com/syth0le/realtime-notification-service/internal/infrastructure_services/inbox"
+	"github.com/syth0le/realtime-notification-service/internal/model"
+)
+
+const (
+	testTopic        = "events"
+	testQueue        = "notifications.node-1"
+	testOfflineQueue = "notifications.offline"
+	testMaxAttempts  = 3
+	testWait         = 2 * time.Second
+	testQuiet        = 200 * time.Millisecond
+)
+
+// testNode is a node consuming the per-node queue of the memory broker
+type testNode struct {
+	broker      *broker.MemoryBroker
+	connections *connections_pool.ServiceImpl
+	acks        acknowledgements.Service
+	dispatcher  *dispatcher.ServiceImpl
+	consumers   *ServiceImpl
+}
+
+func newTestNode(t *testing.T, acks acknowledgements.Service, inboxService inbox.Service) *testNode {
+	t.Helper()
+
+	logger := zap.NewNop()
+	memoryBroker := broker.NewMemoryBroker(logger, testMaxAttempts, 10*time.Millisecond, 20*time.Millisecond)
+	memoryBroker.DeclareQueue(testQueue, testTopic)
+	memoryBroker.DeclareAlternateQueue(testOfflineQueue, testTopic)
+
+	connections := connections_pool.NewServiceImpl(logger, 16, connections_pool.DisconnectPolicy, time.Second)
+	dispatcherService := dispatcher.NewServiceImpl(logger, connections, history.NewServiceImpl(16, time.Hour, time.Minute), acks, inboxService)
+	consumers := NewServiceImpl(
+		logger,
+		[]broker.Subscriber{memoryBroker.NewSubscriber(testQueue), memoryBroker.NewSubscriber(testOfflineQueue)},
+		memoryBroker.NewBinder(testQueue, testTopic),
+		memoryBroker,
+		dispatcherService,
+	)
+
+	for _, run := range consumers.Run() {
+		go run()
+	}
+	t.Cleanup(func() {
+		consumers.Close()
+		memoryBroker.Close()
+	})
+
+	return &testNode{
+		broker:      memoryBroker,
+		connections: connections,
+		acks:        acks,
+		dispatcher:  dispatcherService,
+		consumers:   consumers,
+	}
+}
+
+// connect attaches connection of the user and binds the user to the node queue, as the notifications service does
+func (n *testNode) connect(t *testing.T, userID model.UserID) *recordingSink {
+	t.Helper()
+
+	_, sink := n.connectWithAcks(t, userID, false, model.FeedPostedType)
+	return sink
+}
+
+// connectWithAcks attaches connection of the user with the topics, events written to the connection with client acks stay pending
+func (n *testNode) connectWithAcks(
+	t *testing.T,
+	userID model.UserID,
+	clientAcks bool,
+	topics ...model.NotificationType,
+) (*connections_pool.Connection, *recordingSink) {
+	t.Helper()
+
+	sink := newRecordingSink()
+	conn := connections_pool.NewConnection(userID, sink, "", "")
+	conn.ClientAcks = clientAcks
+	conn.SubscribeTopics(topics...)
+	n.dispatcher.Attach(conn, "")
+
+	err := n.consumers.Subscribe(&userID)
+	if err != nil {
+		t.Fatalf("subscribe %s: %v", userID, err)
+	}
+	return conn, sink
+}
+
+// disconnect removes connection and releases its subscription, as the notifications service does
+func (n *testNode) disconnect(t *testing.T, conn *connections_pool.Connection) {
+	t.Helper()
+
+	err := n.connections.DeleteConnection(&conn.UserID, conn.ID)
+	if err != nil {
+		t.Fatalf("delete connection: %v", err)
+	}
+	err = n.consumers.Unsubscribe(&conn.UserID)
+	if err != nil {
+		t.Fatalf("unsubscribe: %v", err)
+	}
+}
+
+func (n *testNode) publishPost(t *testing.T, messageID string, userID model.UserID) {
+	t.Helper()
+
+	n.publish(t, messageID, userID, []byte(fmt.Sprintf(`{"ID":"%s","Text":"text","AuthorID":"author"}`, messageID)))
+}
+
+func (n *testNode) publish(t *testing.T, messageID string, userID model.UserID, body []byte) {
+	t.Helper()
+
+	brokertest.PublishBody(t, n.broker, testTopic, messageID, userID.String(), body)
+}
+
+func TestRoutesToBoundUsers(t *testing.T) {
+	node := newTestNode(t, acknowledgements.NewServiceMock(), inbox.NewServiceMock())
+
+	conn, alice := node.connectWithAcks(t, "alice", false, model.FeedPostedType)
+	node.publishPost(t, "m1", "alice")
+	node.publishPost(t, "m2", "bob")
+
+	event := alice.next(t)
+	if event.ID != "m1" || event.UserID != "alice" || event.Type != model.FeedPostedType {
+		t.Fatalf("unexpected event: %+v", event)
+	}
+	// bob has no connection on the node, so the notification of bob is not routed to the node queue
+	alice.none(t)
+
+	node.disconnect(t, conn)
+	node.publishPost(t, "m3", "alice")
+	alice.none(t)
+}
+
+func TestOfflineUserIsPutToInbox(t *testing.T) {
+	inboxService := newMemoryInbox()
+	node := newTestNode(t, acknowledgements.NewServiceMock(), inboxService)
+
+	// bob is not bound to the node queue, so the notification is routed to the offline queue
+	node.connect(t, "alice")
+	node.publishPost(t, "m1", "bob")
+	waitInbox(t, inboxService, "bob", 1)
+
+	bob := node.connect(t, "bob")
+	if event := bob.next(t); event.ID != "m1" {
+		t.Fatalf("unexpected event from inbox: %+v", event)
+	}
+	assertInbox(t, inboxService, "bob")
+}
+
+func TestSubscriptionIsCountedPerConnection(t *testing.T) {
+	node := newTestNode(t, acknowledgements.NewServiceMock(), inbox.NewServiceMock())
+
+	alice := node.connect(t, "alice")
+	node.connect(t, "alice")
+
+	// the first of two connections is gone, the user is still bound
+	err := node.consumers.Unsubscribe(userIDPtr("alice"))
+	if err != nil {
+		t.Fatalf("unsubscribe: %v", err)
+	}
+	node.publishPost(t, "m1", "alice")
+	if event := alice.next(t); event.ID != "m1" {
+		t.Fatalf("unexpected event: %+v", event)
+	}
+}
+
+func TestAckedEventIsNotRedelivered(t *testing.T) {
+	inboxService := newMemoryInbox()
+	acks := acknowledgements.NewServiceImpl(zap.NewNop(), time.Hour, 3, nil, inboxService)
+	node := newTestNode(t, acks, inboxService)
+
+	_, alice := node.connectWithAcks(t, "alice", true, model.FeedPostedType)
+	node.publishPost(t, "m1", "alice")
+	alice.next(t)
+
+	// event is kept in the inbox until the client acknowledges it
+	waitPending(t, acks, "alice", 1)
+	assertInbox(t, inboxService, "alice", "m1")
+	acks.Ack(userIDPtr("alice"), "m1")
+	waitPending(t, acks, "alice", 0)
+	assertInbox(t, inboxService, "alice")
+
+	_, alice = node.connectWithAcks(t, "alice", true, model.FeedPostedType)
+	alice.none(t)
+}
+
+func TestUnackedEventIsRedeliveredOnReconnect(t *testing.T) {
+	inboxService := newMemoryInbox()
+	acks := acknowledgements.NewServiceImpl(zap.NewNop(), time.Hour, 3, nil, inboxService)
+	node := newTestNode(t, acks, inboxService)
+
+	conn, alice := node.connectWithAcks(t, "alice", true, model.FeedPostedType)
+	node.publishPost(t, "m1", "alice")
+	if event := alice.next(t); event.ID != "m1" {
+		t.Fatalf("unexpected event: %+v", event)
+	}
+	node.disconnect(t, conn)
+
+	// protocol socket is opened without topics, pending event is redelivered once the topic is subscribed
+	conn, alice = node.connectWithAcks(t, "alice", true)
+	alice.none(t)
+	node.dispatcher.Subscribe(conn, model.FeedPostedType)
+	if event := alice.next(t); event.ID != "m1" {
+		t.Fatalf("unexpected redelivered event: %+v", event)
+	}
+	alice.none(t)
+
+	// event is not acknowledged yet, so it is redelivered to the next connection as well
+	node.disconnect(t, conn)
+	_, alice = node.connectWithAcks(t, "alice", true, model.FeedPostedType)
+	if event := alice.next(t); event.ID != "m1" {
+		t.Fatalf("unexpected redelivered event: %+v", event)
+	}
+	alice.none(t)
+	assertInbox(t, inboxService, "alice", "m1")
+}
+
+func TestOfflineUserIsDroppedWithoutInbox(t *testing.T) {
+	node := newTestNode(t, acknowledgements.NewServiceMock(), inbox.NewServiceMock())
+
+	// user is bound, but the only connection of the user does not want feed notifications
+	sink := newRecordingSink()
+	conn := connections_pool.NewConnection("alice", sink, "", "")
+	node.dispatcher.Attach(conn, "")
+	err := node.consumers.Subscribe(userIDPtr("alice"))
+	if err != nil {
+		t.Fatalf("subscribe: %v", err)
+	}
+
+	node.publishPost(t, "m1", "alice")
+	sink.none(t)
+	assertDeadLetters(t, node.broker)
+}
+
+func TestMalformedMessageIsDeadLettered(t *testing.T) {
+	node := newTestNode(t, acknowledgements.NewServiceMock(), inbox.NewServiceMock())
+
+	alice := node.connect(t, "alice")
+	node.publish(t, "m1", "alice", []byte("not a notification"))
+	node.publish(t, "m2", "alice", []byte(`{"id":"m2","type":"unknown.type","version":1,"recipient":"alice","payload":{}}`))
+
+	letters := waitDeadLetters(t, node.broker, 2)
+	assertReason(t, letters[0], "m1", "decode notification")
+	assertReason(t, letters[1], "m2", "invalid notification")
+	if letters[0].Attempts != 1 {
+		t.Fatalf("malformed message is retried: %d attempts", letters[0].Attempts)
+	}
+	alice.none(t)
+}
+
+func TestFailedDispatchIsRetriedAndDeadLettered(t *testing.T) {
+	node := newTestNode(t, acknowledgements.NewServiceMock(), &failingInbox{})
+
+	// alice is bound without connections, so every dispatch puts the event to the failing inbox
+	err := node.consumers.Subscribe(userIDPtr("alice"))
+	if err != nil {
+		t.Fatalf("subscribe: %v", err)
+	}
+	node.publishPost(t, "m1", "alice")
+
+	letters := waitDeadLetters(t, node.broker, 1)
+	assertReason(t, letters[0], "m1", "dispatch event")
+	if letters[0].Attempts != testMaxAttempts {
+		t.Fatalf("dead-lettered after %d attempts, expected %d", letters[0].Attempts, testMaxAttempts)
+	}
+
+	// replayed dead letter is delivered once the user is connected
+	alice := node.connect(t, "alice")
+	err = node.broker.ReplayDeadLetter("m1")
+	if err != nil {
+		t.Fatalf("replay dead letter: %v", err)
+	}
+	if event := alice.next(t); event.ID != "m1" {
+		t.Fatalf("unexpected replayed event: %+v", event)
+	}
+	assertDeadLetters(t, node.broker)
+}
+
+func newMemoryInbox() *inbox.ServiceImpl {
+	return inbox.NewServiceImpl(zap.NewNop(), time.Hour, time.Hour, inbox.NewMemoryStore())
+}
+
+func assertInbox(t *testing.T, inboxService inbox.Service, userID model.UserID, expected ...model.EventID) {
+	t.Helper()
+
+	events, err := inboxService.List(&userID)
+	if err != nil {
+		t.Fatalf("list inbox: %v", err)
+	}
+	if len(events) != len(expected) {
+		t.Fatalf("inbox of %s: expected %v, got %d events", userID, expected, len(events))
+	}
+	for i, event := range events {
+		if event.ID != expected[i] {
+			t.Fatalf("inbox of %s: expected %v, got %s at %d", userID, expected, event.ID, i)
+		}
+	}
+}
+
+func waitInbox(t *testing.T, inboxService inbox.Service, userID model.UserID, expected int) {
+	t.Helper()
+
+	deadline := time.Now().Add(testWait)
+	for {
+		events, err := inboxService.List(&userID)
+		if err != nil {
+			t.Fatalf("list inbox: %v", err)
+		}
+		if len(events) == expected {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("inbox of %s: expected %d events, got %d", userID, expected, len(events))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func waitPending(t *testing.T, acks acknowledgements.Service, userID model.UserID, expected int) {
+	t.Helper()
+
+	deadline := time.Now().Add(testWait)
+	for len(acks.Pending(&userID)) != expected {
+		if time.Now().After(deadline) {
+			t.Fatalf("pending events of %s: expected %d, got %d", userID, expected, len(acks.Pending(&userID)))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func waitDeadLetters(t *testing.T, memoryBroker *broker.MemoryBroker, expected int) []*broker.DeadLetter {
+	t.Helper()
+
+	deadline := time.Now().Add(testWait)
+	for {
+		letters, err := memoryBroker.ListDeadLetters(expected + 1)
+		if err != nil {
+			t.Fatalf("list dead letters: %v", err)
+		}
+		if len(letters) >= expected {
+			if len(letters) > expected {
+				t.Fatalf("dead letters: expected %d, got %d", expected, len(letters))
+			}
+			return letters
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("dead letters: expected %d, got %d", expected, len(letters))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func assertDeadLetters(t *testing.T, memoryBroker *broker.MemoryBroker) {
+	t.Helper()
+
+	letters, err := memoryBroker.ListDeadLetters(1)
+	if err != nil {
+		t.Fatalf("list dead letters: %v", err)
+	}
+	if len(letters) != 0 {
+		t.Fatalf("unexpected dead letter: %+v", letters[0])
+	}
+}
+
+func assertReason(t *testing.T, letter *broker.DeadLetter, messageID string, reason string) {
+	t.Helper()
+
+	if letter.MessageID != messageID || !strings.HasPrefix(letter.Reason, reason) {
+		t.Fatalf("dead letter: expected %s with reason %q, got %s with reason %q", messageID, reason, letter.MessageID, letter.Reason)
+	}
+}
+
+// recordingSink passes written events to the test
+type recordingSink struct {
+	events chan *model.Event
+}
+
+func newRecordingSink() *recordingSink {
+	return &recordingSink{
+		events: make(chan *model.Event, 16),
+	}
+}
+
+func (s *recordingSink) next(t *testing.T) *model.Event {
+	t.Helper()
+
+	select {
+	case event := <-s.events:
+		return event
+	case <-time.After(testWait):
+		t.Fatalf("no event is written")
+		return nil
+	}
+}
+
+func (s *recordingSink) none(t *testing.T) {
+	t.Helper()
+
+	select {
+	case event := <-s.events:
+		t.Fatalf("unexpected event: %+v", event)
+	case <-time.After(testQuiet):
+	}
+}
+
+func (s *recordingSink) Write(event *model.Event, deadline time.Time) error {
+	s.events <- event
+	return nil
+}
+
+func (s *recordingSink) Ping(deadline time.Time) error {
+	return nil
+}
+
+func (s *recordingSink) Close() error {
+	return nil
+}
+
+func (s *recordingSink) Transport() model.Transport {
+	return model.WebSocketTransport
+}
+
+func (s *recordingSink) AnswersPings() bool {
+	return true
+}
+
+// failingInbox fails to keep events of offline users
+type failingInbox struct{}
+
+func (i *failingInbox) Run() error {
+	return nil
+}
+
+func (i *failingInbox) Close() error {
+	return nil
+}
+
+func (i *failingInbox) Put(event *model.Event) error {
+	return fmt.Errorf("inbox store is unavailable")
+}
+
+func (i *failingInbox) List(userID *model.UserID) ([]*model.Event, error) {
+	return nil, nil
+}
+
+func (i *failingInbox) Delete(userID *model.UserID, eventIDs ...model.EventID) error {
+	return nil
+}
+
+func userIDPtr(userID model.UserID) *model.UserID {
+	return &userID
+}
@@ -0,0 +1,328 @@
+package dispatcher
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"go.uber.org/zap"
+
+	"github.com/syth0le/realtime-notification-service/internal/infrastructure_services/acknowledgements"
+	"github.com/syth0le/realtime-notification-service/internal/infrastructure_services/connections_pool"
+	"github.com/syth0le/realtime-notification-service/internal/infrastructure_services/history"
+	"github.com/syth0le/realtime-notification-service/internal/infrastructure_services/inbox"
+	"github.com/syth0le/realtime-notification-service/internal/model"
+)
+
+// Service fans events out to user connections. Delivery is serialized per user, live events dispatched
+// while missed events are read for a connection are buffered, so replayed events always precede live ones
+type Service interface {
+	Dispatch(event *model.Event) error
+	Attach(conn *connections_pool.Connection, lastEventID model.EventID)
+	// Subscribe adds topics to the attached connection and delivers missed events of the added topics
+	Subscribe(conn *connections_pool.Connection, topics ...model.NotificationType)
+}
+
+// userState is locked while events are sent to the user connections, storages are accessed out of the lock
+type userState struct {
+	mutex sync.Mutex
+	refs  int
+
+	// replaying holds live events of connections whose missed events are being read
+	replaying map[model.ConnectionID][]*model.Event
+}
+
+type ServiceImpl struct {
+	logger *zap.Logger
+
+	connectionsPoolService connections_pool.Service
+	historyService         history.Service
+	ackService             acknowledgements.Service
+	inboxService           inbox.Service
+
+	users map[model.UserID]*userState
+	mutex sync.Mutex
+}
+
+func NewServiceImpl(
+	logger *zap.Logger,
+	connectionsPoolService connections_pool.Service,
+	historyService history.Service,
+	ackService acknowledgements.Service,
+	inboxService inbox.Service,
+) *ServiceImpl {
+	return &ServiceImpl{
+		logger:                 logger,
+		connectionsPoolService: connectionsPoolService,
+		historyService:         historyService,
+		ackService:             ackService,
+		inboxService:           inboxService,
+		users:                  make(map[model.UserID]*userState),
+		mutex:                  sync.Mutex{},
+	}
+}
+
+// Dispatch sends event to subscribed user connections, event which has no connection to be sent to is put to the inbox.
+// Event sent to a connection with client acknowledgements is put to the inbox as well and is removed when the client
+// acknowledges it, so the caller settles the broker message without waiting for the client
+func (s *ServiceImpl) Dispatch(event *model.Event) error {
+	s.historyService.Add(event)
+
+	state := s.acquire(event.UserID)
+	defer s.release(event.UserID, state)
+
+	state.mutex.Lock()
+	sent, awaitingAck := s.deliver(state, event)
+	state.mutex.Unlock()
+
+	if sent > 0 && !awaitingAck {
+		return nil
+	}
+
+	err := s.inboxService.Put(event)
+	switch {
+	case awaitingAck && errors.Is(err, inbox.ErrDisabled):
+		// event awaiting acknowledgement is kept by the ack service only
+		return nil
+	case awaitingAck && err != nil:
+		s.ackService.Ack(&event.UserID, event.ID)
+		return fmt.Errorf("put event awaiting acknowledgement to inbox: %w", err)
+	case err != nil:
+		return fmt.Errorf("put undelivered event to inbox: %w", err)
+	case awaitingAck:
+		return nil
+	}
+
+	// connection attached while the event was put may have read the inbox before the event was stored
+	state.mutex.Lock()
+	sent, awaitingAck = s.deliver(state, event)
+	state.mutex.Unlock()
+
+	if sent > 0 && !awaitingAck {
+		err = s.inboxService.Delete(&event.UserID, event.ID)
+		if err != nil {
+			s.logger.Sugar().Errorf("delete delivered inbox event: %s: %v", event.UserID, err)
+		}
+	}
+	return nil
+}
+
+// deliver sends event to subscribed user connections, event of a connection being replayed is buffered.
+// Event is tracked if it is sent to a connection with client acknowledgements and it is not pending yet
+func (s *ServiceImpl) deliver(state *userState, event *model.Event) (sent int, awaitingAck bool) {
+	// error means that user has no connections
+	connections, _ := s.connectionsPoolService.GetUserConnections(&event.UserID)
+
+	subscribed := make([]*connections_pool.Connection, 0, len(connections))
+	clientAcks := false
+	for _, conn := range connections {
+		if !conn.Subscribed(event.Type) {
+			continue
+		}
+		subscribed = append(subscribed, conn)
+		clientAcks = clientAcks || conn.ClientAcks
+	}
+
+	if clientAcks {
+		awaitingAck = s.ackService.Track(event)
+	}
+
+	for _, conn := range subscribed {
+		if live, ok := state.replaying[conn.ID]; ok {
+			state.replaying[conn.ID] = append(live, event)
+			sent++
+			continue
+		}
+
+		// connection which cannot be used anymore is closed and removed by its owner
+		err := conn.Send(event)
+		if err != nil {
+			s.logger.Sugar().Errorf("send event: %s: %v", conn.ID, err)
+			continue
+		}
+		sent++
+	}
+
+	return sent, awaitingAck
+}
+
+// Attach adds connection to the pool and delivers events of its topics missed by the client
+func (s *ServiceImpl) Attach(conn *connections_pool.Connection, lastEventID model.EventID) {
+	conn.LastEventID = lastEventID
+
+	s.replay(conn, func() []model.NotificationType {
+		s.connectionsPoolService.AddConnection(conn)
+		return conn.Topics()
+	})
+}
+
+// Subscribe adds topics to the connection, events of the topics the connection has not been subscribed to
+// are delivered the same way as on attach
+func (s *ServiceImpl) Subscribe(conn *connections_pool.Connection, topics ...model.NotificationType) {
+	s.replay(conn, func() []model.NotificationType {
+		added := make([]model.NotificationType, 0, len(topics))
+		for _, topic := range topics {
+			if !conn.Subscribed(topic) {
+				added = append(added, topic)
+			}
+		}
+
+		conn.SubscribeTopics(topics...)
+		return added
+	})
+}
+
+// replay delivers missed events of the topics returned by register, register is called under the user lock.
+// Live events dispatched while missed events are read are sent after them
+func (s *ServiceImpl) replay(conn *connections_pool.Connection, register func() []model.NotificationType) {
+	state := s.acquire(conn.UserID)
+	defer s.release(conn.UserID, state)
+
+	state.mutex.Lock()
+	topics := register()
+	if len(topics) == 0 {
+		state.mutex.Unlock()
+		return
+	}
+	state.replaying[conn.ID] = make([]*model.Event, 0)
+	state.mutex.Unlock()
+
+	missed := s.readMissed(conn, topics)
+
+	state.mutex.Lock()
+	live := state.replaying[conn.ID]
+	delete(state.replaying, conn.ID)
+	sent := s.send(conn, append(missed.events, live...))
+	if conn.ClientAcks {
+		// events of the inbox are kept there until the client acknowledges them
+		for _, event := range missed.stored {
+			if _, ok := sent[event.ID]; ok {
+				s.ackService.Track(event)
+			}
+		}
+	}
+	state.mutex.Unlock()
+
+	if !conn.ClientAcks {
+		s.settleSent(conn, missed, sent)
+	}
+}
+
+// missedEvents are events of the connection topics missed by the client in order they are sent
+type missedEvents struct {
+	events  []*model.Event
+	pending []*model.Event
+	stored  []*model.Event
+}
+
+// readMissed reads user events published after the last event seen by the client,
+// unacknowledged events and events stored in the inbox while the user was offline
+func (s *ServiceImpl) readMissed(conn *connections_pool.Connection, topics []model.NotificationType) *missedEvents {
+	wanted := make(map[model.NotificationType]struct{}, len(topics))
+	for _, topic := range topics {
+		wanted[topic] = struct{}{}
+	}
+	filter := func(events []*model.Event) []*model.Event {
+		res := make([]*model.Event, 0, len(events))
+		for _, event := range events {
+			if _, ok := wanted[event.Type]; ok {
+				res = append(res, event)
+			}
+		}
+		return res
+	}
+
+	missed := new(missedEvents)
+	if conn.LastEventID != "" {
+		events, ok := s.historyService.After(&conn.UserID, conn.LastEventID)
+		if !ok {
+			s.logger.Sugar().Infof("last event %s is not found in history: %s", conn.LastEventID, conn.ID)
+		}
+		missed.events = append(missed.events, filter(events)...)
+	}
+
+	missed.pending = filter(s.ackService.Pending(&conn.UserID))
+	missed.events = append(missed.events, missed.pending...)
+
+	stored, err := s.inboxService.List(&conn.UserID)
+	if err != nil {
+		s.logger.Sugar().Errorf("list inbox: %s: %v", conn.UserID, err)
+	}
+	missed.stored = filter(stored)
+	missed.events = append(missed.events, missed.stored...)
+
+	return missed
+}
+
+// settleSent acknowledges missed events sent to a connection without client acknowledgements and removes them from the inbox
+func (s *ServiceImpl) settleSent(conn *connections_pool.Connection, missed *missedEvents, sent map[model.EventID]struct{}) {
+	acked := make([]model.EventID, 0, len(missed.pending))
+	for _, event := range missed.pending {
+		if _, ok := sent[event.ID]; ok {
+			acked = append(acked, event.ID)
+		}
+	}
+	if len(acked) > 0 {
+		s.ackService.Ack(&conn.UserID, acked...)
+	}
+
+	flushed := make([]model.EventID, 0, len(missed.stored))
+	for _, event := range missed.stored {
+		if _, ok := sent[event.ID]; ok {
+			flushed = append(flushed, event.ID)
+		}
+	}
+	if len(flushed) == 0 {
+		return
+	}
+
+	err := s.inboxService.Delete(&conn.UserID, flushed...)
+	if err != nil {
+		s.logger.Sugar().Errorf("delete flushed inbox events: %s: %v", conn.UserID, err)
+	}
+}
+
+// send sends events to the connection once each and returns sent ones, sending stops at the first failure
+func (s *ServiceImpl) send(conn *connections_pool.Connection, events []*model.Event) map[model.EventID]struct{} {
+	sent := make(map[model.EventID]struct{}, len(events))
+	for _, event := range events {
+		if _, ok := sent[event.ID]; ok {
+			continue
+		}
+
+		err := conn.Send(event)
+		if err != nil {
+			s.logger.Sugar().Errorf("send missed event: %s: %v", conn.ID, err)
+			break
+		}
+		sent[event.ID] = struct{}{}
+	}
+	return sent
+}
+
+// acquire returns state of the user, it is kept until the state is released by everyone who acquired it
+func (s *ServiceImpl) acquire(userID model.UserID) *userState {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	state, ok := s.users[userID]
+	if !ok {
+		state = &userState{
+			mutex:     sync.Mutex{},
+			replaying: make(map[model.ConnectionID][]*model.Event),
+		}
+		s.users[userID] = state
+	}
+	state.refs++
+	return state
+}
+
+func (s *ServiceImpl) release(userID model.UserID, state *userState) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	state.refs--
+	if state.refs == 0 {
+		delete(s.users, userID)
+	}
+}
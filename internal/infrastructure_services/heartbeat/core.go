@@ -0,0 +1,93 @@
+package heartbeat
+
+import (
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/syth0le/realtime-notification-service/internal/infrastructure_services/connections_pool"
+)
+
+type Service interface {
+	Run() error
+	Close() error
+}
+
+type ServiceImpl struct {
+	logger *zap.Logger
+
+	enable       bool
+	pingInterval time.Duration
+	pongTimeout  time.Duration
+
+	done chan struct{}
+
+	connectionsPoolService connections_pool.Service
+}
+
+func NewServiceImpl(
+	logger *zap.Logger,
+	enable bool,
+	pingInterval time.Duration,
+	pongTimeout time.Duration,
+	connectionsPoolService connections_pool.Service,
+) *ServiceImpl {
+	return &ServiceImpl{
+		logger:                 logger,
+		enable:                 enable,
+		pingInterval:           pingInterval,
+		pongTimeout:            pongTimeout,
+		done:                   make(chan struct{}),
+		connectionsPoolService: connectionsPoolService,
+	}
+}
+
+// Run pings every pooled connection each ping interval and reaps connections
+// which have not answered within ping interval and pong timeout
+func (s *ServiceImpl) Run() error {
+	if !s.enable {
+		return nil
+	}
+
+	ticker := time.NewTicker(s.pingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return nil
+		case <-ticker.C:
+			s.beat()
+		}
+	}
+}
+
+func (s *ServiceImpl) Close() error {
+	close(s.done)
+	return nil
+}
+
+func (s *ServiceImpl) beat() {
+	deadline := time.Now().Add(-(s.pingInterval + s.pongTimeout))
+	for _, conn := range s.connectionsPoolService.ListConnections() {
+		if conn.LastSeen().Before(deadline) {
+			s.logger.Sugar().Infof("missed heartbeat: %s: %s", conn.UserID, conn.ID)
+			s.reap(conn)
+			continue
+		}
+
+		err := conn.Ping()
+		if err != nil {
+			s.logger.Sugar().Infof("write ping: %s: %v", conn.ID, err)
+			s.reap(conn)
+		}
+	}
+}
+
+// reap closes connection, its owner removes it from the pool and releases the subscription
+func (s *ServiceImpl) reap(conn *connections_pool.Connection) {
+	err := conn.Close()
+	if err != nil {
+		s.logger.Sugar().Warnf("close connection: %s: %v", conn.ID, err)
+	}
+}
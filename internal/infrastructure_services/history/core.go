@@ -0,0 +1,141 @@
+package history
+
+import (
+	"sync"
+	"time"
+
+	"github.com/syth0le/realtime-notification-service/internal/model"
+)
+
+// Service keeps recent events of every user to replay them to reconnected clients,
+// history of the user no event is added to for ttl is evicted
+type Service interface {
+	Add(event *model.Event)
+	// After returns user events published after the given one, ok is false if the event is not known anymore
+	After(userID *model.UserID, eventID model.EventID) (events []*model.Event, ok bool)
+	// Run evicts idle histories every purge interval
+	Run() error
+	Close() error
+}
+
+// ring is a fixed size buffer of the most recent user events
+type ring struct {
+	events  []*model.Event
+	start   int
+	count   int
+	touched time.Time // time the last event is added
+}
+
+func (r *ring) push(event *model.Event, now time.Time) {
+	r.touched = now
+
+	if r.count < len(r.events) {
+		r.events[(r.start+r.count)%len(r.events)] = event
+		r.count++
+		return
+	}
+
+	r.events[r.start] = event
+	r.start = (r.start + 1) % len(r.events)
+}
+
+func (r *ring) at(i int) *model.Event {
+	return r.events[(r.start+i)%len(r.events)]
+}
+
+type ServiceImpl struct {
+	size          int
+	ttl           time.Duration
+	purgeInterval time.Duration
+
+	rings map[model.UserID]*ring
+
+	mutex sync.Mutex
+
+	done chan struct{}
+	once sync.Once
+}
+
+func NewServiceImpl(size int, ttl time.Duration, purgeInterval time.Duration) *ServiceImpl {
+	return &ServiceImpl{
+		size:          size,
+		ttl:           ttl,
+		purgeInterval: purgeInterval,
+		rings:         make(map[model.UserID]*ring),
+		mutex:         sync.Mutex{},
+		done:          make(chan struct{}),
+	}
+}
+
+func (s *ServiceImpl) Add(event *model.Event) {
+	if s.size <= 0 {
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	r, ok := s.rings[event.UserID]
+	if !ok {
+		r = &ring{events: make([]*model.Event, s.size)}
+		s.rings[event.UserID] = r
+	}
+	r.push(event, time.Now())
+}
+
+func (s *ServiceImpl) After(userID *model.UserID, eventID model.EventID) ([]*model.Event, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	r, ok := s.rings[*userID]
+	if !ok {
+		return nil, false
+	}
+
+	for i := r.count - 1; i >= 0; i-- {
+		if r.at(i).ID != eventID {
+			continue
+		}
+
+		res := make([]*model.Event, 0, r.count-i-1)
+		for j := i + 1; j < r.count; j++ {
+			res = append(res, r.at(j))
+		}
+		return res, true
+	}
+
+	return nil, false
+}
+
+func (s *ServiceImpl) Run() error {
+	ticker := time.NewTicker(s.purgeInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return nil
+		case <-ticker.C:
+			s.purge(time.Now())
+		}
+	}
+}
+
+// purge evicts rings of users no event is added to for ttl
+func (s *ServiceImpl) purge(now time.Time) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for userID, r := range s.rings {
+		if now.Sub(r.touched) >= s.ttl {
+			delete(s.rings, userID)
+		}
+	}
+}
+
+func (s *ServiceImpl) Close() error {
+	s.once.Do(func() {
+		close(s.done)
+	})
+	return nil
+}
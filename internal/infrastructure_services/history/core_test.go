@@ -0,0 +1,133 @@
+package history
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/syth0le/realtime-notification-service/internal/model"
+)
+
+const testUser model.UserID = "alice"
+
+func newEvent(t *testing.T, userID model.UserID, id string, createdAt time.Time) *model.Event {
+	t.Helper()
+
+	event, err := model.NewEvent(&model.Notification{
+		ID:        model.EventID(id),
+		Type:      model.FeedPostedType,
+		Recipient: userID,
+		CreatedAt: createdAt,
+		Payload:   []byte(`{}`),
+	})
+	if err != nil {
+		t.Fatalf("new event: %v", err)
+	}
+	return event
+}
+
+func addEvents(t *testing.T, service Service, userID model.UserID, count int) {
+	t.Helper()
+
+	for i := 1; i <= count; i++ {
+		service.Add(newEvent(t, userID, fmt.Sprintf("e%d", i), time.Now()))
+	}
+}
+
+func assertAfter(t *testing.T, service Service, userID model.UserID, eventID model.EventID, expected ...string) {
+	t.Helper()
+
+	events, ok := service.After(&userID, eventID)
+	if !ok {
+		t.Fatalf("event %s is not found", eventID)
+	}
+	if len(events) != len(expected) {
+		t.Fatalf("unexpected %d events after %s, expected %v", len(events), eventID, expected)
+	}
+	for i, event := range events {
+		if string(event.ID) != expected[i] {
+			t.Fatalf("unexpected event %s at %d, expected %s", event.ID, i, expected[i])
+		}
+	}
+}
+
+func assertEvicted(t *testing.T, service Service, userID model.UserID, eventID model.EventID) {
+	t.Helper()
+
+	events, ok := service.After(&userID, eventID)
+	if ok || len(events) != 0 {
+		t.Fatalf("event %s is not evicted, got %d events after it", eventID, len(events))
+	}
+}
+
+func newDiskService(t *testing.T, size int, ttl time.Duration) *DiskServiceImpl {
+	t.Helper()
+
+	service, err := NewDiskServiceImpl(zap.NewNop(), size, ttl, time.Minute, filepath.Join(t.TempDir(), "history.db"))
+	if err != nil {
+		t.Fatalf("new disk history: %v", err)
+	}
+	t.Cleanup(func() { service.Close() })
+	return service
+}
+
+func TestRingWrapsAround(t *testing.T) {
+	service := NewServiceImpl(3, time.Hour, time.Minute)
+	addEvents(t, service, testUser, 5)
+
+	// e1 and e2 are overwritten, the ring keeps e3, e4 and e5 in order they are added
+	assertAfter(t, service, testUser, "e3", "e4", "e5")
+	assertAfter(t, service, testUser, "e5")
+	assertEvicted(t, service, testUser, "e1")
+	assertEvicted(t, service, testUser, "e2")
+}
+
+func TestDiskHistoryWrapsAround(t *testing.T) {
+	service := newDiskService(t, 3, time.Hour)
+	addEvents(t, service, testUser, 5)
+
+	assertAfter(t, service, testUser, "e3", "e4", "e5")
+	assertEvicted(t, service, testUser, "e2")
+}
+
+func TestIdleRingIsPurged(t *testing.T) {
+	service := NewServiceImpl(3, time.Hour, time.Minute)
+	addEvents(t, service, testUser, 2)
+	addEvents(t, service, "bob", 2)
+
+	now := time.Now()
+	service.purge(now.Add(30 * time.Minute))
+	assertAfter(t, service, testUser, "e1", "e2")
+
+	// ring of bob is touched by the new event, so only the ring of alice is idle for ttl
+	service.Add(newEvent(t, "bob", "e3", now.Add(time.Hour)))
+	service.rings["bob"].touched = now.Add(time.Hour)
+
+	service.purge(now.Add(90 * time.Minute))
+	assertEvicted(t, service, testUser, "e1")
+	assertAfter(t, service, "bob", "e1", "e2", "e3")
+	if _, ok := service.rings[testUser]; ok {
+		t.Fatalf("idle ring of %s is kept", testUser)
+	}
+}
+
+func TestIdleDiskHistoryIsPurged(t *testing.T) {
+	service := newDiskService(t, 3, time.Hour)
+	now := time.Now()
+	service.Add(newEvent(t, testUser, "e1", now.Add(-2*time.Hour)))
+	service.Add(newEvent(t, testUser, "e2", now.Add(-90*time.Minute)))
+	service.Add(newEvent(t, "bob", "e1", now.Add(-2*time.Hour)))
+	service.Add(newEvent(t, "bob", "e2", now))
+
+	err := service.purge(now)
+	if err != nil {
+		t.Fatalf("purge: %v", err)
+	}
+
+	// history is evicted by its newest event
+	assertEvicted(t, service, testUser, "e1")
+	assertAfter(t, service, "bob", "e1", "e2")
+}
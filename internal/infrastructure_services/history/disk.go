@@ -0,0 +1,206 @@
+package history
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+	"go.uber.org/zap"
+
+	"github.com/syth0le/realtime-notification-service/internal/model"
+)
+
+const defaultOpenTimeout = 5 * time.Second
+
+// DiskServiceImpl keeps recent user events in a bolt database, so they survive restart of the node.
+// Every user has own bucket of events keyed by bucket sequence, bucket is evicted when its newest event
+// is created more than ttl ago
+type DiskServiceImpl struct {
+	logger *zap.Logger
+
+	size          int
+	ttl           time.Duration
+	purgeInterval time.Duration
+
+	db *bolt.DB
+
+	done chan struct{}
+	once sync.Once
+}
+
+func NewDiskServiceImpl(
+	logger *zap.Logger,
+	size int,
+	ttl time.Duration,
+	purgeInterval time.Duration,
+	path string,
+) (*DiskServiceImpl, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: defaultOpenTimeout})
+	if err != nil {
+		return nil, fmt.Errorf("open bolt db %s: %w", path, err)
+	}
+
+	return &DiskServiceImpl{
+		logger:        logger,
+		size:          size,
+		ttl:           ttl,
+		purgeInterval: purgeInterval,
+		db:            db,
+		done:          make(chan struct{}),
+	}, nil
+}
+
+func (s *DiskServiceImpl) Add(event *model.Event) {
+	if s.size <= 0 {
+		return
+	}
+
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists([]byte(event.UserID))
+		if err != nil {
+			return fmt.Errorf("create bucket: %w", err)
+		}
+
+		seq, err := bucket.NextSequence()
+		if err != nil {
+			return fmt.Errorf("next sequence: %w", err)
+		}
+
+		data, err := event.MarshalBinary()
+		if err != nil {
+			return fmt.Errorf("marshal event: %w", err)
+		}
+
+		err = bucket.Put(sequenceKey(seq), data)
+		if err != nil {
+			return fmt.Errorf("put event: %w", err)
+		}
+
+		// events are keyed by sequence, so everything before the last size keys is evicted,
+		// cursor is moved to the first key after every delete
+		cursor := bucket.Cursor()
+		for key, _ := cursor.First(); key != nil && binary.BigEndian.Uint64(key)+uint64(s.size) <= seq; key, _ = cursor.First() {
+			err = cursor.Delete()
+			if err != nil {
+				return fmt.Errorf("evict event: %w", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		s.logger.Sugar().Errorf("add event %s to history: %v", event.ID, err)
+	}
+}
+
+func (s *DiskServiceImpl) After(userID *model.UserID, eventID model.EventID) ([]*model.Event, bool) {
+	var (
+		res   []*model.Event
+		found bool
+	)
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(*userID))
+		if bucket == nil {
+			return nil
+		}
+
+		cursor := bucket.Cursor()
+		for key, value := cursor.Last(); key != nil; key, value = cursor.Prev() {
+			event := new(model.Event)
+			err := event.UnmarshalBinary(value)
+			if err != nil {
+				return fmt.Errorf("unmarshal event: %w", err)
+			}
+
+			if event.ID == eventID {
+				found = true
+				break
+			}
+			res = append(res, event)
+		}
+		return nil
+	})
+	if err != nil {
+		s.logger.Sugar().Errorf("read history: %s: %v", *userID, err)
+		return nil, false
+	}
+
+	if !found {
+		return nil, false
+	}
+
+	// events are collected from the newest one
+	for i, j := 0, len(res)-1; i < j; i, j = i+1, j-1 {
+		res[i], res[j] = res[j], res[i]
+	}
+	return res, true
+}
+
+func (s *DiskServiceImpl) Run() error {
+	ticker := time.NewTicker(s.purgeInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return nil
+		case <-ticker.C:
+			err := s.purge(time.Now())
+			if err != nil {
+				s.logger.Sugar().Errorf("purge history: %v", err)
+			}
+		}
+	}
+}
+
+// purge deletes buckets of users whose newest event is created more than ttl ago
+func (s *DiskServiceImpl) purge(now time.Time) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		idle := make([][]byte, 0)
+		err := tx.ForEach(func(name []byte, bucket *bolt.Bucket) error {
+			_, value := bucket.Cursor().Last()
+			if value == nil {
+				idle = append(idle, name)
+				return nil
+			}
+
+			event := new(model.Event)
+			err := event.UnmarshalBinary(value)
+			if err != nil {
+				return fmt.Errorf("unmarshal event: %w", err)
+			}
+
+			if now.Sub(event.CreatedAt) >= s.ttl {
+				idle = append(idle, name)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		// buckets cannot be deleted while they are iterated
+		for _, name := range idle {
+			err = tx.DeleteBucket(name)
+			if err != nil {
+				return fmt.Errorf("delete bucket %s: %w", name, err)
+			}
+		}
+		return nil
+	})
+}
+
+func (s *DiskServiceImpl) Close() error {
+	s.once.Do(func() {
+		close(s.done)
+	})
+	return s.db.Close()
+}
+
+func sequenceKey(seq uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, seq)
+	return key
+}
@@ -0,0 +1,199 @@
+package inbox
+
+import (
+	"encoding/binary"
+	"fmt"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/syth0le/realtime-notification-service/internal/model"
+)
+
+const (
+	defaultOpenTimeout = 5 * time.Second
+	expiresAtSize      = 8
+)
+
+// BoltStore keeps inbox in embedded bolt database, every user has own bucket of records keyed by sequence.
+// Record is expiration unix nano timestamp followed by the event
+type BoltStore struct {
+	db *bolt.DB
+}
+
+func NewBoltStore(path string) (*BoltStore, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: defaultOpenTimeout})
+	if err != nil {
+		return nil, fmt.Errorf("open bolt db %s: %w", path, err)
+	}
+
+	return &BoltStore{db: db}, nil
+}
+
+func (s *BoltStore) Put(event *model.Event, expiresAt time.Time) error {
+	data, err := event.MarshalBinary()
+	if err != nil {
+		return fmt.Errorf("marshal event: %w", err)
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists([]byte(event.UserID))
+		if err != nil {
+			return fmt.Errorf("create bucket: %w", err)
+		}
+
+		// event dispatched again after broker redelivery is stored once, as by other stores
+		stored, err := containsEvent(bucket, event.ID)
+		if err != nil {
+			return err
+		}
+		if stored {
+			return nil
+		}
+
+		seq, err := bucket.NextSequence()
+		if err != nil {
+			return fmt.Errorf("next sequence: %w", err)
+		}
+
+		record := make([]byte, expiresAtSize+len(data))
+		binary.BigEndian.PutUint64(record, uint64(expiresAt.UnixNano()))
+		copy(record[expiresAtSize:], data)
+
+		key := make([]byte, 8)
+		binary.BigEndian.PutUint64(key, seq)
+		return bucket.Put(key, record)
+	})
+}
+
+func (s *BoltStore) List(userID *model.UserID, now time.Time) ([]*model.Event, error) {
+	var res []*model.Event
+	err := s.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(*userID))
+		if bucket == nil {
+			return nil
+		}
+
+		return bucket.ForEach(func(key, record []byte) error {
+			if !now.Before(recordExpiresAt(record)) {
+				return nil
+			}
+
+			event := new(model.Event)
+			err := event.UnmarshalBinary(record[expiresAtSize:])
+			if err != nil {
+				return fmt.Errorf("unmarshal event: %w", err)
+			}
+
+			res = append(res, event)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func (s *BoltStore) Delete(userID *model.UserID, eventIDs ...model.EventID) error {
+	deleted := make(map[model.EventID]struct{}, len(eventIDs))
+	for _, id := range eventIDs {
+		deleted[id] = struct{}{}
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return deleteRecords(tx, []byte(*userID), func(record []byte) (bool, error) {
+			event := new(model.Event)
+			err := event.UnmarshalBinary(record[expiresAtSize:])
+			if err != nil {
+				return false, fmt.Errorf("unmarshal event: %w", err)
+			}
+
+			_, ok := deleted[event.ID]
+			return ok, nil
+		})
+	})
+}
+
+func (s *BoltStore) Purge(now time.Time) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		var names [][]byte
+		err := tx.ForEach(func(name []byte, _ *bolt.Bucket) error {
+			names = append(names, append([]byte(nil), name...))
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, name := range names {
+			err = deleteRecords(tx, name, func(record []byte) (bool, error) {
+				return !now.Before(recordExpiresAt(record)), nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *BoltStore) Close() error {
+	return s.db.Close()
+}
+
+// deleteRecords deletes matching records of the bucket, empty bucket is deleted
+func deleteRecords(tx *bolt.Tx, name []byte, match func(record []byte) (bool, error)) error {
+	bucket := tx.Bucket(name)
+	if bucket == nil {
+		return nil
+	}
+
+	var keys [][]byte
+	err := bucket.ForEach(func(key, record []byte) error {
+		ok, err := match(record)
+		if err != nil {
+			return err
+		}
+
+		if ok {
+			keys = append(keys, append([]byte(nil), key...))
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		err = bucket.Delete(key)
+		if err != nil {
+			return fmt.Errorf("delete record: %w", err)
+		}
+	}
+
+	if key, _ := bucket.Cursor().First(); key == nil {
+		return tx.DeleteBucket(name)
+	}
+	return nil
+}
+
+func containsEvent(bucket *bolt.Bucket, eventID model.EventID) (bool, error) {
+	found := false
+	err := bucket.ForEach(func(key, record []byte) error {
+		event := new(model.Event)
+		err := event.UnmarshalBinary(record[expiresAtSize:])
+		if err != nil {
+			return fmt.Errorf("unmarshal event: %w", err)
+		}
+
+		found = found || event.ID == eventID
+		return nil
+	})
+	return found, err
+}
+
+func recordExpiresAt(record []byte) time.Time {
+	return time.Unix(0, int64(binary.BigEndian.Uint64(record[:expiresAtSize])))
+}
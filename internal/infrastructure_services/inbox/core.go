@@ -0,0 +1,114 @@
+package inbox
+
+import (
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/syth0le/realtime-notification-service/internal/model"
+)
+
+type Backend string
+
+const (
+	MemoryBackend   Backend = "memory"
+	BoltBackend     Backend = "bolt"
+	PostgresBackend Backend = "postgres"
+)
+
+func (b Backend) Validate() error {
+	switch b {
+	case MemoryBackend, BoltBackend, PostgresBackend:
+		return nil
+	default:
+		return fmt.Errorf("unexpected inbox backend: %s", b)
+	}
+}
+
+// Service keeps notifications which could not be delivered to the user until they are fetched or expire
+type Service interface {
+	Run() error
+	Close() error
+	Put(event *model.Event) error
+	List(userID *model.UserID) ([]*model.Event, error)
+	Delete(userID *model.UserID, eventIDs ...model.EventID) error
+}
+
+// Store is a backend of the inbox, expired events must not be returned by the store
+type Store interface {
+	Put(event *model.Event, expiresAt time.Time) error
+	List(userID *model.UserID, now time.Time) ([]*model.Event, error)
+	Delete(userID *model.UserID, eventIDs ...model.EventID) error
+	Purge(now time.Time) error
+	Close() error
+}
+
+type ServiceImpl struct {
+	logger *zap.Logger
+
+	ttl           time.Duration
+	purgeInterval time.Duration
+
+	store Store
+
+	done chan struct{}
+}
+
+func NewServiceImpl(logger *zap.Logger, ttl time.Duration, purgeInterval time.Duration, store Store) *ServiceImpl {
+	return &ServiceImpl{
+		logger:        logger,
+		ttl:           ttl,
+		purgeInterval: purgeInterval,
+		store:         store,
+		done:          make(chan struct{}),
+	}
+}
+
+// Run purges expired events every purge interval
+func (s *ServiceImpl) Run() error {
+	ticker := time.NewTicker(s.purgeInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return nil
+		case <-ticker.C:
+			err := s.store.Purge(time.Now())
+			if err != nil {
+				s.logger.Sugar().Errorf("purge inbox: %v", err)
+			}
+		}
+	}
+}
+
+func (s *ServiceImpl) Close() error {
+	close(s.done)
+	return s.store.Close()
+}
+
+func (s *ServiceImpl) Put(event *model.Event) error {
+	err := s.store.Put(event, time.Now().Add(s.ttl))
+	if err != nil {
+		return fmt.Errorf("store put: %w", err)
+	}
+	return nil
+}
+
+// List returns user events in order they were put
+func (s *ServiceImpl) List(userID *model.UserID) ([]*model.Event, error) {
+	events, err := s.store.List(userID, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("store list: %w", err)
+	}
+	return events, nil
+}
+
+func (s *ServiceImpl) Delete(userID *model.UserID, eventIDs ...model.EventID) error {
+	err := s.store.Delete(userID, eventIDs...)
+	if err != nil {
+		return fmt.Errorf("store delete: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package inbox
+
+import (
+	"sync"
+	"time"
+
+	"github.com/syth0le/realtime-notification-service/internal/model"
+)
+
+type memoryRecord struct {
+	event     *model.Event
+	expiresAt time.Time
+}
+
+// MemoryStore keeps inbox in memory of the node, it is lost on restart
+type MemoryStore struct {
+	records map[model.UserID][]*memoryRecord
+	mutex   sync.Mutex
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		records: make(map[model.UserID][]*memoryRecord),
+		mutex:   sync.Mutex{},
+	}
+}
+
+func (s *MemoryStore) Put(event *model.Event, expiresAt time.Time) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, record := range s.records[event.UserID] {
+		if record.event.ID == event.ID {
+			return nil
+		}
+	}
+
+	s.records[event.UserID] = append(s.records[event.UserID], &memoryRecord{event: event, expiresAt: expiresAt})
+	return nil
+}
+
+func (s *MemoryStore) List(userID *model.UserID, now time.Time) ([]*model.Event, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	res := make([]*model.Event, 0, len(s.records[*userID]))
+	for _, record := range s.records[*userID] {
+		if now.Before(record.expiresAt) {
+			res = append(res, record.event)
+		}
+	}
+	return res, nil
+}
+
+func (s *MemoryStore) Delete(userID *model.UserID, eventIDs ...model.EventID) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	deleted := make(map[model.EventID]struct{}, len(eventIDs))
+	for _, id := range eventIDs {
+		deleted[id] = struct{}{}
+	}
+
+	s.filter(*userID, func(record *memoryRecord) bool {
+		_, ok := deleted[record.event.ID]
+		return !ok
+	})
+	return nil
+}
+
+func (s *MemoryStore) Purge(now time.Time) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for userID := range s.records {
+		s.filter(userID, func(record *memoryRecord) bool {
+			return now.Before(record.expiresAt)
+		})
+	}
+	return nil
+}
+
+func (s *MemoryStore) Close() error {
+	return nil
+}
+
+// filter keeps user records matching keep, user without records is removed
+func (s *MemoryStore) filter(userID model.UserID, keep func(record *memoryRecord) bool) {
+	kept := s.records[userID][:0]
+	for _, record := range s.records[userID] {
+		if keep(record) {
+			kept = append(kept, record)
+		}
+	}
+
+	if len(kept) == 0 {
+		delete(s.records, userID)
+		return
+	}
+	s.records[userID] = kept
+}
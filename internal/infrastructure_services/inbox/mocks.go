@@ -0,0 +1,36 @@
+package inbox
+
+import (
+	"errors"
+
+	"github.com/syth0le/realtime-notification-service/internal/model"
+)
+
+var ErrDisabled = errors.New("inbox is disabled")
+
+// ServiceMock is used when inbox is disabled, undeliverable events are rejected
+type ServiceMock struct{}
+
+func NewServiceMock() *ServiceMock {
+	return &ServiceMock{}
+}
+
+func (s *ServiceMock) Run() error {
+	return nil
+}
+
+func (s *ServiceMock) Close() error {
+	return nil
+}
+
+func (s *ServiceMock) Put(event *model.Event) error {
+	return ErrDisabled
+}
+
+func (s *ServiceMock) List(userID *model.UserID) ([]*model.Event, error) {
+	return nil, nil
+}
+
+func (s *ServiceMock) Delete(userID *model.UserID, eventIDs ...model.EventID) error {
+	return nil
+}
@@ -0,0 +1,128 @@
+package inbox
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/stdlib"
+	"github.com/jmoiron/sqlx"
+
+	"github.com/syth0le/realtime-notification-service/internal/model"
+)
+
+const (
+	driverName          = "pgx"
+	defaultQueryTimeout = 5 * time.Second
+
+	createInboxTableQuery = `CREATE TABLE IF NOT EXISTS notification_inbox (
+		seq        BIGSERIAL,
+		user_id    TEXT        NOT NULL,
+		event_id   TEXT        NOT NULL,
+		data       BYTEA       NOT NULL,
+		expires_at TIMESTAMPTZ NOT NULL,
+		PRIMARY KEY (user_id, event_id)
+	)`
+	putInboxQuery = `INSERT INTO notification_inbox (user_id, event_id, data, expires_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (user_id, event_id) DO NOTHING`
+	listInboxQuery = `SELECT data FROM notification_inbox
+		WHERE user_id = $1 AND expires_at > $2
+		ORDER BY seq`
+	deleteInboxQuery = `DELETE FROM notification_inbox WHERE user_id = $1 AND event_id = ANY($2)`
+	purgeInboxQuery  = `DELETE FROM notification_inbox WHERE expires_at <= $1`
+)
+
+// PostgresStore keeps inbox in notification_inbox table, the table is created if it does not exist
+type PostgresStore struct {
+	db *sqlx.DB
+}
+
+func NewPostgresStore(dsn string) (*PostgresStore, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultQueryTimeout)
+	defer cancel()
+
+	connConfig, err := pgx.ParseConfig(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("parse dsn: %w", err)
+	}
+	db := sqlx.NewDb(stdlib.OpenDB(*connConfig), driverName)
+
+	_, err = db.ExecContext(ctx, createInboxTableQuery)
+	if err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("create inbox table: %w", err)
+	}
+
+	return &PostgresStore{db: db}, nil
+}
+
+func (s *PostgresStore) Put(event *model.Event, expiresAt time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultQueryTimeout)
+	defer cancel()
+
+	data, err := event.MarshalBinary()
+	if err != nil {
+		return fmt.Errorf("marshal event: %w", err)
+	}
+
+	_, err = s.db.ExecContext(ctx, putInboxQuery, event.UserID.String(), event.ID.String(), data, expiresAt)
+	if err != nil {
+		return fmt.Errorf("exec put: %w", err)
+	}
+	return nil
+}
+
+func (s *PostgresStore) List(userID *model.UserID, now time.Time) ([]*model.Event, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultQueryTimeout)
+	defer cancel()
+
+	var records [][]byte
+	err := s.db.SelectContext(ctx, &records, listInboxQuery, userID.String(), now)
+	if err != nil {
+		return nil, fmt.Errorf("select list: %w", err)
+	}
+
+	res := make([]*model.Event, 0, len(records))
+	for _, record := range records {
+		event := new(model.Event)
+		err = event.UnmarshalBinary(record)
+		if err != nil {
+			return nil, fmt.Errorf("unmarshal event: %w", err)
+		}
+		res = append(res, event)
+	}
+	return res, nil
+}
+
+func (s *PostgresStore) Delete(userID *model.UserID, eventIDs ...model.EventID) error {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultQueryTimeout)
+	defer cancel()
+
+	ids := make([]string, 0, len(eventIDs))
+	for _, id := range eventIDs {
+		ids = append(ids, id.String())
+	}
+
+	_, err := s.db.ExecContext(ctx, deleteInboxQuery, userID.String(), ids)
+	if err != nil {
+		return fmt.Errorf("exec delete: %w", err)
+	}
+	return nil
+}
+
+func (s *PostgresStore) Purge(now time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultQueryTimeout)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, purgeInboxQuery, now)
+	if err != nil {
+		return fmt.Errorf("exec purge: %w", err)
+	}
+	return nil
+}
+
+func (s *PostgresStore) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,135 @@
+package inbox
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/syth0le/realtime-notification-service/internal/model"
+)
+
+const testUser model.UserID = "alice"
+
+// stores returns every store which runs without external services, postgres store is not covered
+func stores(t *testing.T) map[Backend]Store {
+	t.Helper()
+
+	bolt, err := NewBoltStore(filepath.Join(t.TempDir(), "inbox.db"))
+	if err != nil {
+		t.Fatalf("new bolt store: %v", err)
+	}
+
+	res := map[Backend]Store{
+		MemoryBackend: NewMemoryStore(),
+		BoltBackend:   bolt,
+	}
+	for _, store := range res {
+		store := store
+		t.Cleanup(func() { store.Close() })
+	}
+	return res
+}
+
+func newEvent(t *testing.T, userID model.UserID, id model.EventID) *model.Event {
+	t.Helper()
+
+	event, err := model.NewEvent(&model.Notification{
+		ID:        id,
+		Type:      model.FeedPostedType,
+		Recipient: userID,
+		CreatedAt: time.Now(),
+		Payload:   []byte(`{}`),
+	})
+	if err != nil {
+		t.Fatalf("new event: %v", err)
+	}
+	return event
+}
+
+func put(t *testing.T, store Store, userID model.UserID, id model.EventID, expiresAt time.Time) {
+	t.Helper()
+
+	err := store.Put(newEvent(t, userID, id), expiresAt)
+	if err != nil {
+		t.Fatalf("put %s: %v", id, err)
+	}
+}
+
+func assertList(t *testing.T, store Store, userID model.UserID, now time.Time, expected ...model.EventID) {
+	t.Helper()
+
+	events, err := store.List(&userID, now)
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if len(events) != len(expected) {
+		t.Fatalf("unexpected %d events of %s, expected %v", len(events), userID, expected)
+	}
+	for i, event := range events {
+		if event.ID != expected[i] || event.UserID != userID {
+			t.Fatalf("unexpected event %s of %s at %d, expected %s", event.ID, event.UserID, i, expected[i])
+		}
+	}
+}
+
+func TestStoreKeepsEventsInOrder(t *testing.T) {
+	for backend, store := range stores(t) {
+		t.Run(string(backend), func(t *testing.T) {
+			now := time.Now()
+			put(t, store, testUser, "e1", now.Add(time.Hour))
+			put(t, store, testUser, "e2", now.Add(time.Hour))
+			put(t, store, "bob", "e3", now.Add(time.Hour))
+
+			// event put again after redelivery is stored once
+			put(t, store, testUser, "e1", now.Add(time.Hour))
+
+			assertList(t, store, testUser, now, "e1", "e2")
+			assertList(t, store, "bob", now, "e3")
+			assertList(t, store, "carol", now)
+		})
+	}
+}
+
+func TestStoreDeletesEvents(t *testing.T) {
+	for backend, store := range stores(t) {
+		t.Run(string(backend), func(t *testing.T) {
+			now := time.Now()
+			put(t, store, testUser, "e1", now.Add(time.Hour))
+			put(t, store, testUser, "e2", now.Add(time.Hour))
+			put(t, store, testUser, "e3", now.Add(time.Hour))
+
+			userID := testUser
+			err := store.Delete(&userID, "e1", "e3", "unknown")
+			if err != nil {
+				t.Fatalf("delete: %v", err)
+			}
+			assertList(t, store, testUser, now, "e2")
+
+			err = store.Delete(&userID, "e2")
+			if err != nil {
+				t.Fatalf("delete: %v", err)
+			}
+			assertList(t, store, testUser, now)
+		})
+	}
+}
+
+func TestStoreExpiresEvents(t *testing.T) {
+	for backend, store := range stores(t) {
+		t.Run(string(backend), func(t *testing.T) {
+			now := time.Now()
+			put(t, store, testUser, "e1", now.Add(time.Minute))
+			put(t, store, testUser, "e2", now.Add(time.Hour))
+
+			// expired event is not listed even before it is purged
+			later := now.Add(30 * time.Minute)
+			assertList(t, store, testUser, later, "e2")
+
+			err := store.Purge(later)
+			if err != nil {
+				t.Fatalf("purge: %v", err)
+			}
+			assertList(t, store, testUser, now, "e2")
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package presence_events
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/syth0le/realtime-notification-service/internal/clients/broker"
+	"github.com/syth0le/realtime-notification-service/internal/model"
+	"github.com/syth0le/realtime-notification-service/internal/utils"
+)
+
+const (
+	contentTypeJSON       = "application/json"
+	defaultPublishTimeout = 5 * time.Second
+)
+
+// Service publishes online and offline events of users of the node to the broker,
+// events are per node, so the user connected to several nodes is online until the last node publishes offline
+type Service interface {
+	Run() error
+	Close() error
+	// Notify enqueues event without blocking, event is dropped if the queue is full
+	Notify(event *model.PresenceEvent)
+}
+
+type ServiceImpl struct {
+	logger    *zap.Logger
+	publisher broker.Publisher
+
+	nodeID string
+	topic  string
+
+	queue chan *model.PresenceEvent
+
+	done chan struct{}
+}
+
+func NewServiceImpl(
+	logger *zap.Logger,
+	publisher broker.Publisher,
+	nodeID string,
+	topic string,
+	bufferSize int,
+) *ServiceImpl {
+	return &ServiceImpl{
+		logger:    logger,
+		publisher: publisher,
+		nodeID:    nodeID,
+		topic:     topic,
+		queue:     make(chan *model.PresenceEvent, bufferSize),
+		done:      make(chan struct{}),
+	}
+}
+
+// Run publishes queued events in order they happened, events queued when the node is stopped are lost
+func (s *ServiceImpl) Run() error {
+	for {
+		select {
+		case <-s.done:
+			return nil
+		case event := <-s.queue:
+			err := s.publish(event)
+			if err != nil {
+				s.logger.Sugar().Errorf("publish %s of %s: %v", event.Type, event.UserID, err)
+			}
+		}
+	}
+}
+
+func (s *ServiceImpl) Close() error {
+	close(s.done)
+	return nil
+}
+
+func (s *ServiceImpl) Notify(event *model.PresenceEvent) {
+	event.NodeID = s.nodeID
+
+	select {
+	case s.queue <- event:
+	default:
+		s.logger.Sugar().Warnf("presence events queue is full, drop %s of %s", event.Type, event.UserID)
+	}
+}
+
+// publish publishes event with user id as key, so events of the user are routed and ordered together
+func (s *ServiceImpl) publish(event *model.PresenceEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	msg := broker.NewMessage(nil)
+	msg.ID = utils.GenerateEUID()
+	msg.Topic = s.topic
+	msg.Key = event.UserID.String()
+	msg.ContentType = contentTypeJSON
+	msg.Timestamp = event.At
+	msg.Body = body
+
+	ctx, cancel := context.WithTimeout(context.Background(), defaultPublishTimeout)
+	defer cancel()
+
+	return s.publisher.Publish(ctx, msg)
+}
@@ -0,0 +1,22 @@
+package presence_events
+
+import (
+	"github.com/syth0le/realtime-notification-service/internal/model"
+)
+
+// ServiceMock is used when presence events are disabled, events are discarded
+type ServiceMock struct{}
+
+func NewServiceMock() *ServiceMock {
+	return &ServiceMock{}
+}
+
+func (s *ServiceMock) Run() error {
+	return nil
+}
+
+func (s *ServiceMock) Close() error {
+	return nil
+}
+
+func (s *ServiceMock) Notify(event *model.PresenceEvent) {}
@@ -0,0 +1,173 @@
+package registry
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/syth0le/realtime-notification-service/internal/infrastructure_services/connections_pool"
+	"github.com/syth0le/realtime-notification-service/internal/model"
+)
+
+type Backend string
+
+const (
+	MemoryBackend Backend = "memory"
+	RedisBackend  Backend = "redis"
+)
+
+func (b Backend) Validate() error {
+	switch b {
+	case MemoryBackend, RedisBackend:
+		return nil
+	default:
+		return fmt.Errorf("unexpected registry backend: %s", b)
+	}
+}
+
+// Service keeps cluster-wide map of users to nodes holding their connections.
+// Node registers its users on presence changes and refreshes them every heartbeat,
+// entries of a stopped node or missed changes expire after ttl
+type Service interface {
+	Run() error
+	Close() error
+	// Notify enqueues presence change of the node without blocking, change dropped on full queue is fixed by heartbeat
+	Notify(event *model.PresenceEvent)
+	// Nodes returns nodes holding connections of every user, users without connections are absent
+	Nodes(userIDs ...model.UserID) (map[model.UserID][]string, error)
+}
+
+// Store is a backend of the registry shared by all nodes, expired entries must not be returned by the store
+type Store interface {
+	Register(nodeID string, userIDs []model.UserID, expiresAt time.Time) error
+	Unregister(nodeID string, userID model.UserID) error
+	Nodes(userIDs []model.UserID, now time.Time) (map[model.UserID][]string, error)
+	Close() error
+}
+
+type ServiceImpl struct {
+	logger *zap.Logger
+
+	nodeID            string
+	ttl               time.Duration
+	heartbeatInterval time.Duration
+
+	store           Store
+	connectionsPool connections_pool.Service
+
+	queue chan *model.PresenceEvent
+
+	done    chan struct{}
+	stopped chan struct{} // closed when run returns, store is closed after that
+	once    sync.Once
+}
+
+func NewServiceImpl(
+	logger *zap.Logger,
+	nodeID string,
+	ttl time.Duration,
+	heartbeatInterval time.Duration,
+	bufferSize int,
+	store Store,
+	connectionsPool connections_pool.Service,
+) *ServiceImpl {
+	return &ServiceImpl{
+		logger:            logger,
+		nodeID:            nodeID,
+		ttl:               ttl,
+		heartbeatInterval: heartbeatInterval,
+		store:             store,
+		connectionsPool:   connectionsPool,
+		queue:             make(chan *model.PresenceEvent, bufferSize),
+		done:              make(chan struct{}),
+		stopped:           make(chan struct{}),
+	}
+}
+
+// Run applies presence changes in order they happened and refreshes users of the node every heartbeat interval
+func (s *ServiceImpl) Run() error {
+	defer close(s.stopped)
+
+	ticker := time.NewTicker(s.heartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return nil
+		case event := <-s.queue:
+			err := s.apply(event)
+			if err != nil {
+				s.logger.Sugar().Errorf("registry %s of %s: %v", event.Type, event.UserID, err)
+			}
+		case <-ticker.C:
+			err := s.heartbeat()
+			if err != nil {
+				s.logger.Sugar().Errorf("registry heartbeat: %v", err)
+			}
+		}
+	}
+}
+
+// Close waits for run to return, so the store is not used after it is closed
+func (s *ServiceImpl) Close() error {
+	s.once.Do(func() {
+		close(s.done)
+	})
+	<-s.stopped
+	return s.store.Close()
+}
+
+func (s *ServiceImpl) Notify(event *model.PresenceEvent) {
+	select {
+	case s.queue <- event:
+	default:
+		s.logger.Sugar().Warnf("registry queue is full, drop %s of %s", event.Type, event.UserID)
+	}
+}
+
+func (s *ServiceImpl) Nodes(userIDs ...model.UserID) (map[model.UserID][]string, error) {
+	nodes, err := s.store.Nodes(userIDs, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("store nodes: %w", err)
+	}
+	return nodes, nil
+}
+
+func (s *ServiceImpl) apply(event *model.PresenceEvent) error {
+	switch event.Type {
+	case model.OnlinePresenceEvent:
+		return s.store.Register(s.nodeID, []model.UserID{event.UserID}, time.Now().Add(s.ttl))
+	case model.OfflinePresenceEvent:
+		return s.store.Unregister(s.nodeID, event.UserID)
+	default:
+		return fmt.Errorf("unexpected presence event: %s", event.Type)
+	}
+}
+
+// heartbeat registers all users connected to the node again, so their entries do not expire
+func (s *ServiceImpl) heartbeat() error {
+	connections := s.connectionsPool.ListConnections()
+
+	seen := make(map[model.UserID]struct{}, len(connections))
+	userIDs := make([]model.UserID, 0, len(connections))
+	for _, connection := range connections {
+		if _, ok := seen[connection.UserID]; ok {
+			continue
+		}
+		seen[connection.UserID] = struct{}{}
+		userIDs = append(userIDs, connection.UserID)
+	}
+
+	if len(userIDs) == 0 {
+		return nil
+	}
+
+	err := s.store.Register(s.nodeID, userIDs, time.Now().Add(s.ttl))
+	if err != nil {
+		return fmt.Errorf("store register %d users: %w", len(userIDs), err)
+	}
+	return nil
+}
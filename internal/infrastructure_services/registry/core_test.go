@@ -0,0 +1,278 @@
+package registry
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	goredis "github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+
+	"github.com/syth0le/realtime-notification-service/internal/infrastructure_services/connections_pool"
+	"github.com/syth0le/realtime-notification-service/internal/model"
+)
+
+const (
+	testNodeID    = "node-1"
+	testTTL       = 300 * time.Millisecond
+	testHeartbeat = 50 * time.Millisecond
+	testWait      = 2 * time.Second
+)
+
+func newRedisStore(t *testing.T) (*RedisStore, *miniredis.Miniredis) {
+	t.Helper()
+
+	server := miniredis.RunT(t)
+	store := NewRedisStore(goredis.NewClient(&goredis.Options{Addr: server.Addr()}), "presence")
+	t.Cleanup(func() {
+		store.Close()
+	})
+	return store, server
+}
+
+func stores(t *testing.T) map[string]Store {
+	redisStore, _ := newRedisStore(t)
+	return map[string]Store{
+		"memory": NewMemoryStore(),
+		"redis":  redisStore,
+	}
+}
+
+func TestStoreExpiry(t *testing.T) {
+	for name, store := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			now := time.Now()
+			if err := store.Register("a", []model.UserID{"u1", "u2"}, now.Add(time.Minute)); err != nil {
+				t.Fatalf("register a: %v", err)
+			}
+			if err := store.Register("b", []model.UserID{"u1"}, now.Add(2*time.Minute)); err != nil {
+				t.Fatalf("register b: %v", err)
+			}
+
+			nodes, err := store.Nodes([]model.UserID{"u1", "u2", "u3"}, now)
+			if err != nil {
+				t.Fatalf("nodes: %v", err)
+			}
+			assertNodes(t, nodes, "u1", "a", "b")
+			assertNodes(t, nodes, "u2", "a")
+			assertNodes(t, nodes, "u3")
+
+			// entries of a are expired, entries of b are not
+			nodes, err = store.Nodes([]model.UserID{"u1", "u2"}, now.Add(90*time.Second))
+			if err != nil {
+				t.Fatalf("nodes: %v", err)
+			}
+			assertNodes(t, nodes, "u1", "b")
+			assertNodes(t, nodes, "u2")
+		})
+	}
+}
+
+func TestStoreUnregister(t *testing.T) {
+	for name, store := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			now := time.Now()
+			if err := store.Register("a", []model.UserID{"u1"}, now.Add(time.Minute)); err != nil {
+				t.Fatalf("register a: %v", err)
+			}
+			if err := store.Register("b", []model.UserID{"u1"}, now.Add(time.Minute)); err != nil {
+				t.Fatalf("register b: %v", err)
+			}
+
+			if err := store.Unregister("a", "u1"); err != nil {
+				t.Fatalf("unregister a: %v", err)
+			}
+			if err := store.Unregister("a", "unknown"); err != nil {
+				t.Fatalf("unregister unknown user: %v", err)
+			}
+
+			nodes, err := store.Nodes([]model.UserID{"u1"}, now)
+			if err != nil {
+				t.Fatalf("nodes: %v", err)
+			}
+			assertNodes(t, nodes, "u1", "b")
+		})
+	}
+}
+
+func TestRedisStoreKeyExpires(t *testing.T) {
+	store, server := newRedisStore(t)
+
+	err := store.Register("a", []model.UserID{"u1"}, time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatalf("register: %v", err)
+	}
+	if !server.Exists(store.key("u1")) {
+		t.Fatalf("key of the registered user does not exist")
+	}
+
+	// key of the user stopped heartbeating is removed by redis itself
+	server.FastForward(2 * time.Minute)
+	if server.Exists(store.key("u1")) {
+		t.Fatalf("key of the expired user exists")
+	}
+}
+
+func TestServiceRegistersPresenceChanges(t *testing.T) {
+	for name, store := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			pool, registry := runService(t, store, time.Minute, 30*time.Second)
+
+			userID := model.UserID("u1")
+			conn := connections_pool.NewConnection(userID, &nopSink{}, "", "")
+			pool.AddConnection(conn)
+			waitNodes(t, registry, userID, testNodeID)
+
+			// user is unregistered with the last connection, not with ttl
+			err := pool.DeleteConnection(&userID, conn.ID)
+			if err != nil {
+				t.Fatalf("delete connection: %v", err)
+			}
+			waitNodes(t, registry, userID)
+		})
+	}
+}
+
+func TestServiceHeartbeat(t *testing.T) {
+	for name, store := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			pool, registry := runService(t, store, testTTL, testHeartbeat)
+
+			userID := model.UserID("u1")
+			conn := connections_pool.NewConnection(userID, &nopSink{}, "", "")
+			pool.AddConnection(conn)
+			waitNodes(t, registry, userID, testNodeID)
+
+			// heartbeat registers connected user again before its entry expires
+			time.Sleep(3 * testTTL)
+			assertNodes(t, mustNodes(t, registry, userID), userID, testNodeID)
+
+			// heartbeat registers only connected users, so disconnected user is not registered again
+			err := pool.DeleteConnection(&userID, conn.ID)
+			if err != nil {
+				t.Fatalf("delete connection: %v", err)
+			}
+			waitNodes(t, registry, userID)
+			time.Sleep(3 * testHeartbeat)
+			assertNodes(t, mustNodes(t, registry, userID), userID)
+		})
+	}
+}
+
+func TestServiceCloseWaitsForRun(t *testing.T) {
+	store := NewMemoryStore()
+	pool := connections_pool.NewServiceImpl(zap.NewNop(), 16, connections_pool.DisconnectPolicy, time.Second)
+	registry := NewServiceImpl(zap.NewNop(), testNodeID, testTTL, testHeartbeat, 16, store, pool)
+
+	stopped := make(chan error, 1)
+	go func() {
+		stopped <- registry.Run()
+	}()
+
+	err := registry.Close()
+	if err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	select {
+	case err = <-stopped:
+		if err != nil {
+			t.Fatalf("run: %v", err)
+		}
+	default:
+		t.Fatalf("close returned before run")
+	}
+}
+
+func runService(
+	t *testing.T,
+	store Store,
+	ttl time.Duration,
+	heartbeatInterval time.Duration,
+) (*connections_pool.ServiceImpl, *ServiceImpl) {
+	t.Helper()
+
+	pool := connections_pool.NewServiceImpl(zap.NewNop(), 16, connections_pool.DisconnectPolicy, time.Second)
+	registry := NewServiceImpl(zap.NewNop(), testNodeID, ttl, heartbeatInterval, 16, store, pool)
+	pool.OnPresenceChange(registry.Notify)
+
+	go registry.Run()
+	t.Cleanup(func() {
+		registry.Close()
+	})
+	return pool, registry
+}
+
+func waitNodes(t *testing.T, registry Service, userID model.UserID, expected ...string) {
+	t.Helper()
+
+	deadline := time.Now().Add(testWait)
+	for {
+		nodes := mustNodes(t, registry, userID)
+		if len(nodes[userID]) == len(expected) {
+			assertNodes(t, nodes, userID, expected...)
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("nodes of %s: expected %v, got %v", userID, expected, nodes[userID])
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func mustNodes(t *testing.T, registry Service, userIDs ...model.UserID) map[model.UserID][]string {
+	t.Helper()
+
+	nodes, err := registry.Nodes(userIDs...)
+	if err != nil {
+		t.Fatalf("nodes: %v", err)
+	}
+	return nodes
+}
+
+func assertNodes(t *testing.T, nodes map[model.UserID][]string, userID model.UserID, expected ...string) {
+	t.Helper()
+
+	if len(expected) == 0 {
+		if _, ok := nodes[userID]; ok {
+			t.Fatalf("nodes of %s: expected none, got %v", userID, nodes[userID])
+		}
+		return
+	}
+
+	got := make(map[string]struct{}, len(nodes[userID]))
+	for _, nodeID := range nodes[userID] {
+		got[nodeID] = struct{}{}
+	}
+	if len(got) != len(expected) {
+		t.Fatalf("nodes of %s: expected %v, got %v", userID, expected, nodes[userID])
+	}
+	for _, nodeID := range expected {
+		if _, ok := got[nodeID]; !ok {
+			t.Fatalf("nodes of %s: expected %v, got %v", userID, expected, nodes[userID])
+		}
+	}
+}
+
+// nopSink accepts every event, connections of the tests are never written to a client
+type nopSink struct{}
+
+func (s *nopSink) Write(event *model.Event, deadline time.Time) error {
+	return nil
+}
+
+func (s *nopSink) Ping(deadline time.Time) error {
+	return nil
+}
+
+func (s *nopSink) Close() error {
+	return nil
+}
+
+func (s *nopSink) Transport() model.Transport {
+	return model.WebSocketTransport
+}
+
+func (s *nopSink) AnswersPings() bool {
+	return true
+}
@@ -0,0 +1,71 @@
+package registry
+
+import (
+	"sync"
+	"time"
+
+	"github.com/syth0le/realtime-notification-service/internal/model"
+)
+
+// MemoryStore keeps registry in memory of the process, it is shared only by nodes running in the same process
+type MemoryStore struct {
+	entries map[model.UserID]map[string]time.Time // node id to expiration time
+	mutex   sync.Mutex
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		entries: make(map[model.UserID]map[string]time.Time),
+		mutex:   sync.Mutex{},
+	}
+}
+
+func (s *MemoryStore) Register(nodeID string, userIDs []model.UserID, expiresAt time.Time) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, userID := range userIDs {
+		if _, ok := s.entries[userID]; !ok {
+			s.entries[userID] = make(map[string]time.Time)
+		}
+		s.entries[userID][nodeID] = expiresAt
+	}
+	return nil
+}
+
+func (s *MemoryStore) Unregister(nodeID string, userID model.UserID) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	delete(s.entries[userID], nodeID)
+	if len(s.entries[userID]) == 0 {
+		delete(s.entries, userID)
+	}
+	return nil
+}
+
+// Nodes removes expired entries of the requested users
+func (s *MemoryStore) Nodes(userIDs []model.UserID, now time.Time) (map[model.UserID][]string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	res := make(map[model.UserID][]string, len(userIDs))
+	for _, userID := range userIDs {
+		for nodeID, expiresAt := range s.entries[userID] {
+			if !now.Before(expiresAt) {
+				delete(s.entries[userID], nodeID)
+				continue
+			}
+			res[userID] = append(res[userID], nodeID)
+		}
+
+		if len(s.entries[userID]) == 0 {
+			delete(s.entries, userID)
+		}
+	}
+	return res, nil
+}
+
+func (s *MemoryStore) Close() error {
+	return nil
+}
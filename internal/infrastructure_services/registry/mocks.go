@@ -0,0 +1,26 @@
+package registry
+
+import (
+	"github.com/syth0le/realtime-notification-service/internal/model"
+)
+
+// ServiceMock is used when registry is disabled, node knows only its own connections
+type ServiceMock struct{}
+
+func NewServiceMock() *ServiceMock {
+	return &ServiceMock{}
+}
+
+func (s *ServiceMock) Run() error {
+	return nil
+}
+
+func (s *ServiceMock) Close() error {
+	return nil
+}
+
+func (s *ServiceMock) Notify(event *model.PresenceEvent) {}
+
+func (s *ServiceMock) Nodes(userIDs ...model.UserID) (map[model.UserID][]string, error) {
+	return map[model.UserID][]string{}, nil
+}
@@ -0,0 +1,95 @@
+package registry
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	goredis "github.com/redis/go-redis/v9"
+
+	"github.com/syth0le/realtime-notification-service/internal/model"
+)
+
+const defaultCommandTimeout = 5 * time.Second
+
+// RedisStore keeps nodes of every user in a sorted set scored by expiration time in milliseconds,
+// key of the user expires together with its latest entry, so all nodes must use the same ttl
+type RedisStore struct {
+	client    *goredis.Client
+	keyPrefix string
+}
+
+func NewRedisStore(client *goredis.Client, keyPrefix string) *RedisStore {
+	return &RedisStore{
+		client:    client,
+		keyPrefix: keyPrefix,
+	}
+}
+
+// Register adds node to the sets of the users and removes expired entries of them in one round trip
+func (s *RedisStore) Register(nodeID string, userIDs []model.UserID, expiresAt time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultCommandTimeout)
+	defer cancel()
+
+	now := strconv.FormatInt(time.Now().UnixMilli(), 10)
+	_, err := s.client.Pipelined(ctx, func(pipe goredis.Pipeliner) error {
+		for _, userID := range userIDs {
+			key := s.key(userID)
+			pipe.ZRemRangeByScore(ctx, key, "-inf", now)
+			pipe.ZAdd(ctx, key, goredis.Z{Score: float64(expiresAt.UnixMilli()), Member: nodeID})
+			pipe.PExpireAt(ctx, key, expiresAt)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("register: %w", err)
+	}
+	return nil
+}
+
+func (s *RedisStore) Unregister(nodeID string, userID model.UserID) error {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultCommandTimeout)
+	defer cancel()
+
+	err := s.client.ZRem(ctx, s.key(userID), nodeID).Err()
+	if err != nil {
+		return fmt.Errorf("unregister: %w", err)
+	}
+	return nil
+}
+
+func (s *RedisStore) Nodes(userIDs []model.UserID, now time.Time) (map[model.UserID][]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultCommandTimeout)
+	defer cancel()
+
+	// entry expiring exactly now is expired
+	from := "(" + strconv.FormatInt(now.UnixMilli(), 10)
+
+	commands := make([]*goredis.StringSliceCmd, 0, len(userIDs))
+	_, err := s.client.Pipelined(ctx, func(pipe goredis.Pipeliner) error {
+		for _, userID := range userIDs {
+			commands = append(commands, pipe.ZRangeByScore(ctx, s.key(userID), &goredis.ZRangeBy{Min: from, Max: "+inf"}))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("nodes: %w", err)
+	}
+
+	res := make(map[model.UserID][]string, len(userIDs))
+	for i, command := range commands {
+		if nodes := command.Val(); len(nodes) > 0 {
+			res[userIDs[i]] = nodes
+		}
+	}
+	return res, nil
+}
+
+func (s *RedisStore) Close() error {
+	return s.client.Close()
+}
+
+func (s *RedisStore) key(userID model.UserID) string {
+	return fmt.Sprintf("%s:user:%s", s.keyPrefix, userID)
+}
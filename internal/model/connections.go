@@ -0,0 +1,54 @@
+package model
+
+import (
+	"time"
+)
+
+type ConnectionID string
+
+func (c ConnectionID) String() string {
+	return string(c)
+}
+
+type Transport string
+
+const (
+	WebSocketTransport        Transport = "websocket"
+	ServerSentEventsTransport Transport = "sse"
+	LongPollingTransport      Transport = "long_polling"
+	GRPCTransport             Transport = "grpc"
+)
+
+type ConnectionInfo struct {
+	ID          ConnectionID
+	UserID      UserID
+	Transport   Transport
+	RemoteAddr  string
+	UserAgent   string
+	ConnectedAt time.Time
+}
+
+// Presence is a state of user connections on the node
+type Presence struct {
+	UserID      UserID
+	Online      bool
+	Since       time.Time         // time of the earliest live connection, zero if offline
+	LastSeen    time.Time         // zero if offline
+	Connections []*ConnectionInfo // connections of this node only
+	Nodes       []string          // nodes holding connections of the user, empty if registry is disabled
+}
+
+type PresenceEventType string
+
+const (
+	OnlinePresenceEvent  PresenceEventType = "presence.online"
+	OfflinePresenceEvent PresenceEventType = "presence.offline"
+)
+
+// PresenceEvent is published when the user opens the first connection to the node or closes the last one
+type PresenceEvent struct {
+	Type   PresenceEventType `json:"type"`
+	UserID UserID            `json:"user_id"`
+	NodeID string            `json:"node_id"`
+	At     time.Time         `json:"at"`
+}
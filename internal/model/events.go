@@ -0,0 +1,62 @@
+package model
+
+import (
+	"fmt"
+	"time"
+)
+
+type EventID string
+
+func (e EventID) String() string {
+	return string(e)
+}
+
+// Event is a notification prepared for delivery to a single user
+type Event struct {
+	ID        EventID
+	UserID    UserID
+	Type      NotificationType
+	Data      []byte // notification envelope
+	Payload   []byte // type specific body of the notification, legacy feed clients receive it without envelope
+	CreatedAt time.Time
+}
+
+func NewEvent(notification *Notification) (*Event, error) {
+	data, err := notification.MarshalBinary()
+	if err != nil {
+		return nil, fmt.Errorf("marshal notification: %w", err)
+	}
+
+	return &Event{
+		ID:        notification.ID,
+		UserID:    notification.Recipient,
+		Type:      notification.Type,
+		Data:      data,
+		Payload:   notification.Payload,
+		CreatedAt: notification.CreatedAt,
+	}, nil
+}
+
+// MarshalBinary encodes event as its notification envelope
+func (e *Event) MarshalBinary() ([]byte, error) {
+	return e.Data, nil
+}
+
+// UnmarshalBinary restores event from its notification envelope
+func (e *Event) UnmarshalBinary(data []byte) error {
+	notification := new(Notification)
+	err := notification.UnmarshalBinary(data)
+	if err != nil {
+		return fmt.Errorf("unmarshal notification: %w", err)
+	}
+
+	*e = Event{
+		ID:        notification.ID,
+		UserID:    notification.Recipient,
+		Type:      notification.Type,
+		Data:      data,
+		Payload:   notification.Payload,
+		CreatedAt: notification.CreatedAt,
+	}
+	return nil
+}
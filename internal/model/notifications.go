@@ -2,42 +2,128 @@ package model
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"sync"
+	"time"
 
 	"gopkg.in/validator.v2"
 )
 
+const CurrentNotificationVersion = 1
+
+var ErrUnknownNotificationType = errors.New("unknown notification type")
+
 type UserID string
 
 func (u UserID) String() string {
 	return string(u)
 }
 
-type PostID string
+type NotificationType string
 
-func (p PostID) String() string {
-	return string(p)
+func (t NotificationType) String() string {
+	return string(t)
 }
 
-type Post struct {
-	ID       PostID `validator:"nonzero"`
-	Text     string `validator:"nonzero"`
-	AuthorID UserID `validator:"nonzero"`
+const (
+	FeedPostedType      NotificationType = "feed.posted"
+	PostLikedType       NotificationType = "post.liked"
+	PostCommentedType   NotificationType = "post.commented"
+	FriendRequestedType NotificationType = "friend.requested"
+	MessageSentType     NotificationType = "message.sent"
+)
+
+// Payload is a type specific body of a notification
+type Payload interface {
+	Validate() error
 }
 
-func (p *Post) Validate() error {
-	if err := validator.Validate(p); err != nil {
-		return fmt.Errorf("validate: %w", err)
+var (
+	payloadRegistry = map[NotificationType]func() Payload{
+		FeedPostedType:      func() Payload { return new(Post) },
+		PostLikedType:       func() Payload { return new(Like) },
+		PostCommentedType:   func() Payload { return new(Comment) },
+		FriendRequestedType: func() Payload { return new(FriendRequest) },
+		MessageSentType:     func() Payload { return new(Message) },
+	}
+	payloadRegistryMutex sync.RWMutex
+)
+
+// RegisterPayload registers payload constructor of a notification type, registered type replaces existing one
+func RegisterPayload(notificationType NotificationType, constructor func() Payload) {
+	payloadRegistryMutex.Lock()
+	defer payloadRegistryMutex.Unlock()
+
+	payloadRegistry[notificationType] = constructor
+}
+
+// KnownNotificationType reports whether notification type has registered payload
+func KnownNotificationType(notificationType NotificationType) bool {
+	payloadRegistryMutex.RLock()
+	defer payloadRegistryMutex.RUnlock()
+
+	_, ok := payloadRegistry[notificationType]
+	return ok
+}
+
+func newPayload(notificationType NotificationType) (Payload, bool) {
+	payloadRegistryMutex.RLock()
+	defer payloadRegistryMutex.RUnlock()
+
+	constructor, ok := payloadRegistry[notificationType]
+	if !ok {
+		return nil, false
+	}
+	return constructor(), true
+}
+
+// Notification is an envelope of every notification delivered to users
+type Notification struct {
+	ID        EventID          `json:"id" validate:"nonzero"`
+	Type      NotificationType `json:"type" validate:"nonzero"`
+	Version   int              `json:"version" validate:"min=1"`
+	CreatedAt time.Time        `json:"created_at"`
+	Actor     UserID           `json:"actor,omitempty"`
+	Recipient UserID           `json:"recipient" validate:"nonzero"`
+	Payload   json.RawMessage  `json:"payload" validate:"nonzero"`
+}
+
+// Validate validates envelope and its payload according to the notification type
+func (n *Notification) Validate() error {
+	if err := validator.Validate(n); err != nil {
+		return fmt.Errorf("validate envelope: %w", err)
+	}
+
+	payload, err := n.DecodePayload()
+	if err != nil {
+		return err
+	}
+
+	if err = payload.Validate(); err != nil {
+		return fmt.Errorf("validate %s payload: %w", n.Type, err)
 	}
 	return nil
 }
 
-func (p *Post) MarshalBinary() ([]byte, error) {
-	return json.Marshal(p)
+func (n *Notification) DecodePayload() (Payload, error) {
+	payload, ok := newPayload(n.Type)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownNotificationType, n.Type)
+	}
+
+	if err := json.Unmarshal(n.Payload, payload); err != nil {
+		return nil, fmt.Errorf("unmarshal %s payload: %w", n.Type, err)
+	}
+	return payload, nil
+}
+
+func (n *Notification) MarshalBinary() ([]byte, error) {
+	return json.Marshal(n)
 }
 
-func (p *Post) UnmarshalBinary(data []byte) error {
-	if err := json.Unmarshal(data, &p); err != nil {
+func (n *Notification) UnmarshalBinary(data []byte) error {
+	if err := json.Unmarshal(data, &n); err != nil {
 		return err
 	}
 
@@ -0,0 +1,92 @@
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"gopkg.in/validator.v2"
+)
+
+type PostID string
+
+func (p PostID) String() string {
+	return string(p)
+}
+
+// Post is a payload of feed.posted notification, it keeps wire format of social-network posts
+type Post struct {
+	ID       PostID `validate:"nonzero"`
+	Text     string `validate:"nonzero"`
+	AuthorID UserID `validate:"nonzero"`
+}
+
+func (p *Post) Validate() error {
+	if err := validator.Validate(p); err != nil {
+		return fmt.Errorf("validate: %w", err)
+	}
+	return nil
+}
+
+func (p *Post) MarshalBinary() ([]byte, error) {
+	return json.Marshal(p)
+}
+
+func (p *Post) UnmarshalBinary(data []byte) error {
+	if err := json.Unmarshal(data, &p); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+type Like struct {
+	PostID PostID `json:"post_id" validate:"nonzero"`
+	UserID UserID `json:"user_id" validate:"nonzero"`
+}
+
+func (l *Like) Validate() error {
+	if err := validator.Validate(l); err != nil {
+		return fmt.Errorf("validate: %w", err)
+	}
+	return nil
+}
+
+type Comment struct {
+	ID       string `json:"id" validate:"nonzero"`
+	PostID   PostID `json:"post_id" validate:"nonzero"`
+	AuthorID UserID `json:"author_id" validate:"nonzero"`
+	Text     string `json:"text" validate:"nonzero"`
+}
+
+func (c *Comment) Validate() error {
+	if err := validator.Validate(c); err != nil {
+		return fmt.Errorf("validate: %w", err)
+	}
+	return nil
+}
+
+type FriendRequest struct {
+	FromUserID UserID `json:"from_user_id" validate:"nonzero"`
+	ToUserID   UserID `json:"to_user_id" validate:"nonzero"`
+}
+
+func (f *FriendRequest) Validate() error {
+	if err := validator.Validate(f); err != nil {
+		return fmt.Errorf("validate: %w", err)
+	}
+	return nil
+}
+
+type Message struct {
+	ID       string `json:"id" validate:"nonzero"`
+	DialogID string `json:"dialog_id" validate:"nonzero"`
+	AuthorID UserID `json:"author_id" validate:"nonzero"`
+	Text     string `json:"text" validate:"nonzero"`
+}
+
+func (m *Message) Validate() error {
+	if err := validator.Validate(m); err != nil {
+		return fmt.Errorf("validate: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package admin
+
+import (
+	"context"
+	"fmt"
+
+	xerrors "github.com/syth0le/gopnik/errors"
+	"go.uber.org/zap"
+
+	"github.com/syth0le/realtime-notification-service/internal/clients/broker"
+)
+
+const maxDeadLettersLimit = 1000
+
+type Service interface {
+	ListDeadLetters(ctx context.Context, limit int) ([]*broker.DeadLetter, error)
+	GetDeadLetter(ctx context.Context, messageID string) (*broker.DeadLetter, error)
+	ReplayDeadLetter(ctx context.Context, messageID string) error
+}
+
+type ServiceImpl struct {
+	DeadLetters broker.DeadLetters
+	Logger      *zap.Logger
+}
+
+func (s ServiceImpl) ListDeadLetters(ctx context.Context, limit int) ([]*broker.DeadLetter, error) {
+	if limit <= 0 || limit > maxDeadLettersLimit {
+		return nil, xerrors.WrapValidationError(fmt.Errorf("limit must be in range (0, %d]", maxDeadLettersLimit))
+	}
+
+	letters, err := s.DeadLetters.ListDeadLetters(limit)
+	if err != nil {
+		return nil, internalError(fmt.Errorf("list dead letters: %w", err))
+	}
+
+	return letters, nil
+}
+
+func (s ServiceImpl) GetDeadLetter(ctx context.Context, messageID string) (*broker.DeadLetter, error) {
+	if messageID == "" {
+		return nil, xerrors.WrapValidationError(fmt.Errorf("empty message id"))
+	}
+
+	letter, err := s.DeadLetters.GetDeadLetter(messageID)
+	if err != nil {
+		return nil, internalError(fmt.Errorf("get dead letter: %w", err))
+	}
+
+	return letter, nil
+}
+
+// ReplayDeadLetter publishes dead letter to its original exchange and removes it from the dead-letter queue
+func (s ServiceImpl) ReplayDeadLetter(ctx context.Context, messageID string) error {
+	if messageID == "" {
+		return xerrors.WrapValidationError(fmt.Errorf("empty message id"))
+	}
+
+	err := s.DeadLetters.ReplayDeadLetter(messageID)
+	if err != nil {
+		return internalError(fmt.Errorf("replay dead letter: %w", err))
+	}
+
+	s.Logger.Sugar().Infof("dead letter %s is replayed by admin", messageID)
+	return nil
+}
+
+// internalError keeps status of errors like not found dead letter, other broker errors are internal
+func internalError(err error) error {
+	if _, ok := xerrors.FromError(err); ok {
+		return err
+	}
+	return xerrors.WrapInternalError(err)
+}
@@ -0,0 +1,22 @@
+package notifications
+
+import (
+	"context"
+	"fmt"
+
+	xerrors "github.com/syth0le/gopnik/errors"
+
+	"github.com/syth0le/realtime-notification-service/internal/infrastructure_services/connections_pool"
+	"github.com/syth0le/realtime-notification-service/internal/model"
+)
+
+// AckEvents acknowledges events received by the client, broker messages of the events are acked
+func (s ServiceImpl) AckEvents(ctx context.Context, conn *connections_pool.Connection, eventIDs []model.EventID) error {
+	if len(eventIDs) == 0 {
+		return xerrors.WrapValidationError(fmt.Errorf("empty event ids"))
+	}
+
+	s.Acks.Ack(&conn.UserID, eventIDs...)
+	s.Logger.Sugar().Debugf("acked events %v: %s", eventIDs, conn.ID)
+	return nil
+}
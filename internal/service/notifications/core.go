@@ -3,36 +3,84 @@ package notifications
 import (
 	"context"
 	"fmt"
-	"net"
+	"time"
 
 	"go.uber.org/zap"
 
+	"github.com/syth0le/realtime-notification-service/internal/infrastructure_services/acknowledgements"
 	"github.com/syth0le/realtime-notification-service/internal/infrastructure_services/connections_pool"
 	"github.com/syth0le/realtime-notification-service/internal/infrastructure_services/consumers_pool"
+	"github.com/syth0le/realtime-notification-service/internal/infrastructure_services/dispatcher"
+	"github.com/syth0le/realtime-notification-service/internal/infrastructure_services/inbox"
 	"github.com/syth0le/realtime-notification-service/internal/model"
 )
 
 type Service interface {
-	SubscribeFeedNotifications(ctx context.Context, conn net.Conn, userID *model.UserID) error
+	SubscribeFeedNotifications(ctx context.Context, conn *connections_pool.Connection, lastEventID model.EventID) error
+	UnsubscribeFeedNotifications(ctx context.Context, conn *connections_pool.Connection) error
+	PollFeedNotifications(ctx context.Context, params *PollParams) (*PollResult, error)
+	SubscribeTopics(ctx context.Context, conn *connections_pool.Connection, topics []model.NotificationType) error
+	UnsubscribeTopics(ctx context.Context, conn *connections_pool.Connection, topics []model.NotificationType) error
+	AckEvents(ctx context.Context, conn *connections_pool.Connection, eventIDs []model.EventID) error
+	GetInbox(ctx context.Context, userID model.UserID) ([]*model.Event, error)
+	DeleteInbox(ctx context.Context, userID model.UserID, eventIDs []model.EventID) error
 }
 
 type ServiceImpl struct {
 	ConnectionsPool connections_pool.Service
 	ConsumersPool   consumers_pool.Service
+	Dispatcher      dispatcher.Service
+	Acks            acknowledgements.Service
+	Inbox           inbox.Service
 	Logger          *zap.Logger
+
+	LongPollBufferSize  int
+	LongPollIdleTimeout time.Duration
+	LongPollMaxTimeout  time.Duration
+}
+
+// SubscribeFeedNotifications saves connection and replays events published after the last event seen by the client
+func (s ServiceImpl) SubscribeFeedNotifications(ctx context.Context, conn *connections_pool.Connection, lastEventID model.EventID) error {
+	s.Logger.Sugar().Infof("handle feed notifications for: %s", conn.UserID)
+
+	s.Dispatcher.Attach(conn, lastEventID)
+
+	err := s.ConsumersPool.Subscribe(&conn.UserID)
+	if err != nil {
+		// connection holds no subscription, so it must not release one when it is closed
+		deleteErr := s.ConnectionsPool.DeleteConnection(&conn.UserID, conn.ID)
+		if deleteErr != nil {
+			s.Logger.Sugar().Debugf("delete connection: %v", deleteErr)
+		}
+		return fmt.Errorf("subscribe consumer: %w", err)
+	}
+
+	s.Logger.Sugar().Infof("subscribed consumer and saved connection: %s: %s", conn.UserID, conn.ID)
+
+	return nil
 }
 
-func (s ServiceImpl) SubscribeFeedNotifications(ctx context.Context, conn net.Conn, userID *model.UserID) error {
-	s.Logger.Sugar().Infof("handle feed notifications for: %s", userID)
+// UnsubscribeFeedNotifications closes connection and removes it from the pool,
+// user's consumer subscription is released together with the last user connection
+func (s ServiceImpl) UnsubscribeFeedNotifications(ctx context.Context, conn *connections_pool.Connection) error {
+	s.Logger.Sugar().Infof("unsubscribe feed notifications for: %s: %s", conn.UserID, conn.ID)
 
-	s.ConnectionsPool.AddConnection(userID, conn)
+	err := conn.Close()
+	if err != nil {
+		s.Logger.Sugar().Debugf("close connection: %s: %v", conn.ID, err)
+	}
 
-	err := s.ConsumersPool.AddConsumer(userID)
+	err = s.ConnectionsPool.DeleteConnection(&conn.UserID, conn.ID)
 	if err != nil {
-		return fmt.Errorf("add consumer: %w", err)
+		// connection is already removed and its subscription is released
+		s.Logger.Sugar().Debugf("delete connection: %v", err)
+		return nil
 	}
 
-	s.Logger.Sugar().Infof("created consumer and saved connection: %s", userID)
+	err = s.ConsumersPool.Unsubscribe(&conn.UserID)
+	if err != nil {
+		return fmt.Errorf("unsubscribe consumer: %w", err)
+	}
 
 	return nil
 }
@@ -0,0 +1,34 @@
+package notifications
+
+import (
+	"context"
+	"fmt"
+
+	xerrors "github.com/syth0le/gopnik/errors"
+
+	"github.com/syth0le/realtime-notification-service/internal/model"
+)
+
+// GetInbox returns notifications stored while the user had no connections
+func (s ServiceImpl) GetInbox(ctx context.Context, userID model.UserID) ([]*model.Event, error) {
+	events, err := s.Inbox.List(&userID)
+	if err != nil {
+		return nil, xerrors.WrapInternalError(fmt.Errorf("list inbox: %w", err))
+	}
+
+	return events, nil
+}
+
+// DeleteInbox removes fetched notifications from the inbox
+func (s ServiceImpl) DeleteInbox(ctx context.Context, userID model.UserID, eventIDs []model.EventID) error {
+	if len(eventIDs) == 0 {
+		return xerrors.WrapValidationError(fmt.Errorf("empty event ids"))
+	}
+
+	err := s.Inbox.Delete(&userID, eventIDs...)
+	if err != nil {
+		return xerrors.WrapInternalError(fmt.Errorf("delete inbox: %w", err))
+	}
+
+	return nil
+}
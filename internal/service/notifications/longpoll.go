@@ -0,0 +1,131 @@
+package notifications
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	xerrors "github.com/syth0le/gopnik/errors"
+
+	"github.com/syth0le/realtime-notification-service/internal/infrastructure_services/connections_pool"
+	"github.com/syth0le/realtime-notification-service/internal/model"
+)
+
+const cursorSeparator = ":"
+
+type PollParams struct {
+	UserID     model.UserID
+	Cursor     string
+	Timeout    time.Duration
+	RemoteAddr string
+	UserAgent  string
+}
+
+type PollResult struct {
+	Events []*model.Event
+	Cursor string
+}
+
+// PollFeedNotifications waits for user notifications buffered in the long poll session referenced by cursor,
+// new session is opened if cursor is empty or its session has expired
+func (s ServiceImpl) PollFeedNotifications(ctx context.Context, params *PollParams) (*PollResult, error) {
+	connectionID, seq, err := parseCursor(params.Cursor)
+	if err != nil {
+		return nil, xerrors.WrapValidationError(fmt.Errorf("parse cursor: %w", err))
+	}
+
+	conn, sink, err := s.longPollSession(ctx, params, connectionID)
+	if err != nil {
+		return nil, xerrors.WrapInternalError(fmt.Errorf("long poll session: %w", err))
+	}
+	if conn.ID != connectionID {
+		seq = 0
+	}
+
+	timeout := params.Timeout
+	if timeout <= 0 || timeout > s.LongPollMaxTimeout {
+		timeout = s.LongPollMaxTimeout
+	}
+
+	polled, seq, err := sink.Poll(ctx, seq, timeout)
+	if err != nil {
+		// client gets an error rather than an empty poll, so it does not take lost events for no events
+		return nil, xerrors.WrapInternalError(fmt.Errorf("poll: %w", err))
+	}
+
+	events := make([]*model.Event, 0, len(polled))
+	for _, event := range polled {
+		events = append(events, event.Event)
+	}
+
+	return &PollResult{
+		Events: events,
+		Cursor: formatCursor(conn.ID, seq),
+	}, nil
+}
+
+func (s ServiceImpl) longPollSession(
+	ctx context.Context,
+	params *PollParams,
+	connectionID model.ConnectionID,
+) (*connections_pool.Connection, *connections_pool.LongPollSink, error) {
+	if connectionID != "" {
+		conn, err := s.ConnectionsPool.GetConnection(&params.UserID, connectionID)
+		if err == nil {
+			if sink, ok := conn.Sink.(*connections_pool.LongPollSink); ok {
+				return conn, sink, nil
+			}
+		}
+	}
+
+	sink := connections_pool.NewLongPollSink(s.LongPollBufferSize, s.LongPollIdleTimeout)
+	conn := connections_pool.NewConnection(params.UserID, sink, params.RemoteAddr, params.UserAgent)
+	conn.SubscribeTopics(model.FeedPostedType)
+
+	// session has no owner goroutine, it is closed when the client stops polling even if heartbeat is disabled
+	ctx = context.WithoutCancel(ctx)
+	go func() {
+		select {
+		case <-conn.Done():
+		case <-sink.Idle():
+			s.Logger.Sugar().Infof("long poll session is idle: %s: %s", conn.UserID, conn.ID)
+		}
+
+		err := s.UnsubscribeFeedNotifications(ctx, conn)
+		if err != nil {
+			s.Logger.Sugar().Errorf("unsubscribe long poll session: %v", err)
+		}
+	}()
+
+	err := s.SubscribeFeedNotifications(ctx, conn, "")
+	if err != nil {
+		_ = conn.Close()
+		return nil, nil, fmt.Errorf("subscribe feed notifications: %w", err)
+	}
+
+	return conn, sink, nil
+}
+
+func parseCursor(cursor string) (model.ConnectionID, uint64, error) {
+	if cursor == "" {
+		return "", 0, nil
+	}
+
+	connectionID, seqStr, ok := strings.Cut(cursor, cursorSeparator)
+	if !ok {
+		return "", 0, fmt.Errorf("unexpected cursor format")
+	}
+
+	seq, err := strconv.ParseUint(seqStr, 10, 64)
+	if err != nil {
+		return "", 0, fmt.Errorf("parse sequence: %w", err)
+	}
+
+	return model.ConnectionID(connectionID), seq, nil
+}
+
+func formatCursor(connectionID model.ConnectionID, seq uint64) string {
+	return connectionID.String() + cursorSeparator + strconv.FormatUint(seq, 10)
+}
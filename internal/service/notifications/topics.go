@@ -0,0 +1,49 @@
+package notifications
+
+import (
+	"context"
+	"fmt"
+
+	xerrors "github.com/syth0le/gopnik/errors"
+
+	"github.com/syth0le/realtime-notification-service/internal/infrastructure_services/connections_pool"
+	"github.com/syth0le/realtime-notification-service/internal/model"
+)
+
+// SubscribeTopics starts delivery of notifications of the given types to the connection,
+// notifications of the added types missed by the client are delivered first
+func (s ServiceImpl) SubscribeTopics(ctx context.Context, conn *connections_pool.Connection, topics []model.NotificationType) error {
+	err := validateTopics(topics)
+	if err != nil {
+		return err
+	}
+
+	s.Dispatcher.Subscribe(conn, topics...)
+	s.Logger.Sugar().Debugf("subscribed topics %v: %s", topics, conn.ID)
+	return nil
+}
+
+// UnsubscribeTopics stops delivery of notifications of the given types to the connection
+func (s ServiceImpl) UnsubscribeTopics(ctx context.Context, conn *connections_pool.Connection, topics []model.NotificationType) error {
+	err := validateTopics(topics)
+	if err != nil {
+		return err
+	}
+
+	conn.UnsubscribeTopics(topics...)
+	s.Logger.Sugar().Debugf("unsubscribed topics %v: %s", topics, conn.ID)
+	return nil
+}
+
+func validateTopics(topics []model.NotificationType) error {
+	if len(topics) == 0 {
+		return xerrors.WrapValidationError(fmt.Errorf("empty topics"))
+	}
+
+	for _, topic := range topics {
+		if !model.KnownNotificationType(topic) {
+			return xerrors.WrapNotFoundError(fmt.Errorf("unknown topic: %s", topic), "unknown topic")
+		}
+	}
+	return nil
+}
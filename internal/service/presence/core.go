@@ -0,0 +1,136 @@
+package presence
+
+import (
+	"context"
+	"fmt"
+
+	xerrors "github.com/syth0le/gopnik/errors"
+	"go.uber.org/zap"
+
+	"github.com/syth0le/realtime-notification-service/internal/infrastructure_services/connections_pool"
+	"github.com/syth0le/realtime-notification-service/internal/infrastructure_services/registry"
+	"github.com/syth0le/realtime-notification-service/internal/model"
+)
+
+const MaxUsers = 1000
+
+// Service tells which users are connected to the node, on how many connections and since when
+type Service interface {
+	IsOnline(ctx context.Context, userID model.UserID) (bool, error)
+	GetUserPresence(ctx context.Context, userID model.UserID) (*model.Presence, error)
+	GetPresence(ctx context.Context, userIDs []model.UserID) ([]*model.Presence, error)
+	// DisconnectUser closes all user connections and returns their number
+	DisconnectUser(ctx context.Context, userID model.UserID) (int, error)
+}
+
+type ServiceImpl struct {
+	ConnectionsPool connections_pool.Service
+	Registry        registry.Service
+	Logger          *zap.Logger
+}
+
+func (s ServiceImpl) IsOnline(ctx context.Context, userID model.UserID) (bool, error) {
+	if userID == "" {
+		return false, xerrors.WrapValidationError(fmt.Errorf("user id must not be empty"))
+	}
+
+	if len(s.userConnections(userID)) > 0 {
+		return true, nil
+	}
+
+	nodes, err := s.Registry.Nodes(userID)
+	if err != nil {
+		return false, xerrors.WrapInternalError(fmt.Errorf("get nodes of %s: %w", userID, err))
+	}
+	return len(nodes[userID]) > 0, nil
+}
+
+func (s ServiceImpl) GetUserPresence(ctx context.Context, userID model.UserID) (*model.Presence, error) {
+	if userID == "" {
+		return nil, xerrors.WrapValidationError(fmt.Errorf("user id must not be empty"))
+	}
+
+	nodes, err := s.Registry.Nodes(userID)
+	if err != nil {
+		return nil, xerrors.WrapInternalError(fmt.Errorf("get nodes of %s: %w", userID, err))
+	}
+
+	return s.userPresence(userID, nodes[userID]), nil
+}
+
+func (s ServiceImpl) GetPresence(ctx context.Context, userIDs []model.UserID) ([]*model.Presence, error) {
+	if len(userIDs) == 0 || len(userIDs) > MaxUsers {
+		return nil, xerrors.WrapValidationError(fmt.Errorf("number of users must be in range (0, %d]", MaxUsers))
+	}
+
+	for _, userID := range userIDs {
+		if userID == "" {
+			return nil, xerrors.WrapValidationError(fmt.Errorf("user id must not be empty"))
+		}
+	}
+
+	nodes, err := s.Registry.Nodes(userIDs...)
+	if err != nil {
+		return nil, xerrors.WrapInternalError(fmt.Errorf("get nodes: %w", err))
+	}
+
+	presences := make([]*model.Presence, 0, len(userIDs))
+	for _, userID := range userIDs {
+		presences = append(presences, s.userPresence(userID, nodes[userID]))
+	}
+
+	return presences, nil
+}
+
+func (s ServiceImpl) DisconnectUser(ctx context.Context, userID model.UserID) (int, error) {
+	if userID == "" {
+		return 0, xerrors.WrapValidationError(fmt.Errorf("user id must not be empty"))
+	}
+
+	connections := s.userConnections(userID)
+	for _, connection := range connections {
+		// connection is removed from the pool by its owner
+		err := connection.Close()
+		if err != nil {
+			s.Logger.Sugar().Warnf("close connection %s of %s: %v", connection.ID, userID, err)
+		}
+	}
+
+	s.Logger.Sugar().Infof("disconnected %d connections of %s", len(connections), userID)
+	return len(connections), nil
+}
+
+// userPresence merges local connections with nodes of the registry, user connected to another node is online
+// with no connections and times
+func (s ServiceImpl) userPresence(userID model.UserID, nodes []string) *model.Presence {
+	connections := s.userConnections(userID)
+
+	presence := &model.Presence{
+		UserID:      userID,
+		Online:      len(connections) > 0 || len(nodes) > 0,
+		Connections: make([]*model.ConnectionInfo, 0, len(connections)),
+		Nodes:       nodes,
+	}
+	for _, connection := range connections {
+		info := connection.ConnectionInfo
+		presence.Connections = append(presence.Connections, &info)
+
+		if presence.Since.IsZero() || info.ConnectedAt.Before(presence.Since) {
+			presence.Since = info.ConnectedAt
+		}
+		if lastSeen := connection.LastSeen(); lastSeen.After(presence.LastSeen) {
+			presence.LastSeen = lastSeen
+		}
+	}
+
+	return presence
+}
+
+// userConnections returns nothing if the user has no connections, pool reports it as not found error
+func (s ServiceImpl) userConnections(userID model.UserID) []*connections_pool.Connection {
+	connections, err := s.ConnectionsPool.GetUserConnections(&userID)
+	if err != nil {
+		return nil
+	}
+	return connections
+}
@@ -0,0 +1,155 @@
+package publish
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	xerrors "github.com/syth0le/gopnik/errors"
+	"go.uber.org/zap"
+
+	"github.com/syth0le/realtime-notification-service/internal/clients/broker"
+	"github.com/syth0le/realtime-notification-service/internal/model"
+	"github.com/syth0le/realtime-notification-service/internal/utils"
+)
+
+const (
+	MaxRecipients = 1000
+	MaxBatchSize  = 100
+
+	contentTypeJSON       = "application/json"
+	defaultPublishTimeout = 5 * time.Second
+)
+
+// Publication is a notification addressed to one or many recipients, recipient of the notification is ignored
+type Publication struct {
+	Notification *model.Notification
+	Recipients   []model.UserID
+}
+
+// Result tells whether the event is published to the broker
+type Result struct {
+	Event *model.Event
+	Err   error // set if the event is not published, it is not delivered to the recipient
+}
+
+// Service publishes notifications of services without broker dependency to the notifications topic, so they are
+// consumed by the node the recipient is connected to and delivered the same way as notifications of other producers.
+// Events are published independently, so a publication may be published partly. Error is returned if nothing
+// is published, otherwise results tell which events failed and can be published again without duplicates
+type Service interface {
+	Publish(ctx context.Context, publication *Publication) ([]*Result, error)
+	// PublishBatch validates all publications before any of them is delivered
+	PublishBatch(ctx context.Context, publications []*Publication) ([]*Result, error)
+}
+
+type ServiceImpl struct {
+	Publisher broker.Publisher
+	Topic     func(key string) string // topic notifications of the recipient are consumed from
+	Logger    *zap.Logger
+}
+
+func (s ServiceImpl) Publish(ctx context.Context, publication *Publication) ([]*Result, error) {
+	return s.PublishBatch(ctx, []*Publication{publication})
+}
+
+func (s ServiceImpl) PublishBatch(ctx context.Context, publications []*Publication) ([]*Result, error) {
+	if len(publications) == 0 || len(publications) > MaxBatchSize {
+		return nil, xerrors.WrapValidationError(fmt.Errorf("batch size must be in range (0, %d]", MaxBatchSize))
+	}
+
+	events := make([]*model.Event, 0, len(publications))
+	for i, publication := range publications {
+		publicationEvents, err := newEvents(publication)
+		if err != nil {
+			return nil, xerrors.WrapValidationError(fmt.Errorf("publication %d: %w", i, err))
+		}
+		events = append(events, publicationEvents...)
+	}
+
+	var (
+		results  = make([]*Result, 0, len(events))
+		failed   error
+		failures int
+	)
+	for _, event := range events {
+		err := s.publish(ctx, event)
+		if err != nil {
+			failed = err
+			failures++
+		}
+		results = append(results, &Result{Event: event, Err: err})
+	}
+
+	if failures == len(results) {
+		return nil, xerrors.WrapInternalError(fmt.Errorf("publish %d events: %w", failures, failed))
+	}
+
+	s.Logger.Sugar().Debugf("published %d events, %d failed", len(results), failures)
+	return results, nil
+}
+
+// publish publishes event with recipient id as key, so the event is routed to the node the recipient is connected to
+func (s ServiceImpl) publish(ctx context.Context, event *model.Event) error {
+	msg := broker.NewMessage(nil)
+	msg.ID = string(event.ID)
+	msg.Key = event.UserID.String()
+	msg.Topic = s.Topic(msg.Key)
+	msg.ContentType = contentTypeJSON
+	msg.Timestamp = event.CreatedAt
+	msg.Body = event.Data
+
+	ctx, cancel := context.WithTimeout(ctx, defaultPublishTimeout)
+	defer cancel()
+
+	err := s.Publisher.Publish(ctx, msg)
+	if err != nil {
+		return fmt.Errorf("publish event %s to %s: %w", event.ID, event.UserID, err)
+	}
+	return nil
+}
+
+// newEvents validates notification and makes event of it for every recipient
+func newEvents(publication *Publication) ([]*model.Event, error) {
+	if publication.Notification == nil {
+		return nil, fmt.Errorf("empty notification")
+	}
+
+	if len(publication.Recipients) == 0 || len(publication.Recipients) > MaxRecipients {
+		return nil, fmt.Errorf("number of recipients must be in range (0, %d]", MaxRecipients)
+	}
+
+	events := make([]*model.Event, 0, len(publication.Recipients))
+	seen := make(map[model.UserID]struct{}, len(publication.Recipients))
+	for _, recipient := range publication.Recipients {
+		if _, ok := seen[recipient]; ok {
+			continue
+		}
+		seen[recipient] = struct{}{}
+
+		notification := *publication.Notification
+		notification.Recipient = recipient
+		if notification.ID == "" {
+			notification.ID = model.EventID(utils.GenerateEUID())
+		}
+		if notification.Version == 0 {
+			notification.Version = model.CurrentNotificationVersion
+		}
+		if notification.CreatedAt.IsZero() {
+			notification.CreatedAt = time.Now()
+		}
+
+		err := notification.Validate()
+		if err != nil {
+			return nil, fmt.Errorf("recipient %s: %w", recipient, err)
+		}
+
+		event, err := model.NewEvent(&notification)
+		if err != nil {
+			return nil, fmt.Errorf("new event: %w", err)
+		}
+		events = append(events, event)
+	}
+
+	return events, nil
+}
@@ -0,0 +1,25 @@
+package utils
+
+import (
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+const (
+	serviceNamePrefix      = "rtn"
+	connectionEntityPrefix = "c"
+	eventEntityPrefix      = "e"
+)
+
+func GenerateCUID() string {
+	return generateUID(connectionEntityPrefix)
+}
+
+func GenerateEUID() string {
+	return generateUID(eventEntityPrefix)
+}
+
+func generateUID(entityPrefix string) string {
+	return serviceNamePrefix + entityPrefix + strings.Replace(uuid.New().String(), "-", "", -1)
+}
@@ -0,0 +1,21 @@
+package utils
+
+import (
+	"crypto/subtle"
+)
+
+// ValidToken checks that token is one of the service tokens
+func ValidToken(tokens []string, token string) bool {
+	if token == "" {
+		return false
+	}
+
+	valid := false
+	for _, expected := range tokens {
+		// every token is compared, so response time does not depend on which one matches
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(token)) == 1 {
+			valid = true
+		}
+	}
+	return valid
+}